@@ -0,0 +1,54 @@
+import '../utils/messages.dart';
+
+/// Шлюз ответил успешно, но список моделей пуст — обычно это ошибка
+/// настройки эндпоинта, а не сетевой сбой.
+class NoModelsAvailableException implements Exception {
+  final String? provider;
+
+  const NoModelsAvailableException({this.provider});
+
+  String get message => provider == null
+      ? localize('models.noneExposed')
+      : localize('models.noneExposedByProvider', {'provider': provider});
+
+  @override
+  String toString() => message;
+}
+
+/// Шлюз ответил 200, но без вариантов ответа (`choices` пуст). В отличие от
+/// [ContentFilteredException], повтор того же запроса часто помогает.
+class EmptyResponseException implements Exception {
+  final String provider;
+
+  const EmptyResponseException(this.provider);
+
+  String get message => 'Пустой ответ от $provider';
+
+  @override
+  String toString() => message;
+}
+
+/// Ответ модели заблокирован фильтром безопасности провайдера
+/// (`finish_reason: content_filter`) — в отличие от пустого ответа, повтор
+/// с теми же данными обычно не помогает.
+class ContentFilteredException implements Exception {
+  const ContentFilteredException();
+
+  String get message => 'Ответ заблокирован фильтром безопасности провайдера';
+
+  @override
+  String toString() => message;
+}
+
+/// Генерация не уложилась в лимит времени, заданный для этого запроса.
+/// В отличие от сетевого таймаута клиента, запрос отменён по решению вызывающего.
+class GenerationTimeoutException implements Exception {
+  final Duration timeout;
+
+  const GenerationTimeoutException(this.timeout);
+
+  String get message => 'Генерация не уложилась в ${timeout.inSeconds} с и была прервана';
+
+  @override
+  String toString() => message;
+}
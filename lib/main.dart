@@ -12,6 +12,11 @@ import 'services/template_service.dart';
 import 'services/llm_service.dart';
 import 'services/confluence_service.dart';
 import 'services/theme_service.dart';
+import 'services/error_log_service.dart';
+import 'services/history_service.dart';
+import 'services/prompt_snippet_service.dart';
+import 'services/startup_events.dart';
+import 'services/shutdown_service.dart';
 import 'screens/setup_screen.dart';
 import 'screens/main_screen.dart';
 import 'theme/app_theme.dart';
@@ -56,6 +61,7 @@ void main() async {
     final preConfigService = ConfigService();
     runApp(MyApp(preInitialized: preConfigService));
   }, (error, stack) {
+    ErrorLogService().record('zone', error);
     debugPrint('[ZoneError] $error');
     debugPrint(stack.toString());
   });
@@ -71,6 +77,43 @@ class MyApp extends StatefulWidget {
 
 class _MyAppState extends State<MyApp> {
   int _reloadToken = 0; // меняем для перезапуска FutureBuilder
+  final _scaffoldMessengerKey = GlobalKey<ScaffoldMessengerState>();
+  StreamSubscription<StartupErrorEvent>? _startupErrorsSub;
+  AppLifecycleListener? _lifecycleListener;
+
+  @override
+  void initState() {
+    super.initState();
+    // Ошибки этапов запуска показываем уведомлениями, а не только в консоли
+    _startupErrorsSub = StartupEvents.errors.listen(_showStartupError);
+    // Перед закрытием окна дописываем отложенные сохранения и отменяем генерации
+    _lifecycleListener = AppLifecycleListener(
+      onExitRequested: () async {
+        await ShutdownService().shutdown();
+        return AppExitResponse.exit;
+      },
+      onDetach: () => unawaited(ShutdownService().shutdown()),
+    );
+  }
+
+  @override
+  void dispose() {
+    _startupErrorsSub?.cancel();
+    _lifecycleListener?.dispose();
+    super.dispose();
+  }
+
+  void _showStartupError(StartupErrorEvent event) {
+    WidgetsBinding.instance.addPostFrameCallback((_) {
+      _scaffoldMessengerKey.currentState?.showSnackBar(
+        SnackBar(
+          content: Text('${event.stageLabel}: ${event.message}'),
+          backgroundColor: Colors.red.shade600,
+          duration: const Duration(seconds: 6),
+        ),
+      );
+    });
+  }
 
   @override
   Widget build(BuildContext context) {
@@ -81,11 +124,15 @@ class _MyAppState extends State<MyApp> {
         ChangeNotifierProvider(create: (_) => LLMService()),
         ChangeNotifierProvider(create: (_) => ConfluenceService()),
         ChangeNotifierProvider(create: (_) => ThemeService()),
+        ChangeNotifierProvider(create: (_) => HistoryService()),
+        ChangeNotifierProvider(create: (_) => PromptSnippetService()),
+        ChangeNotifierProvider.value(value: ErrorLogService()),
       ],
       child: Builder(
         builder: (innerContext) => Consumer<ThemeService>(
           builder: (context, themeService, child) => MaterialApp(
             title: 'TeeZeeNator',
+            scaffoldMessengerKey: _scaffoldMessengerKey,
             theme: AppTheme.light,
             darkTheme: AppTheme.dark,
             themeMode: themeService.mode,
@@ -152,23 +199,46 @@ class _MyAppState extends State<MyApp> {
   }
   
   Future<bool> _initializeServices(BuildContext context) async {
+    // Get service instances from Provider context
+    final configService = Provider.of<ConfigService>(context, listen: false);
+    final templateService = Provider.of<TemplateService>(context, listen: false);
+    final themeService = Provider.of<ThemeService>(context, listen: false);
+
+    // Каждый этап сообщает о своей ошибке отдельно (событие startup:error)
     try {
-      // Get service instances from Provider context
-      final configService = Provider.of<ConfigService>(context, listen: false);
-      final templateService = Provider.of<TemplateService>(context, listen: false);
-      final themeService = Provider.of<ThemeService>(context, listen: false);
       // Ensure config is initialized (early preInit may already have done this)
       await configService.init();
+    } catch (e) {
+      StartupEvents.reportError('config', e);
+      return false;
+    }
+
+    try {
       final isDark = configService.config?.isDarkTheme ?? true;
       themeService.setMode(isDark ? ThemeMode.dark : ThemeMode.light);
-      
-      // Initialize TemplateService
-      await templateService.init();
-      
+    } catch (e) {
+      StartupEvents.reportError('theme', e);
+    }
+
+    // Шаблоны грузим в фоне, чтобы окно появилось сразу (медленный диск / сетевая папка).
+    // TemplateService уведомит слушателей о готовности; getAllTemplates() дождётся загрузки.
+    // Ошибка не блокирует запуск: сервис повторит init() при первом обращении.
+    templateService.configureStorage(
+      mode: configService.config?.templateStorageMode,
+      directory: configService.config?.templatesDirectory,
+    );
+    templateService.configureProfile(configService.config?.templateProfile);
+    templateService.followConfig(configService);
+    templateService.configureTemplateSizeWarning(configService.config?.templateTokenWarningThreshold);
+    unawaited(templateService.init().catchError((Object e) {
+      StartupEvents.reportError('templates', e);
+    }));
+
+    try {
       // Check configuration
       return await configService.hasValidConfiguration();
     } catch (e) {
-      print('Error initializing services: $e');
+      StartupEvents.reportError('config', e);
       return false;
     }
   }
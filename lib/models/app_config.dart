@@ -56,6 +56,129 @@ class AppConfig {
   @HiveField(14)
   final bool isDarkTheme;
 
+  @HiveField(15)
+  final String? modelPrefix; // Префикс ID модели для шлюзов OpenRouter-типа (например, 'openai/')
+
+  @HiveField(16)
+  final List<String>? outputFilters; // Regex-фильтры результата генерации (null — встроенные по умолчанию, [] — отключены)
+
+  @HiveField(17)
+  final int? connectTimeoutSeconds; // Таймаут установки соединения, сек (null — 10)
+
+  @HiveField(18)
+  final int? readTimeoutSeconds; // Таймаут ожидания данных при генерации, сек (null — 300)
+
+  @HiveField(19)
+  final int? modelsCacheTtlSeconds; // Время жизни кеша списка моделей, сек (null — 60, 0 — без кеша)
+
+  @HiveField(20)
+  final int? maxInputTokens; // Лимит входных токенов запроса (null — по контекстному окну модели, 0 — без проверки)
+
+  @HiveField(21)
+  final String? completionsPath; // Путь эндпоинта генерации (null — /chat/completions)
+
+  @HiveField(22)
+  final String? modelsPath; // Путь эндпоинта списка моделей (null — /models)
+
+  @HiveField(23)
+  final List<String>? favoriteModels; // Избранные модели — показываются первыми в заданном порядке
+
+  @HiveField(24)
+  final String? markdownFlavor; // Диалект Markdown результата: 'gfm' или 'commonmark' (null — gfm)
+
+  @HiveField(25)
+  final Map<String, dynamic>? extraBodyFields; // Дополнительные поля тела запроса генерации (provider, route и т.п.)
+
+  @HiveField(26)
+  final String? templateStorageMode; // Хранение шаблонов: 'hive' (по умолчанию) или 'files' — отдельные .md файлы с индексом
+
+  @HiveField(27)
+  final String? templatesDirectory; // Каталог шаблонов для режима 'files'
+
+  @HiveField(28)
+  final int? maxHistoryEntries; // Максимум записей в истории генераций (null — без ограничения)
+
+  @HiveField(29)
+  final int? maxHistoryAgeDays; // Удалять записи истории старше N дней (null — без ограничения)
+
+  @HiveField(30)
+  final List<String>? manualModels; // Модели, добавленные вручную (например, fine-tuned ft:...), которых нет в /models
+
+  @HiveField(31)
+  final String? uiLanguage; // Язык сообщений об ошибках: 'ru' (по умолчанию) или 'en'
+
+  @HiveField(32)
+  final String? jsonSchema; // JSON Schema для структурированного вывода (null — схема строится по разделам шаблона)
+
+  @HiveField(33)
+  final String? templateProfile; // Профиль набора шаблонов (null — набор по умолчанию); общий набор 'global' доступен во всех профилях
+
+  @HiveField(34)
+  final int? maxConcurrency; // Параллельных запросов при пакетной генерации и сравнении моделей (null — 3)
+
+  @HiveField(35)
+  final int? streamIdleTimeoutSeconds; // Прервать стрим, если N секунд не приходит ни одного чанка (null — 60, 0 — не ограничивать)
+
+  @HiveField(36)
+  final bool? appendAcceptanceCriteria; // Требовать в конце ТЗ раздел «Критерии приёмки» в формате Given/When/Then (null/false — выключено)
+
+  @HiveField(37)
+  final bool? insecureSkipVerify; // НЕ проверять TLS-сертификат шлюза (самоподписанные сертификаты). Только явное включение
+
+  @HiveField(38)
+  final String? caCertPath; // PEM-файл с корпоративными корневыми сертификатами для проверки TLS шлюза
+
+  @HiveField(39)
+  final bool? redactPii; // Маскировать email, телефоны и номера карт во вводе перед отправкой провайдеру (null/false — выключено)
+
+  @HiveField(40)
+  final Map<String, dynamic>? modelPricing; // Цены моделей за 1K токенов: {"model": {"input": 0.0025, "output": 0.01}} — перекрывают встроенные
+
+  @HiveField(41)
+  final String? costCurrency; // Валюта цен из modelPricing (null — USD)
+
+  @HiveField(42)
+  final String? reasoningEffort; // reasoning_effort для reasoning-моделей: low / medium / high (null — не передаётся)
+
+  @HiveField(43)
+  final String? dateFormat; // Формат {{today}}/{{datetime}} в шаблонах (dd, MM, yyyy, HH, mm, ss); null — по локали системы
+
+  @HiveField(44)
+  final bool? trimIncompleteEndings; // Обрезать оборванное окончание ответа, усечённого по лимиту токенов (finish_reason: length)
+
+  @HiveField(45)
+  final int? emptyResponseRetries; // Повторы запроса при пустом ответе (нет choices или только пробелы); null/0 — без повторов
+
+  @HiveField(46)
+  final Map<String, dynamic>? logitBias; // logit_bias запроса генерации: id токена -> смещение [-100, 100]; пустой — не передаётся
+
+  @HiveField(47)
+  final String? healthPath; // Путь лёгкого эндпоинта для проверки доступности (ping); null — путь списка моделей
+
+  @HiveField(48)
+  final Map<String, dynamic>? systemPromptOverrides; // Системные промты для отдельных моделей: id модели -> текст ({{template}} — место шаблона)
+
+  @HiveField(49)
+  final int? templateTokenWarningThreshold; // Порог (в токенах), выше которого при сохранении шаблона выдаётся предупреждение; null — значение по умолчанию
+
+  @HiveField(50)
+  final Map<String, String>? endpoints; // Именованные базовые URL окружений шлюза: {"dev": "https://...", "prod": "https://..."}
+
+  @HiveField(51)
+  final String? activeEndpoint; // Имя активного окружения из endpoints (null — URL задан вручную)
+
+  @HiveField(52)
+  final bool? captureRawResponses; // Сохранять сырой JSON последнего ответа провайдера для диагностики (в памяти, без ключа)
+
+  @HiveField(53)
+  final Map<String, dynamic>? endpointCapabilities; // Результат проверки возможностей шлюза при сохранении (см. EndpointCapabilities)
+
+  @HiveField(54)
+  final bool? prependTableOfContents; // Добавлять оглавление со ссылками в начало Markdown-документа после генерации
+
+  @HiveField(55)
+  final List<String>? deprecatedModels; // Модели, объявленные провайдером устаревшими: скрываются из активного списка, генерация ими даёт предупреждение
+
   AppConfig({
     required this.apiUrl,
     required this.apiToken,
@@ -73,6 +196,47 @@ class AppConfig {
     this.groqToken,
     this.specMusicConfig,
     bool? isDarkTheme,
+    this.modelPrefix,
+    this.outputFilters,
+    this.connectTimeoutSeconds,
+    this.readTimeoutSeconds,
+    this.modelsCacheTtlSeconds,
+    this.maxInputTokens,
+    this.completionsPath,
+    this.modelsPath,
+    this.favoriteModels,
+    this.markdownFlavor,
+    this.extraBodyFields,
+    this.templateStorageMode,
+    this.templatesDirectory,
+    this.maxHistoryEntries,
+    this.maxHistoryAgeDays,
+    this.manualModels,
+    this.uiLanguage,
+    this.jsonSchema,
+    this.templateProfile,
+    this.maxConcurrency,
+    this.streamIdleTimeoutSeconds,
+    this.appendAcceptanceCriteria,
+    this.insecureSkipVerify,
+    this.caCertPath,
+    this.redactPii,
+    this.modelPricing,
+    this.costCurrency,
+    this.reasoningEffort,
+    this.dateFormat,
+    this.trimIncompleteEndings,
+    this.emptyResponseRetries,
+    this.logitBias,
+    this.healthPath,
+    this.systemPromptOverrides,
+    this.templateTokenWarningThreshold,
+    this.endpoints,
+    this.activeEndpoint,
+    this.captureRawResponses,
+    this.endpointCapabilities,
+    this.prependTableOfContents,
+    this.deprecatedModels,
   })  : isDarkTheme = isDarkTheme ?? true,
         outputFormat = outputFormat ?? preferredFormat ?? OutputFormat.markdown; // Приоритет: новый параметр, затем legacy, затем значение по умолчанию
 
@@ -101,10 +265,54 @@ class AppConfig {
       groqToken: map[12] as String?, // Groq токен
       specMusicConfig: map[13] as SpecMusicConfig?, // Конфигурация музикации
       isDarkTheme: map[14] as bool? ?? true,
+      modelPrefix: map[15] as String?,
+      outputFilters: (map[16] as List?)?.cast<String>(),
+      connectTimeoutSeconds: map[17] as int?,
+      readTimeoutSeconds: map[18] as int?,
+      modelsCacheTtlSeconds: map[19] as int?,
+      maxInputTokens: map[20] as int?,
+      completionsPath: map[21] as String?,
+      modelsPath: map[22] as String?,
+      favoriteModels: (map[23] as List?)?.cast<String>(),
+      markdownFlavor: map[24] as String?,
+      extraBodyFields: (map[25] as Map?)?.cast<String, dynamic>(),
+      templateStorageMode: map[26] as String?,
+      templatesDirectory: map[27] as String?,
+      maxHistoryEntries: map[28] as int?,
+      maxHistoryAgeDays: map[29] as int?,
+      manualModels: (map[30] as List?)?.cast<String>(),
+      uiLanguage: map[31] as String?,
+      jsonSchema: map[32] as String?,
+      templateProfile: map[33] as String?,
+      maxConcurrency: map[34] as int?,
+      streamIdleTimeoutSeconds: map[35] as int?,
+      appendAcceptanceCriteria: map[36] as bool?,
+      insecureSkipVerify: map[37] as bool?,
+      caCertPath: map[38] as String?,
+      redactPii: map[39] as bool?,
+      modelPricing: (map[40] as Map?)?.cast<String, dynamic>(),
+      costCurrency: map[41] as String?,
+      reasoningEffort: map[42] as String?,
+      dateFormat: map[43] as String?,
+      trimIncompleteEndings: map[44] as bool?,
+      emptyResponseRetries: map[45] as int?,
+      logitBias: (map[46] as Map?)?.cast<String, dynamic>(),
+      healthPath: map[47] as String?,
+      systemPromptOverrides: (map[48] as Map?)?.cast<String, dynamic>(),
+      templateTokenWarningThreshold: map[49] as int?,
+      endpoints: (map[50] as Map?)?.cast<String, String>(),
+      activeEndpoint: map[51] as String?,
+      captureRawResponses: map[52] as bool?,
+      endpointCapabilities: (map[53] as Map?)?.cast<String, dynamic>(),
+      prependTableOfContents: map[54] as bool?,
+      deprecatedModels: (map[55] as List?)?.cast<String>(),
       // Игнорируем старое поле useConfluenceFormat - теперь всегда используем Confluence
     );
   }
   
+  /// Копия конфигурации с изменёнными полями. Необязательные настройки, начиная
+  /// с [modelPrefix], а также [confluenceConfig], [specMusicConfig] и [activeEndpoint]
+  /// сбрасываются явной передачей null.
   AppConfig copyWith({
     String? apiUrl,
     String? apiToken,
@@ -121,6 +329,47 @@ class AppConfig {
     String? groqToken,
     Object? specMusicConfig = _sentinel,
     bool? isDarkTheme,
+    Object? modelPrefix = _sentinel,
+    Object? outputFilters = _sentinel,
+    Object? connectTimeoutSeconds = _sentinel,
+    Object? readTimeoutSeconds = _sentinel,
+    Object? modelsCacheTtlSeconds = _sentinel,
+    Object? maxInputTokens = _sentinel,
+    Object? completionsPath = _sentinel,
+    Object? modelsPath = _sentinel,
+    Object? favoriteModels = _sentinel,
+    Object? markdownFlavor = _sentinel,
+    Object? extraBodyFields = _sentinel,
+    Object? templateStorageMode = _sentinel,
+    Object? templatesDirectory = _sentinel,
+    Object? maxHistoryEntries = _sentinel,
+    Object? maxHistoryAgeDays = _sentinel,
+    Object? manualModels = _sentinel,
+    Object? uiLanguage = _sentinel,
+    Object? jsonSchema = _sentinel,
+    Object? templateProfile = _sentinel,
+    Object? maxConcurrency = _sentinel,
+    Object? streamIdleTimeoutSeconds = _sentinel,
+    Object? appendAcceptanceCriteria = _sentinel,
+    Object? insecureSkipVerify = _sentinel,
+    Object? caCertPath = _sentinel,
+    Object? redactPii = _sentinel,
+    Object? modelPricing = _sentinel,
+    Object? costCurrency = _sentinel,
+    Object? reasoningEffort = _sentinel,
+    Object? dateFormat = _sentinel,
+    Object? trimIncompleteEndings = _sentinel,
+    Object? emptyResponseRetries = _sentinel,
+    Object? logitBias = _sentinel,
+    Object? healthPath = _sentinel,
+    Object? systemPromptOverrides = _sentinel,
+    Object? templateTokenWarningThreshold = _sentinel,
+    Object? endpoints = _sentinel,
+    Object? activeEndpoint = _sentinel,
+    Object? captureRawResponses = _sentinel,
+    Object? endpointCapabilities = _sentinel,
+    Object? prependTableOfContents = _sentinel,
+    Object? deprecatedModels = _sentinel,
   }) {
     return AppConfig(
       apiUrl: apiUrl ?? this.apiUrl,
@@ -142,8 +391,63 @@ class AppConfig {
           ? this.specMusicConfig
           : specMusicConfig as SpecMusicConfig?,
       isDarkTheme: isDarkTheme ?? this.isDarkTheme,
+      modelPrefix: modelPrefix == _sentinel ? this.modelPrefix : modelPrefix as String?,
+      outputFilters: outputFilters == _sentinel ? this.outputFilters : outputFilters as List<String>?,
+      connectTimeoutSeconds: connectTimeoutSeconds == _sentinel ? this.connectTimeoutSeconds : connectTimeoutSeconds as int?,
+      readTimeoutSeconds: readTimeoutSeconds == _sentinel ? this.readTimeoutSeconds : readTimeoutSeconds as int?,
+      modelsCacheTtlSeconds: modelsCacheTtlSeconds == _sentinel ? this.modelsCacheTtlSeconds : modelsCacheTtlSeconds as int?,
+      maxInputTokens: maxInputTokens == _sentinel ? this.maxInputTokens : maxInputTokens as int?,
+      completionsPath: completionsPath == _sentinel ? this.completionsPath : completionsPath as String?,
+      modelsPath: modelsPath == _sentinel ? this.modelsPath : modelsPath as String?,
+      favoriteModels: favoriteModels == _sentinel ? this.favoriteModels : favoriteModels as List<String>?,
+      markdownFlavor: markdownFlavor == _sentinel ? this.markdownFlavor : markdownFlavor as String?,
+      extraBodyFields: extraBodyFields == _sentinel ? this.extraBodyFields : extraBodyFields as Map<String, dynamic>?,
+      templateStorageMode: templateStorageMode == _sentinel ? this.templateStorageMode : templateStorageMode as String?,
+      templatesDirectory: templatesDirectory == _sentinel ? this.templatesDirectory : templatesDirectory as String?,
+      maxHistoryEntries: maxHistoryEntries == _sentinel ? this.maxHistoryEntries : maxHistoryEntries as int?,
+      maxHistoryAgeDays: maxHistoryAgeDays == _sentinel ? this.maxHistoryAgeDays : maxHistoryAgeDays as int?,
+      manualModels: manualModels == _sentinel ? this.manualModels : manualModels as List<String>?,
+      uiLanguage: uiLanguage == _sentinel ? this.uiLanguage : uiLanguage as String?,
+      jsonSchema: jsonSchema == _sentinel ? this.jsonSchema : jsonSchema as String?,
+      templateProfile: templateProfile == _sentinel ? this.templateProfile : templateProfile as String?,
+      maxConcurrency: maxConcurrency == _sentinel ? this.maxConcurrency : maxConcurrency as int?,
+      streamIdleTimeoutSeconds: streamIdleTimeoutSeconds == _sentinel ? this.streamIdleTimeoutSeconds : streamIdleTimeoutSeconds as int?,
+      appendAcceptanceCriteria: appendAcceptanceCriteria == _sentinel ? this.appendAcceptanceCriteria : appendAcceptanceCriteria as bool?,
+      insecureSkipVerify: insecureSkipVerify == _sentinel ? this.insecureSkipVerify : insecureSkipVerify as bool?,
+      caCertPath: caCertPath == _sentinel ? this.caCertPath : caCertPath as String?,
+      redactPii: redactPii == _sentinel ? this.redactPii : redactPii as bool?,
+      modelPricing: modelPricing == _sentinel ? this.modelPricing : modelPricing as Map<String, dynamic>?,
+      costCurrency: costCurrency == _sentinel ? this.costCurrency : costCurrency as String?,
+      reasoningEffort: reasoningEffort == _sentinel ? this.reasoningEffort : reasoningEffort as String?,
+      dateFormat: dateFormat == _sentinel ? this.dateFormat : dateFormat as String?,
+      trimIncompleteEndings: trimIncompleteEndings == _sentinel ? this.trimIncompleteEndings : trimIncompleteEndings as bool?,
+      emptyResponseRetries: emptyResponseRetries == _sentinel ? this.emptyResponseRetries : emptyResponseRetries as int?,
+      logitBias: logitBias == _sentinel ? this.logitBias : logitBias as Map<String, dynamic>?,
+      healthPath: healthPath == _sentinel ? this.healthPath : healthPath as String?,
+      systemPromptOverrides: systemPromptOverrides == _sentinel ? this.systemPromptOverrides : systemPromptOverrides as Map<String, dynamic>?,
+      templateTokenWarningThreshold: templateTokenWarningThreshold == _sentinel ? this.templateTokenWarningThreshold : templateTokenWarningThreshold as int?,
+      endpoints: endpoints == _sentinel ? this.endpoints : endpoints as Map<String, String>?,
+      activeEndpoint: activeEndpoint == _sentinel
+          ? this.activeEndpoint
+          : activeEndpoint as String?,
+      captureRawResponses: captureRawResponses == _sentinel ? this.captureRawResponses : captureRawResponses as bool?,
+      endpointCapabilities: endpointCapabilities == _sentinel ? this.endpointCapabilities : endpointCapabilities as Map<String, dynamic>?,
+      prependTableOfContents: prependTableOfContents == _sentinel ? this.prependTableOfContents : prependTableOfContents as bool?,
+      deprecatedModels: deprecatedModels == _sentinel ? this.deprecatedModels : deprecatedModels as List<String>?,
     );
   }
+
+  /// Та же конфигурация без [activeEndpoint], если URL провайдера изменён вручную
+  /// и больше не совпадает с адресом выбранного окружения из [endpoints]
+  AppConfig withoutStaleEndpoint() {
+    final name = activeEndpoint;
+    if (name == null) return this;
+    String normalize(String? url) => (url ?? '').trim().replaceFirst(RegExp(r'/+$'), '');
+    final current = provider == 'llmops' ? llmopsBaseUrl : apiUrl;
+    final expected = endpoints?[name];
+    if (expected != null && normalize(current) == normalize(expected)) return this;
+    return copyWith(activeEndpoint: null);
+  }
 }
 
 // Sentinel object to distinguish between null and not provided
@@ -32,13 +32,54 @@ class AppConfigAdapter extends TypeAdapter<AppConfig> {
       groqToken: fields[12] as String?,
       specMusicConfig: fields[13] as SpecMusicConfig?,
       isDarkTheme: fields[14] as bool?,
+      modelPrefix: fields[15] as String?,
+      outputFilters: (fields[16] as List?)?.cast<String>(),
+      connectTimeoutSeconds: fields[17] as int?,
+      readTimeoutSeconds: fields[18] as int?,
+      modelsCacheTtlSeconds: fields[19] as int?,
+      maxInputTokens: fields[20] as int?,
+      completionsPath: fields[21] as String?,
+      modelsPath: fields[22] as String?,
+      favoriteModels: (fields[23] as List?)?.cast<String>(),
+      markdownFlavor: fields[24] as String?,
+      extraBodyFields: (fields[25] as Map?)?.cast<String, dynamic>(),
+      templateStorageMode: fields[26] as String?,
+      templatesDirectory: fields[27] as String?,
+      maxHistoryEntries: fields[28] as int?,
+      maxHistoryAgeDays: fields[29] as int?,
+      manualModels: (fields[30] as List?)?.cast<String>(),
+      uiLanguage: fields[31] as String?,
+      jsonSchema: fields[32] as String?,
+      templateProfile: fields[33] as String?,
+      maxConcurrency: fields[34] as int?,
+      streamIdleTimeoutSeconds: fields[35] as int?,
+      appendAcceptanceCriteria: fields[36] as bool?,
+      insecureSkipVerify: fields[37] as bool?,
+      caCertPath: fields[38] as String?,
+      redactPii: fields[39] as bool?,
+      modelPricing: (fields[40] as Map?)?.cast<String, dynamic>(),
+      costCurrency: fields[41] as String?,
+      reasoningEffort: fields[42] as String?,
+      dateFormat: fields[43] as String?,
+      trimIncompleteEndings: fields[44] as bool?,
+      emptyResponseRetries: fields[45] as int?,
+      logitBias: (fields[46] as Map?)?.cast<String, dynamic>(),
+      healthPath: fields[47] as String?,
+      systemPromptOverrides: (fields[48] as Map?)?.cast<String, dynamic>(),
+      templateTokenWarningThreshold: fields[49] as int?,
+      endpoints: (fields[50] as Map?)?.cast<String, String>(),
+      activeEndpoint: fields[51] as String?,
+      captureRawResponses: fields[52] as bool?,
+      endpointCapabilities: (fields[53] as Map?)?.cast<String, dynamic>(),
+      prependTableOfContents: fields[54] as bool?,
+      deprecatedModels: (fields[55] as List?)?.cast<String>(),
     );
   }
 
   @override
   void write(BinaryWriter writer, AppConfig obj) {
     writer
-      ..writeByte(15)
+      ..writeByte(56)
       ..writeByte(0)
       ..write(obj.apiUrl)
       ..writeByte(1)
@@ -68,7 +109,89 @@ class AppConfigAdapter extends TypeAdapter<AppConfig> {
       ..writeByte(13)
       ..write(obj.specMusicConfig)
       ..writeByte(14)
-      ..write(obj.isDarkTheme);
+      ..write(obj.isDarkTheme)
+      ..writeByte(15)
+      ..write(obj.modelPrefix)
+      ..writeByte(16)
+      ..write(obj.outputFilters)
+      ..writeByte(17)
+      ..write(obj.connectTimeoutSeconds)
+      ..writeByte(18)
+      ..write(obj.readTimeoutSeconds)
+      ..writeByte(19)
+      ..write(obj.modelsCacheTtlSeconds)
+      ..writeByte(20)
+      ..write(obj.maxInputTokens)
+      ..writeByte(21)
+      ..write(obj.completionsPath)
+      ..writeByte(22)
+      ..write(obj.modelsPath)
+      ..writeByte(23)
+      ..write(obj.favoriteModels)
+      ..writeByte(24)
+      ..write(obj.markdownFlavor)
+      ..writeByte(25)
+      ..write(obj.extraBodyFields)
+      ..writeByte(26)
+      ..write(obj.templateStorageMode)
+      ..writeByte(27)
+      ..write(obj.templatesDirectory)
+      ..writeByte(28)
+      ..write(obj.maxHistoryEntries)
+      ..writeByte(29)
+      ..write(obj.maxHistoryAgeDays)
+      ..writeByte(30)
+      ..write(obj.manualModels)
+      ..writeByte(31)
+      ..write(obj.uiLanguage)
+      ..writeByte(32)
+      ..write(obj.jsonSchema)
+      ..writeByte(33)
+      ..write(obj.templateProfile)
+      ..writeByte(34)
+      ..write(obj.maxConcurrency)
+      ..writeByte(35)
+      ..write(obj.streamIdleTimeoutSeconds)
+      ..writeByte(36)
+      ..write(obj.appendAcceptanceCriteria)
+      ..writeByte(37)
+      ..write(obj.insecureSkipVerify)
+      ..writeByte(38)
+      ..write(obj.caCertPath)
+      ..writeByte(39)
+      ..write(obj.redactPii)
+      ..writeByte(40)
+      ..write(obj.modelPricing)
+      ..writeByte(41)
+      ..write(obj.costCurrency)
+      ..writeByte(42)
+      ..write(obj.reasoningEffort)
+      ..writeByte(43)
+      ..write(obj.dateFormat)
+      ..writeByte(44)
+      ..write(obj.trimIncompleteEndings)
+      ..writeByte(45)
+      ..write(obj.emptyResponseRetries)
+      ..writeByte(46)
+      ..write(obj.logitBias)
+      ..writeByte(47)
+      ..write(obj.healthPath)
+      ..writeByte(48)
+      ..write(obj.systemPromptOverrides)
+      ..writeByte(49)
+      ..write(obj.templateTokenWarningThreshold)
+      ..writeByte(50)
+      ..write(obj.endpoints)
+      ..writeByte(51)
+      ..write(obj.activeEndpoint)
+      ..writeByte(52)
+      ..write(obj.captureRawResponses)
+      ..writeByte(53)
+      ..write(obj.endpointCapabilities)
+      ..writeByte(54)
+      ..write(obj.prependTableOfContents)
+      ..writeByte(55)
+      ..write(obj.deprecatedModels);
   }
 
   @override
@@ -105,6 +228,56 @@ AppConfig _$AppConfigFromJson(Map<String, dynamic> json) => AppConfig(
       specMusicConfig: _specMusicConfigFromJson(
           json['specMusicConfig'] as Map<String, dynamic>?),
       isDarkTheme: json['isDarkTheme'] as bool?,
+      modelPrefix: json['modelPrefix'] as String?,
+      outputFilters: (json['outputFilters'] as List<dynamic>?)
+          ?.map((e) => e as String)
+          .toList(),
+      connectTimeoutSeconds: (json['connectTimeoutSeconds'] as num?)?.toInt(),
+      readTimeoutSeconds: (json['readTimeoutSeconds'] as num?)?.toInt(),
+      modelsCacheTtlSeconds: (json['modelsCacheTtlSeconds'] as num?)?.toInt(),
+      maxInputTokens: (json['maxInputTokens'] as num?)?.toInt(),
+      completionsPath: json['completionsPath'] as String?,
+      modelsPath: json['modelsPath'] as String?,
+      favoriteModels: (json['favoriteModels'] as List<dynamic>?)
+          ?.map((e) => e as String)
+          .toList(),
+      markdownFlavor: json['markdownFlavor'] as String?,
+      extraBodyFields: json['extraBodyFields'] as Map<String, dynamic>?,
+      templateStorageMode: json['templateStorageMode'] as String?,
+      templatesDirectory: json['templatesDirectory'] as String?,
+      maxHistoryEntries: (json['maxHistoryEntries'] as num?)?.toInt(),
+      maxHistoryAgeDays: (json['maxHistoryAgeDays'] as num?)?.toInt(),
+      manualModels: (json['manualModels'] as List<dynamic>?)
+          ?.map((e) => e as String)
+          .toList(),
+      uiLanguage: json['uiLanguage'] as String?,
+      jsonSchema: json['jsonSchema'] as String?,
+      templateProfile: json['templateProfile'] as String?,
+      maxConcurrency: (json['maxConcurrency'] as num?)?.toInt(),
+      streamIdleTimeoutSeconds: (json['streamIdleTimeoutSeconds'] as num?)?.toInt(),
+      appendAcceptanceCriteria: json['appendAcceptanceCriteria'] as bool?,
+      insecureSkipVerify: json['insecureSkipVerify'] as bool?,
+      caCertPath: json['caCertPath'] as String?,
+      redactPii: json['redactPii'] as bool?,
+      modelPricing: json['modelPricing'] as Map<String, dynamic>?,
+      costCurrency: json['costCurrency'] as String?,
+      reasoningEffort: json['reasoningEffort'] as String?,
+      dateFormat: json['dateFormat'] as String?,
+      trimIncompleteEndings: json['trimIncompleteEndings'] as bool?,
+      emptyResponseRetries: (json['emptyResponseRetries'] as num?)?.toInt(),
+      logitBias: json['logitBias'] as Map<String, dynamic>?,
+      healthPath: json['healthPath'] as String?,
+      systemPromptOverrides: json['systemPromptOverrides'] as Map<String, dynamic>?,
+      templateTokenWarningThreshold: (json['templateTokenWarningThreshold'] as num?)?.toInt(),
+      endpoints: (json['endpoints'] as Map<String, dynamic>?)?.map(
+          (k, e) => MapEntry(k, e as String)),
+      activeEndpoint: json['activeEndpoint'] as String?,
+      captureRawResponses: json['captureRawResponses'] as bool?,
+      endpointCapabilities: json['endpointCapabilities'] as Map<String, dynamic>?,
+      prependTableOfContents: json['prependTableOfContents'] as bool?,
+      deprecatedModels: (json['deprecatedModels'] as List<dynamic>?)
+          ?.map((e) => e as String)
+          .toList(),
     );
 
 Map<String, dynamic> _$AppConfigToJson(AppConfig instance) => <String, dynamic>{
@@ -123,6 +296,47 @@ Map<String, dynamic> _$AppConfigToJson(AppConfig instance) => <String, dynamic>{
       'groqToken': instance.groqToken,
       'specMusicConfig': _specMusicConfigToJson(instance.specMusicConfig),
       'isDarkTheme': instance.isDarkTheme,
+      'modelPrefix': instance.modelPrefix,
+      'outputFilters': instance.outputFilters,
+      'connectTimeoutSeconds': instance.connectTimeoutSeconds,
+      'readTimeoutSeconds': instance.readTimeoutSeconds,
+      'modelsCacheTtlSeconds': instance.modelsCacheTtlSeconds,
+      'maxInputTokens': instance.maxInputTokens,
+      'completionsPath': instance.completionsPath,
+      'modelsPath': instance.modelsPath,
+      'favoriteModels': instance.favoriteModels,
+      'markdownFlavor': instance.markdownFlavor,
+      'extraBodyFields': instance.extraBodyFields,
+      'templateStorageMode': instance.templateStorageMode,
+      'templatesDirectory': instance.templatesDirectory,
+      'maxHistoryEntries': instance.maxHistoryEntries,
+      'maxHistoryAgeDays': instance.maxHistoryAgeDays,
+      'manualModels': instance.manualModels,
+      'uiLanguage': instance.uiLanguage,
+      'jsonSchema': instance.jsonSchema,
+      'templateProfile': instance.templateProfile,
+      'maxConcurrency': instance.maxConcurrency,
+      'streamIdleTimeoutSeconds': instance.streamIdleTimeoutSeconds,
+      'appendAcceptanceCriteria': instance.appendAcceptanceCriteria,
+      'insecureSkipVerify': instance.insecureSkipVerify,
+      'caCertPath': instance.caCertPath,
+      'redactPii': instance.redactPii,
+      'modelPricing': instance.modelPricing,
+      'costCurrency': instance.costCurrency,
+      'reasoningEffort': instance.reasoningEffort,
+      'dateFormat': instance.dateFormat,
+      'trimIncompleteEndings': instance.trimIncompleteEndings,
+      'emptyResponseRetries': instance.emptyResponseRetries,
+      'logitBias': instance.logitBias,
+      'healthPath': instance.healthPath,
+      'systemPromptOverrides': instance.systemPromptOverrides,
+      'templateTokenWarningThreshold': instance.templateTokenWarningThreshold,
+      'endpoints': instance.endpoints,
+      'activeEndpoint': instance.activeEndpoint,
+      'captureRawResponses': instance.captureRawResponses,
+      'endpointCapabilities': instance.endpointCapabilities,
+      'prependTableOfContents': instance.prependTableOfContents,
+      'deprecatedModels': instance.deprecatedModels,
     };
 
 const _$OutputFormatEnumMap = {
@@ -0,0 +1,73 @@
+import 'package:uuid/uuid.dart';
+import 'chat_message.dart';
+import 'output_format.dart';
+
+/// Диалог уточнения одного ТЗ: системный промт, ввод пользователя и ответы модели
+class Conversation {
+  final String id;
+  final String? templateId;
+  final String? model; // null — модель по умолчанию на момент запроса
+  final OutputFormat format;
+  final DateTime createdAt;
+  final DateTime updatedAt;
+  final List<ChatMessage> messages;
+
+  Conversation({
+    String? id,
+    this.templateId,
+    this.model,
+    this.format = OutputFormat.markdown,
+    required this.createdAt,
+    DateTime? updatedAt,
+    required this.messages,
+  })  : id = id ?? const Uuid().v4(),
+        updatedAt = updatedAt ?? createdAt;
+
+  /// Последний ответ модели или null, если ответов ещё нет
+  String? get lastAnswer {
+    for (final m in messages.reversed) {
+      if (m.role == 'assistant') return m.content;
+    }
+    return null;
+  }
+
+  Conversation copyWith({DateTime? updatedAt, List<ChatMessage>? messages}) {
+    return Conversation(
+      id: id,
+      templateId: templateId,
+      model: model,
+      format: format,
+      createdAt: createdAt,
+      updatedAt: updatedAt ?? this.updatedAt,
+      messages: messages ?? this.messages,
+    );
+  }
+
+  Map<String, dynamic> toJson() => {
+        'id': id,
+        'templateId': templateId,
+        'model': model,
+        'format': format.name,
+        'createdAt': createdAt.toIso8601String(),
+        'updatedAt': updatedAt.toIso8601String(),
+        'messages': messages.map((m) => m.toJson()).toList(),
+      };
+
+  factory Conversation.fromJson(Map<String, dynamic> json) {
+    return Conversation(
+      id: json['id'],
+      templateId: json['templateId'],
+      model: json['model'],
+      format: OutputFormat.values.firstWhere(
+        (f) => f.name == json['format'],
+        orElse: () => OutputFormat.defaultFormat,
+      ),
+      createdAt: DateTime.parse(json['createdAt']),
+      updatedAt: DateTime.tryParse(json['updatedAt'] ?? ''),
+      messages: (json['messages'] as List<dynamic>? ?? const [])
+          .whereType<Map<String, dynamic>>()
+          .map(ChatMessage.fromJson)
+          .toList(),
+    );
+  }
+}
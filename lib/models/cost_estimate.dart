@@ -0,0 +1,44 @@
+/// Цена модели за 1000 токенов
+class ModelPricing {
+  final double inputPer1K;
+  final double outputPer1K;
+
+  const ModelPricing({required this.inputPer1K, required this.outputPer1K});
+
+  /// Разбирает запись из [AppConfig.modelPricing]: {"input": 0.0025, "output": 0.01}
+  static ModelPricing? fromJson(dynamic json) {
+    if (json is! Map) return null;
+    final input = json['input'];
+    final output = json['output'];
+    if (input is! num || output is! num || input < 0 || output < 0) return null;
+    return ModelPricing(inputPer1K: input.toDouble(), outputPer1K: output.toDouble());
+  }
+
+  Map<String, dynamic> toJson() => {'input': inputPer1K, 'output': outputPer1K};
+}
+
+/// Оценка стоимости генерации с разбивкой по токенам
+class CostEstimate {
+  final String model;
+  final int inputTokens;
+  final int outputTokens;
+  final double inputCost;
+  final double outputCost;
+  final String currency;
+
+  const CostEstimate({
+    required this.model,
+    required this.inputTokens,
+    required this.outputTokens,
+    required this.inputCost,
+    required this.outputCost,
+    required this.currency,
+  });
+
+  double get total => inputCost + outputCost;
+
+  @override
+  String toString() =>
+      '${total.toStringAsFixed(4)} $currency (вход: $inputTokens ток. — ${inputCost.toStringAsFixed(4)}, '
+      'выход: $outputTokens ток. — ${outputCost.toStringAsFixed(4)})';
+}
@@ -0,0 +1,33 @@
+/// Возможности шлюза, выясненные пробными запросами при сохранении настроек.
+/// null в поле — проверить не удалось (таймаут, сетевая ошибка), считаем неизвестным.
+class EndpointCapabilities {
+  final String endpoint; // базовый URL, для которого выполнена проверка
+  final bool? streaming; // потоковая генерация (SSE)
+  final bool? jsonMode; // response_format: json_object
+  final bool? streamUsage; // usage в последнем чанке потока (stream_options.include_usage)
+  final DateTime probedAt;
+
+  const EndpointCapabilities({
+    required this.endpoint,
+    this.streaming,
+    this.jsonMode,
+    this.streamUsage,
+    required this.probedAt,
+  });
+
+  factory EndpointCapabilities.fromJson(Map<String, dynamic> json) => EndpointCapabilities(
+        endpoint: json['endpoint'] as String? ?? '',
+        streaming: json['streaming'] as bool?,
+        jsonMode: json['jsonMode'] as bool?,
+        streamUsage: json['streamUsage'] as bool?,
+        probedAt: DateTime.tryParse(json['probedAt'] as String? ?? '') ?? DateTime.fromMillisecondsSinceEpoch(0),
+      );
+
+  Map<String, dynamic> toJson() => {
+        'endpoint': endpoint,
+        'streaming': streaming,
+        'jsonMode': jsonMode,
+        'streamUsage': streamUsage,
+        'probedAt': probedAt.toIso8601String(),
+      };
+}
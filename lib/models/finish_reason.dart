@@ -0,0 +1,28 @@
+/// Причина завершения генерации (`finish_reason` OpenAI-совместимых API)
+enum FinishReason {
+  stop, // модель закончила ответ
+  length, // ответ обрезан по лимиту токенов
+  contentFilter, // ответ заблокирован фильтром безопасности
+  toolCalls, // модель запросила вызов инструмента
+  unknown;
+
+  static FinishReason parse(String? raw) {
+    switch (raw?.toLowerCase()) {
+      case 'stop':
+      case 'end_turn':
+      case 'eos':
+        return FinishReason.stop;
+      case 'length':
+      case 'max_tokens':
+        return FinishReason.length;
+      case 'content_filter':
+      case 'safety':
+        return FinishReason.contentFilter;
+      case 'tool_calls':
+      case 'function_call':
+        return FinishReason.toolCalls;
+      default:
+        return FinishReason.unknown;
+    }
+  }
+}
@@ -1,35 +1,50 @@
+import 'package:uuid/uuid.dart';
 import 'output_format.dart';
+import 'generation_metadata.dart';
 
 class GenerationHistory {
+  final String id;
   final String rawRequirements;
   final String? changes;
   final String generatedTz;
   final DateTime timestamp;
   final String model;
   final OutputFormat format;
+  final GenerationMetadata? metadata;
+  final bool partial; // генерация прервана — сохранено то, что успело прийти
+  final String? project; // проект для группировки результатов (null — без проекта)
   
   GenerationHistory({
+    String? id,
     required this.rawRequirements,
     this.changes,
     required this.generatedTz,
     required this.timestamp,
     required this.model,
     required this.format,
-  });
+    this.metadata,
+    this.partial = false,
+    this.project,
+  }) : id = id ?? const Uuid().v4();
   
   Map<String, dynamic> toJson() {
     return {
+      'id': id,
       'rawRequirements': rawRequirements,
       'changes': changes,
       'generatedTz': generatedTz,
       'timestamp': timestamp.toIso8601String(),
       'model': model,
       'format': format.name,
+      if (metadata != null) 'metadata': metadata!.toJson(),
+      'partial': partial,
+      if (project != null) 'project': project,
     };
   }
   
   factory GenerationHistory.fromJson(Map<String, dynamic> json) {
     return GenerationHistory(
+      id: json['id'], // null для записей до появления id — будет сгенерирован
       rawRequirements: json['rawRequirements'],
       changes: json['changes'],
       generatedTz: json['generatedTz'],
@@ -41,6 +56,11 @@ class GenerationHistory {
               orElse: () => OutputFormat.defaultFormat,
             )
           : OutputFormat.defaultFormat, // Default for legacy data
+      metadata: json['metadata'] is Map<String, dynamic>
+          ? GenerationMetadata.fromJson(json['metadata'])
+          : null,
+      partial: json['partial'] == true,
+      project: json['project'],
     );
   }
 }
@@ -0,0 +1,65 @@
+/// Метаданные генерации для аудита: сохраняются в истории и рядом
+/// с сохранённым документом (`<имя>.meta.json`).
+class GenerationMetadata {
+  final String historyId;
+  final String model;
+  final DateTime timestamp;
+  final String? templateId;
+  final String? templateName;
+  final double? temperature; // null — значение провайдера по умолчанию
+  final int? inputTokens; // оценка, если провайдер не вернул usage
+  final int? outputTokens;
+  final String userInput;
+  final String? changes;
+  final String? sourceHistoryId; // запись, из которой выполнена повторная генерация
+  final String? project;
+
+  const GenerationMetadata({
+    required this.historyId,
+    required this.model,
+    required this.timestamp,
+    this.templateId,
+    this.templateName,
+    this.temperature,
+    this.inputTokens,
+    this.outputTokens,
+    required this.userInput,
+    this.changes,
+    this.sourceHistoryId,
+    this.project,
+  });
+
+  Map<String, dynamic> toJson() {
+    return {
+      'historyId': historyId,
+      'model': model,
+      'timestamp': timestamp.toIso8601String(),
+      'templateId': templateId,
+      'templateName': templateName,
+      'temperature': temperature,
+      'inputTokens': inputTokens,
+      'outputTokens': outputTokens,
+      'userInput': userInput,
+      'changes': changes,
+      if (sourceHistoryId != null) 'sourceHistoryId': sourceHistoryId,
+      if (project != null) 'project': project,
+    };
+  }
+
+  factory GenerationMetadata.fromJson(Map<String, dynamic> json) {
+    return GenerationMetadata(
+      historyId: json['historyId'],
+      model: json['model'],
+      timestamp: DateTime.parse(json['timestamp']),
+      templateId: json['templateId'],
+      templateName: json['templateName'],
+      temperature: (json['temperature'] as num?)?.toDouble(),
+      inputTokens: (json['inputTokens'] as num?)?.toInt(),
+      outputTokens: (json['outputTokens'] as num?)?.toInt(),
+      userInput: json['userInput'] ?? '',
+      changes: json['changes'],
+      sourceHistoryId: json['sourceHistoryId'],
+      project: json['project'],
+    );
+  }
+}
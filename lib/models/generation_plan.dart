@@ -0,0 +1,16 @@
+/// Разбивка бюджета токенов перед генерацией (панель «Перед генерацией»)
+class GenerationPlan {
+  final String model;
+  final int promptTokens; // оценка системного и пользовательского промтов
+  final int? contextWindow; // null — модель отсутствует в таблице возможностей
+  final int? completionBudget; // сколько токенов остаётся на ответ
+  final bool overBudget;
+
+  const GenerationPlan({
+    required this.model,
+    required this.promptTokens,
+    this.contextWindow,
+    this.completionBudget,
+    required this.overBudget,
+  });
+}
@@ -0,0 +1,35 @@
+import 'finish_reason.dart';
+import 'token_usage.dart';
+
+/// Результат генерации: итоговое ТЗ и, отдельно, рассуждения модели
+/// (поле `reasoning` ответа или блоки `<think>`), если она их вернула.
+class GenerationResult {
+  final String content;
+  final String? reasoning;
+  final TokenUsage? usage; // расход этого запроса (из ответа или оценка)
+  final FinishReason? finishReason;
+
+  const GenerationResult({required this.content, this.reasoning, this.usage, this.finishReason});
+
+  bool get hasReasoning => reasoning != null && reasoning!.isNotEmpty;
+
+  /// Тот же результат с другим текстом документа (после постобработки)
+  GenerationResult withContent(String content) =>
+      GenerationResult(content: content, reasoning: reasoning, usage: usage, finishReason: finishReason);
+}
+
+/// Результат генерации с автопродолжением: документ, склеенный из всех частей,
+/// и суммарный расход токенов по всем запросам
+class CompleteGenerationResult {
+  final String content;
+  final TokenUsage usage;
+  final int continuations; // сколько запросов-продолжений понадобилось
+  final bool truncated; // лимит продолжений исчерпан, а ответ всё ещё обрезан
+
+  const CompleteGenerationResult({
+    required this.content,
+    required this.usage,
+    required this.continuations,
+    this.truncated = false,
+  });
+}
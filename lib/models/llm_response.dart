@@ -0,0 +1,13 @@
+import 'finish_reason.dart';
+import 'token_usage.dart';
+
+/// Ответ провайдера на один запрос вместе с его метаданными.
+/// В отличие от [LLMProvider.lastFinishReason], не зависит от других запросов,
+/// выполняющихся параллельно через тот же провайдер.
+class LLMResponse {
+  final String content;
+  final TokenUsage? usage; // null — провайдер не вернул usage
+  final FinishReason? finishReason; // null — провайдер не сообщает finish_reason
+
+  const LLMResponse({required this.content, this.usage, this.finishReason});
+}
@@ -21,3 +21,10 @@ class LLMStreamChunkError extends LLMStreamChunk {
   final String message;
   const LLMStreamChunkError(this.message);
 }
+
+/// The provider sent nothing for the configured idle interval; the request was
+/// cancelled. Content received before the stall is kept by the consumer.
+class LLMStreamChunkIdleTimeout extends LLMStreamChunkError {
+  final Duration idle;
+  const LLMStreamChunkIdleTimeout(super.message, this.idle);
+}
@@ -0,0 +1,22 @@
+/// Результат генерации одного и того же ТЗ конкретной моделью
+class ModelComparison {
+  final String model;
+  final String? output;
+  final String? error; // ошибка этой модели не прерывает сравнение
+  final Duration latency;
+  final int? inputTokens; // из usage ответа или оценка, см. [estimated]
+  final int? outputTokens;
+  final bool estimated; // true — провайдер не вернул usage, токены оценены
+
+  const ModelComparison({
+    required this.model,
+    this.output,
+    this.error,
+    required this.latency,
+    this.inputTokens,
+    this.outputTokens,
+    this.estimated = false,
+  });
+
+  bool get isSuccess => output != null;
+}
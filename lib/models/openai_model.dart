@@ -9,15 +9,37 @@ class OpenAIModel {
   final int created;
   @JsonKey(name: 'owned_by')
   final String ownedBy;
+  // Дополнительные поля ответа /models/{id} (context_length, pricing и т.п.)
+  @JsonKey(includeFromJson: false, includeToJson: false)
+  final Map<String, dynamic> extra;
   
   OpenAIModel({
     required this.id,
     required this.object,
     required this.created,
     required this.ownedBy,
+    this.extra = const {},
   });
   
   factory OpenAIModel.fromJson(Map<String, dynamic> json) => _$OpenAIModelFromJson(json);
+
+  static const Set<String> _standardFields = {'id', 'object', 'created', 'owned_by'};
+
+  /// Разбирает ответ /models/{id}: шлюзы часто опускают стандартные поля,
+  /// а нестандартные сохраняются в [extra]
+  factory OpenAIModel.fromDetails(Map<String, dynamic> json) {
+    final created = json['created'];
+    return OpenAIModel(
+      id: '${json['id'] ?? ''}',
+      object: json['object'] is String ? json['object'] as String : 'model',
+      created: created is num ? created.toInt() : 0,
+      ownedBy: json['owned_by'] is String ? json['owned_by'] as String : '',
+      extra: {
+        for (final entry in json.entries)
+          if (!_standardFields.contains(entry.key)) entry.key: entry.value,
+      },
+    );
+  }
   Map<String, dynamic> toJson() => _$OpenAIModelToJson(this);
 }
 
@@ -0,0 +1,44 @@
+/// Проверка одного элемента пакета перед запуском
+class PreflightItem {
+  final int index; // позиция во входном списке
+  final int promptTokens; // оценка промта
+  final int? contextWindow; // null — модель отсутствует в таблице возможностей
+  final bool overBudget; // промт не оставляет места для ответа
+  final String? error; // ввод не пройдёт проверку (пустой, слишком короткий и т.п.)
+
+  const PreflightItem({
+    required this.index,
+    required this.promptTokens,
+    this.contextWindow,
+    required this.overBudget,
+    this.error,
+  });
+
+  bool get isReady => !overBudget && error == null;
+}
+
+/// Итог проверки пакета без запросов генерации (выполняется только запрос списка моделей)
+class PreflightReport {
+  final String? model;
+  final List<String> problems; // проблемы настройки, модели и шаблона
+  final bool modelAvailable;
+  final bool templateFound;
+  final List<PreflightItem> items;
+
+  const PreflightReport({
+    required this.model,
+    required this.problems,
+    required this.modelAvailable,
+    required this.templateFound,
+    required this.items,
+  });
+
+  /// Индексы элементов, которые превысят контекстное окно
+  List<int> get overBudgetIndexes => [for (final i in items) if (i.overBudget) i.index];
+
+  /// Индексы элементов, которые не пройдут проверку ввода
+  List<int> get invalidIndexes => [for (final i in items) if (i.error != null) i.index];
+
+  /// Пакет можно запускать: нет проблем настройки и все элементы проходят проверку
+  bool get isReady => problems.isEmpty && items.every((i) => i.isReady);
+}
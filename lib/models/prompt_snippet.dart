@@ -0,0 +1,36 @@
+import 'package:uuid/uuid.dart';
+
+/// Переиспользуемый фрагмент инструкции для системного промта
+/// (например, «пиши кратко», «добавь критерии приёмки»).
+class PromptSnippet {
+  final String id;
+  final String name;
+  final String content;
+  final DateTime createdAt;
+
+  PromptSnippet({
+    String? id,
+    required this.name,
+    required this.content,
+    DateTime? createdAt,
+  })  : id = id ?? const Uuid().v4(),
+        createdAt = createdAt ?? DateTime.now();
+
+  Map<String, dynamic> toJson() {
+    return {
+      'id': id,
+      'name': name,
+      'content': content,
+      'createdAt': createdAt.toIso8601String(),
+    };
+  }
+
+  factory PromptSnippet.fromJson(Map<String, dynamic> json) {
+    return PromptSnippet(
+      id: json['id'],
+      name: json['name'] ?? '',
+      content: json['content'] ?? '',
+      createdAt: json['createdAt'] != null ? DateTime.tryParse(json['createdAt']) : null,
+    );
+  }
+}
@@ -0,0 +1,84 @@
+/// Состояние лимитов запросов по заголовкам `x-ratelimit-*` OpenAI-совместимых API
+class RateLimitStatus {
+  final int? limitRequests;
+  final int? remainingRequests;
+  final Duration? resetRequests;
+  final int? limitTokens;
+  final int? remainingTokens;
+  final Duration? resetTokens;
+  final DateTime updatedAt;
+
+  const RateLimitStatus({
+    this.limitRequests,
+    this.remainingRequests,
+    this.resetRequests,
+    this.limitTokens,
+    this.remainingTokens,
+    this.resetTokens,
+    required this.updatedAt,
+  });
+
+  /// Разбирает заголовки ответа; null, если шлюз не присылает ни одного из них
+  static RateLimitStatus? fromHeaders(String? Function(String name) header) {
+    int? intHeader(String name) => int.tryParse(header(name)?.trim() ?? '');
+    Duration? durationHeader(String name) => parseResetDuration(header(name));
+
+    final status = RateLimitStatus(
+      limitRequests: intHeader('x-ratelimit-limit-requests'),
+      remainingRequests: intHeader('x-ratelimit-remaining-requests'),
+      resetRequests: durationHeader('x-ratelimit-reset-requests'),
+      limitTokens: intHeader('x-ratelimit-limit-tokens'),
+      remainingTokens: intHeader('x-ratelimit-remaining-tokens'),
+      resetTokens: durationHeader('x-ratelimit-reset-tokens'),
+      updatedAt: DateTime.now(),
+    );
+    final empty = status.limitRequests == null &&
+        status.remainingRequests == null &&
+        status.resetRequests == null &&
+        status.limitTokens == null &&
+        status.remainingTokens == null &&
+        status.resetTokens == null;
+    return empty ? null : status;
+  }
+
+  /// "12s", "1m30s", "6ms", "0.5s" → Duration
+  static Duration? parseResetDuration(String? value) {
+    if (value == null || value.trim().isEmpty) return null;
+    final v = value.trim();
+    final plain = double.tryParse(v);
+    if (plain != null) return Duration(milliseconds: (plain * 1000).round());
+
+    final parts = RegExp(r'(\d+(?:\.\d+)?)(ms|h|m|s)').allMatches(v).toList();
+    if (parts.isEmpty) return null;
+    var ms = 0.0;
+    for (final p in parts) {
+      final n = double.parse(p.group(1)!);
+      switch (p.group(2)) {
+        case 'h':
+          ms += n * 3600000;
+          break;
+        case 'm':
+          ms += n * 60000;
+          break;
+        case 's':
+          ms += n * 1000;
+          break;
+        case 'ms':
+          ms += n;
+          break;
+      }
+    }
+    return Duration(milliseconds: ms.round());
+  }
+
+  @override
+  String toString() {
+    final parts = <String>[];
+    if (remainingRequests != null) {
+      final reset = resetRequests != null ? ', сброс через ${resetRequests!.inSeconds} с' : '';
+      parts.add('осталось запросов: $remainingRequests$reset');
+    }
+    if (remainingTokens != null) parts.add('осталось токенов: $remainingTokens');
+    return parts.isEmpty ? 'нет данных о лимитах' : parts.join('; ');
+  }
+}
@@ -39,6 +39,21 @@ class Template {
   @HiveField(6)
   @JsonKey(name: 'format')
   final TemplateFormat format; // Deprecated: always treated as markdown
+
+  @HiveField(7)
+  final String? preferredModel; // модель, закреплённая за шаблоном (null — модель по умолчанию)
+
+  @HiveField(8)
+  final String? category; // категория для группировки в списке (null — без категории)
+
+  @HiveField(9, defaultValue: false)
+  final bool locked; // шаблон команды только для чтения: правка, переименование и удаление запрещены
+
+  @HiveField(10)
+  final List<String>? sectionOrder; // порядок генерации разделов (заголовки); в документе порядок шаблона сохраняется
+
+  @HiveField(11)
+  final double? temperature; // температура генерации по шаблону (null — значение провайдера по умолчанию)
   
   Template({
     required this.id,
@@ -48,19 +63,31 @@ class Template {
     required this.createdAt,
     this.updatedAt,
   required this.format,
+    this.preferredModel,
+    this.category,
+    this.locked = false,
+    this.sectionOrder,
+    this.temperature,
   });
   
   factory Template.fromJson(Map<String, dynamic> json) => _$TemplateFromJson(json);
   Map<String, dynamic> toJson() => _$TemplateToJson(this);
   
+  /// Копия шаблона с изменёнными полями. Необязательные поля (updatedAt, preferredModel,
+  /// category, sectionOrder, temperature) сбрасываются явной передачей null.
   Template copyWith({
     String? id,
     String? name,
     String? content,
     bool? isDefault,
     DateTime? createdAt,
-    DateTime? updatedAt,
+    Object? updatedAt = _sentinel,
   TemplateFormat? format,
+    Object? preferredModel = _sentinel,
+    Object? category = _sentinel,
+    bool? locked,
+    Object? sectionOrder = _sentinel,
+    Object? temperature = _sentinel,
   }) {
     return Template(
       id: id ?? this.id,
@@ -68,8 +95,13 @@ class Template {
       content: content ?? this.content,
       isDefault: isDefault ?? this.isDefault,
       createdAt: createdAt ?? this.createdAt,
-      updatedAt: updatedAt ?? this.updatedAt,
+      updatedAt: updatedAt == _sentinel ? this.updatedAt : updatedAt as DateTime?,
   format: format ?? this.format,
+      preferredModel: preferredModel == _sentinel ? this.preferredModel : preferredModel as String?,
+      category: category == _sentinel ? this.category : category as String?,
+      locked: locked ?? this.locked,
+      sectionOrder: sectionOrder == _sentinel ? this.sectionOrder : sectionOrder as List<String>?,
+      temperature: temperature == _sentinel ? this.temperature : temperature as double?,
     );
   }
   
@@ -89,3 +121,6 @@ class Template {
   return 'Template{id: $id, name: $name, isDefault: $isDefault}';
   }
 }
+
+// Sentinel object to distinguish between null and not provided
+const Object _sentinel = Object();
@@ -0,0 +1,14 @@
+/// Сводка по шаблонам для панели «Хранилище» в настройках
+class TemplateStats {
+  final int total;
+  final int user; // созданные пользователем
+  final int defaults; // шаблон по умолчанию (из ресурсов приложения)
+  final int storageBytes; // размер файла хранилища шаблонов
+
+  const TemplateStats({
+    required this.total,
+    required this.user,
+    required this.defaults,
+    required this.storageBytes,
+  });
+}
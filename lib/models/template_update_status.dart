@@ -0,0 +1,7 @@
+/// Результат массового изменения шаблонов для одного id
+enum TemplateUpdateStatus {
+  changed, // шаблон изменён и сохранён
+  unchanged, // значение уже было таким
+  skipped, // встроенный шаблон — изменять нельзя
+  notFound,
+}
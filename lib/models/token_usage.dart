@@ -0,0 +1,45 @@
+/// Расход токенов одного запроса (поле `usage` ответа или оценка)
+class TokenUsage {
+  final int inputTokens;
+  final int outputTokens;
+  final bool estimated; // true — провайдер не вернул usage, значения оценены
+
+  const TokenUsage({
+    required this.inputTokens,
+    required this.outputTokens,
+    this.estimated = false,
+  });
+
+  int get totalTokens => inputTokens + outputTokens;
+
+  /// Разбирает `usage` OpenAI-совместимого ответа; null, если поля нет
+  static TokenUsage? fromResponse(dynamic data) {
+    if (data is! Map || data['usage'] is! Map) return null;
+    final usage = data['usage'] as Map;
+    final input = usage['prompt_tokens'];
+    final output = usage['completion_tokens'];
+    if (input is! num || output is! num) return null;
+    return TokenUsage(inputTokens: input.toInt(), outputTokens: output.toInt());
+  }
+}
+
+/// Суммарный расход за сессию работы приложения (с момента запуска или сброса)
+class SessionUsage {
+  final int generations;
+  final int inputTokens;
+  final int outputTokens;
+  final Map<String, double> costByCurrency; // стоимость по валютам цен
+  final int unpricedGenerations; // генерации моделями без известной цены
+  final DateTime since;
+
+  const SessionUsage({
+    required this.generations,
+    required this.inputTokens,
+    required this.outputTokens,
+    required this.costByCurrency,
+    required this.unpricedGenerations,
+    required this.since,
+  });
+
+  int get totalTokens => inputTokens + outputTokens;
+}
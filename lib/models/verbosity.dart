@@ -0,0 +1,27 @@
+/// Степень детализации ТЗ: один шаблон даёт быстрый черновик или подробный документ
+enum Verbosity {
+  brief,
+  normal,
+  detailed;
+
+  /// Инструкция для системного промта; для [normal] — null (промт не меняется)
+  String? get promptInstruction {
+    switch (this) {
+      case Verbosity.brief:
+        return 'Пиши кратко: только разделы шаблона без вложенных подразделов, '
+            '2–4 пункта или предложения на раздел, без пояснений и примеров.';
+      case Verbosity.normal:
+        return null;
+      case Verbosity.detailed:
+        return 'Пиши максимально подробно: раскрывай каждый раздел подразделами, '
+            'описывай альтернативные и ошибочные сценарии, ограничения, примеры данных и граничные случаи.';
+    }
+  }
+
+  static Verbosity parse(String? value) {
+    return Verbosity.values.firstWhere(
+      (v) => v.name == value?.trim().toLowerCase(),
+      orElse: () => Verbosity.normal,
+    );
+  }
+}
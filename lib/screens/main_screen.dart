@@ -1,6 +1,7 @@
 import 'package:flutter/material.dart';
 import 'package:flutter/services.dart';
 import 'package:provider/provider.dart';
+import 'package:uuid/uuid.dart';
 import '../models/output_format.dart';
 import '../services/config_service.dart';
 import '../services/llm_service.dart';
@@ -10,7 +11,10 @@ import '../widgets/main_screen/stream_result_panel.dart';
 import '../services/template_service.dart';
 import '../services/file_service.dart';
 import '../services/confluence_session_manager.dart';
+import '../services/error_log_service.dart';
+import '../services/history_service.dart';
 import '../models/generation_history.dart';
+import '../models/generation_metadata.dart';
 import '../widgets/main_screen/main_screen_widgets.dart';
 import '../widgets/main_screen/confluence_publish_modal.dart';
 import '../widgets/main_screen/integration_indicators.dart';
@@ -51,10 +55,14 @@ class MainScreen extends StatefulWidget {
 class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
   final _rawRequirementsController = TextEditingController();
   final _changesController = TextEditingController();
+  final _projectController = TextEditingController();
   
   String _generatedTz = '';
   String _originalContent = '';
-  final List<GenerationHistory> _history = [];
+  String? _currentHistoryId; // запись истории, соответствующая показанному документу
+  String? _runTemplateId; // шаблон текущей генерации (для метаданных)
+  String? _runTemplateName;
+  String? _runProject;
   // Streaming replaces legacy generating flag; legacy field removed
   late StreamingSessionController _streamController;
   StreamingLLMService? _streamService;
@@ -73,6 +81,10 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
     WidgetsBinding.instance.addPostFrameCallback((_) {
       if (mounted) {
         _loadModels();
+        final config = Provider.of<ConfigService>(context, listen: false).config;
+        Provider.of<HistoryService>(context, listen: false)
+          ..configureRetention(maxEntries: config?.maxHistoryEntries, maxAgeDays: config?.maxHistoryAgeDays)
+          ..prune();
       }
     });
   // Streaming controller will be initialized after models/config available
@@ -100,6 +112,7 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
     
     _rawRequirementsController.dispose();
     _changesController.dispose();
+    _projectController.dispose();
   _streamController.dispose();
   super.dispose();
   }
@@ -132,11 +145,15 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
       // Инициализируем провайдера
       llmService.initializeProvider(configService.config!);
       
-      // Загружаем модели
+      // Загружаем модели и проверяем, что сохранённая модель ещё доступна
+      // (баннер в ModelSettingsCard предложит выбрать другую)
       try {
-        await llmService.getModels();
+        if (!await llmService.isSelectedModelAvailable()) {
+          ErrorLogService().record('models', 'Выбранная модель "${configService.config!.defaultModel ?? ''}" недоступна у провайдера');
+        }
       } catch (e) {
         print('Ошибка при загрузке моделей: $e');
+        ErrorLogService().record('models', e);
       }
       
       // Инициализируем шаблоны, если они еще не инициализированы
@@ -145,6 +162,7 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
           await templateService.init();
         } catch (e) {
           print('Ошибка при инициализации шаблонов: $e');
+          ErrorLogService().record('templates', e);
         }
       }
     }
@@ -162,6 +180,20 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
       return;
     }
     final activeTemplate = await templateService.getActiveTemplate(configService.config!.outputFormat);
+    _runTemplateId = activeTemplate?.id;
+    _runTemplateName = activeTemplate?.name;
+    final project = _projectController.text.trim();
+    _runProject = project.isEmpty ? null : project;
+    String? templateContent;
+    if (activeTemplate != null) {
+      try {
+        // Раскрываем {{include:id}} — общие фрагменты подставляются до отправки модели
+        templateContent = await templateService.resolveTemplate(activeTemplate.id);
+      } catch (e) {
+        setState(() { _errorMessage = 'Ошибка подготовки шаблона: $e'; });
+        return;
+      }
+    }
     _streamService ??= StreamingLLMService(
       llmService: Provider.of<LLMService>(context, listen: false),
     );
@@ -170,7 +202,7 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
     await _streamController.start(
       rawRequirements: _rawRequirementsController.text,
       changes: _changesController.text.isNotEmpty ? _changesController.text : null,
-      templateContent: activeTemplate?.content,
+      templateContent: templateContent,
       format: _selectedFormat,
     );
   }
@@ -178,16 +210,41 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
   void _handleStreamFinalized(StreamingState state) {
     final configService = Provider.of<ConfigService>(context, listen: false);
     if (state.document.trim().isEmpty) return;
-    setState(() {
-      _history.insert(0, GenerationHistory(
-        rawRequirements: _rawRequirementsController.text,
-        changes: _changesController.text.isNotEmpty ? _changesController.text : null,
-        generatedTz: state.document,
-        timestamp: DateTime.now(),
-        model: configService.config?.defaultModel ?? 'unknown',
-        format: _selectedFormat,
-      ));
-    });
+    final rawRequirements = _rawRequirementsController.text;
+    final changes = _changesController.text.isNotEmpty ? _changesController.text : null;
+    final model = configService.config?.defaultModel ?? 'unknown';
+    final timestamp = DateTime.now();
+    final id = const Uuid().v4();
+    final estimator = Provider.of<LLMService>(context, listen: false).tokenEstimator;
+    final entry = GenerationHistory(
+      id: id,
+      rawRequirements: rawRequirements,
+      changes: changes,
+      generatedTz: state.document,
+      timestamp: timestamp,
+      model: model,
+      format: _selectedFormat,
+      partial: state.aborted, // отменённую генерацию можно восстановить из истории
+      project: _runProject,
+      metadata: GenerationMetadata(
+        historyId: id,
+        model: model,
+        timestamp: timestamp,
+        templateId: _runTemplateId,
+        templateName: _runTemplateName,
+        inputTokens: estimator.estimate(rawRequirements, model: model) +
+            estimator.estimate(changes ?? '', model: model),
+        outputTokens: estimator.estimate(state.document, model: model),
+        userInput: rawRequirements,
+        changes: changes,
+        project: _runProject,
+      ),
+    );
+    _currentHistoryId = id;
+    final config = Provider.of<ConfigService>(context, listen: false).config;
+    Provider.of<HistoryService>(context, listen: false)
+      ..configureRetention(maxEntries: config?.maxHistoryEntries, maxAgeDays: config?.maxHistoryAgeDays)
+      ..add(entry);
   }
   
   Future<void> _saveFile() async {
@@ -195,9 +252,13 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
     
     try {
       // Use the enhanced file service with format-specific handling and validation
+      final historyId = _currentHistoryId;
       final filePath = await FileService.saveFileWithFormat(
         content: _originalContent,
         format: _selectedFormat,
+        metadata: historyId != null
+            ? await Provider.of<HistoryService>(context, listen: false).getGenerationMetadata(historyId)
+            : null,
       );
       
       if (filePath != null) {
@@ -238,9 +299,10 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
       _changesController.clear();
       _generatedTz = '';
       _originalContent = '';
-      _history.clear();
+      _currentHistoryId = null;
       _errorMessage = null;
     });
+    Provider.of<HistoryService>(context, listen: false).clear();
   }
 
   void _copyToClipboard() {
@@ -591,8 +653,9 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
                           return InputPanel(
                             rawRequirementsController: _rawRequirementsController,
                             changesController: _changesController,
+                            projectController: _projectController,
                             generatedTz: sc.state.document, // for visibility of changes textarea
-                            history: _history,
+                            history: Provider.of<HistoryService>(context).entries,
                             isGenerating: sc.isActive,
                             errorMessage: _errorMessage,
                             onGenerate: _startStreamingGeneration,
@@ -605,6 +668,7 @@ class MainScreenState extends State<MainScreen> with WidgetsBindingObserver {
                               _generatedTz = historyItem.generatedTz;
                               _originalContent = historyItem.generatedTz;
                               _selectedFormat = historyItem.format;
+                              _currentHistoryId = historyItem.id;
                               sc.loadStaticDocument(historyItem.generatedTz);
                             },
                           );
@@ -1,3 +1,4 @@
+import 'dart:async';
 import 'package:flutter/material.dart';
 import 'package:flutter/services.dart';
 import 'package:provider/provider.dart';
@@ -6,6 +7,7 @@ import '../services/template_service.dart';
 import '../services/config_service.dart';
 import '../services/llm_service.dart';
 import '../services/theme_service.dart';
+import '../services/error_log_service.dart';
 import '../models/app_config.dart';
 import '../models/openai_model.dart';
 import '../models/output_format.dart';
@@ -24,6 +26,7 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
   final _formKey = GlobalKey<FormState>();
   final _urlController = TextEditingController(text: 'https://api.openai.com/v1');
   final _tokenController = TextEditingController();
+  final _modelPrefixController = TextEditingController();
   final _llmopsUrlController = TextEditingController(text: 'http://localhost:11434');
   final _llmopsAuthController = TextEditingController();
   final _cerebrasTokenController = TextEditingController();
@@ -91,6 +94,7 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
     _startPulseController?.dispose();
     _urlController.dispose();
     _tokenController.dispose();
+    _modelPrefixController.dispose();
     _llmopsUrlController.dispose();
     _llmopsAuthController.dispose();
     _cerebrasTokenController.dispose();
@@ -128,6 +132,7 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
         if (_selectedProvider == 'openai') {
           _urlController.text = config.apiUrl;
           _tokenController.text = config.apiToken;
+          _modelPrefixController.text = config.modelPrefix ?? '';
         } else if (_selectedProvider == 'llmops') {
           _llmopsUrlController.text = config.llmopsBaseUrl ?? 'http://localhost:11434';
           _llmopsAuthController.text = config.llmopsAuthHeader ?? '';
@@ -177,6 +182,9 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
           provider: 'openai',
           defaultModel: 'gpt-3.5-turbo',
           reviewModel: 'gpt-3.5-turbo',
+          modelPrefix: _modelPrefixController.text.trim().isEmpty
+              ? null
+              : _modelPrefixController.text.trim(),
         );
       } else if (_selectedProvider == 'cerebras') {
         testConfig = AppConfig(
@@ -251,7 +259,7 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
           default:
             errorMsg = 'Не удалось подключиться к OpenAI API';
         }
-        throw Exception(llmService.error ?? errorMsg);
+        throw Exception(llmService.connectionErrorMessage ?? errorMsg);
       }
   } catch (e) {
       setState(() {
@@ -465,6 +473,53 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
     }
   }
 
+  // Расширенные настройки не редактируются на этом экране — переносим их из текущей конфигурации
+  AppConfig _withAdvancedSettings(AppConfig config, AppConfig? existing) {
+    if (existing == null) return config;
+    return config.copyWith(
+      outputFilters: existing.outputFilters,
+      connectTimeoutSeconds: existing.connectTimeoutSeconds,
+      readTimeoutSeconds: existing.readTimeoutSeconds,
+      modelsCacheTtlSeconds: existing.modelsCacheTtlSeconds,
+      maxInputTokens: existing.maxInputTokens,
+      completionsPath: existing.completionsPath,
+      modelsPath: existing.modelsPath,
+      favoriteModels: existing.favoriteModels,
+      markdownFlavor: existing.markdownFlavor,
+      extraBodyFields: existing.extraBodyFields,
+      templateStorageMode: existing.templateStorageMode,
+      templatesDirectory: existing.templatesDirectory,
+      maxHistoryEntries: existing.maxHistoryEntries,
+      maxHistoryAgeDays: existing.maxHistoryAgeDays,
+      manualModels: existing.manualModels,
+      uiLanguage: existing.uiLanguage,
+      jsonSchema: existing.jsonSchema,
+      templateProfile: existing.templateProfile,
+      maxConcurrency: existing.maxConcurrency,
+      streamIdleTimeoutSeconds: existing.streamIdleTimeoutSeconds,
+      appendAcceptanceCriteria: existing.appendAcceptanceCriteria,
+      insecureSkipVerify: existing.insecureSkipVerify,
+      caCertPath: existing.caCertPath,
+      redactPii: existing.redactPii,
+      modelPricing: existing.modelPricing,
+      costCurrency: existing.costCurrency,
+      reasoningEffort: existing.reasoningEffort,
+      dateFormat: existing.dateFormat,
+      trimIncompleteEndings: existing.trimIncompleteEndings,
+      emptyResponseRetries: existing.emptyResponseRetries,
+      logitBias: existing.logitBias,
+      healthPath: existing.healthPath,
+      systemPromptOverrides: existing.systemPromptOverrides,
+      templateTokenWarningThreshold: existing.templateTokenWarningThreshold,
+      endpoints: existing.endpoints,
+      activeEndpoint: existing.activeEndpoint,
+      captureRawResponses: existing.captureRawResponses,
+      endpointCapabilities: existing.endpointCapabilities,
+      prependTableOfContents: existing.prependTableOfContents,
+      deprecatedModels: existing.deprecatedModels,
+    ).withoutStaleEndpoint(); // на экране могли ввести другой URL — выбранное окружение уже не актуально
+  }
+
   // Методы действий
   Future<void> _saveConfig() async {
     if (!_formKey.currentState!.validate()) return;
@@ -502,6 +557,9 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
           provider: 'openai',
           defaultModel: modelToUse,
           reviewModel: modelToUse,
+          modelPrefix: _modelPrefixController.text.trim().isEmpty
+              ? null
+              : _modelPrefixController.text.trim(),
           selectedTemplateId: existingConfig?.selectedTemplateId,
           outputFormat: _selectedFormat,
           confluenceConfig: existingConfig?.confluenceConfig,
@@ -557,13 +615,17 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
         );
       }
 
-      await configService.saveConfig(config);
+      await configService.saveConfig(_withAdvancedSettings(config, existingConfig));
+      unawaited(_probeEndpointCapabilities(configService));
 
       if (!mounted) return;
+      final warnings = configService.configWarnings;
       ScaffoldMessenger.of(context).showSnackBar(
-        const SnackBar(
-          content: Text('Конфигурация успешно сохранена'),
-          backgroundColor: Colors.green,
+        SnackBar(
+          content: Text(warnings.isEmpty
+              ? 'Конфигурация успешно сохранена'
+              : 'Конфигурация сохранена. ${warnings.join('\n')}'),
+          backgroundColor: warnings.isEmpty ? Colors.green : Colors.orange,
         ),
       );
 
@@ -581,6 +643,22 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
     }
   }
 
+  // Проверка возможностей шлюза после сохранения: в фоне, сохранение от неё не зависит
+  Future<void> _probeEndpointCapabilities(ConfigService configService) async {
+    final saved = configService.config;
+    if (saved == null) return;
+    final llmService = Provider.of<LLMService>(context, listen: false);
+    try {
+      final caps = await llmService.probeEndpointCapabilities(saved);
+      final current = configService.config;
+      // Пока шла проверка, шлюз могли сменить — результат к нему не относится
+      if (caps == null || current == null || current.apiUrl.trim() != caps.endpoint) return;
+      await configService.saveConfig(current.copyWith(endpointCapabilities: caps.toJson()));
+    } catch (e) {
+      ErrorLogService().record('capabilities', e);
+    }
+  }
+
   Future<void> _clearConfig() async {
     final confirmed = await _showClearConfirmation();
     if (!confirmed) return;
@@ -595,6 +673,7 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
       setState(() {
         _urlController.text = 'https://api.openai.com/v1';
         _tokenController.text = '';
+        _modelPrefixController.text = '';
         _llmopsUrlController.text = 'http://localhost:11434';
         _llmopsAuthController.text = '';
         _cerebrasTokenController.text = '';
@@ -857,6 +936,17 @@ class _SetupScreenState extends State<SetupScreen> with SingleTickerProviderStat
                     return null;
                   },
                 ),
+                const SizedBox(height: 16),
+
+                // Префикс модели (для шлюзов OpenRouter-типа)
+                TextFormField(
+                  controller: _modelPrefixController,
+                  decoration: const InputDecoration(
+                    labelText: 'Префикс модели (необязательно)',
+                    hintText: 'openai/',
+                    helperText: 'Добавляется к ID модели в запросе, например openai/gpt-4o',
+                  ),
+                ),
               ],
               
               // Настройки LLMOps
@@ -219,7 +219,12 @@ class _TemplateManagementScreenState extends State<TemplateManagementScreen> {
         });
       }
       
-      _showSuccess('Шаблон сохранен успешно');
+      final warnings = templateService.lastSaveWarnings;
+      if (warnings.isEmpty) {
+        _showSuccess('Шаблон сохранен успешно');
+      } else {
+        _showWarning('Шаблон сохранен. ${warnings.join('\n')}');
+      }
       
     } catch (e) {
       _showError('Ошибка при сохранении шаблона: $e');
@@ -346,6 +351,16 @@ class _TemplateManagementScreenState extends State<TemplateManagementScreen> {
     );
   }
   
+  void _showWarning(String message) {
+    ScaffoldMessenger.of(context).showSnackBar(
+      SnackBar(
+        content: Text(message),
+        backgroundColor: Colors.orange,
+        duration: const Duration(seconds: 6),
+      ),
+    );
+  }
+
   void _showSuccess(String message) {
     ScaffoldMessenger.of(context).showSnackBar(
       SnackBar(
@@ -362,7 +377,7 @@ class _TemplateManagementScreenState extends State<TemplateManagementScreen> {
         title: const Text('Управление шаблонами ТЗ'),
         backgroundColor: Theme.of(context).colorScheme.inversePrimary,
         actions: [
-          if (_selectedTemplate != null && !_selectedTemplate!.isDefault)
+          if (_selectedTemplate != null && !_selectedTemplate!.isDefault && !_selectedTemplate!.locked)
             IconButton(
               icon: const Icon(Icons.delete),
               onPressed: _isLoading ? null : _deleteTemplate,
@@ -0,0 +1,248 @@
+import 'dart:async';
+import 'package:dio/dio.dart' show CancelToken;
+import 'package:flutter/foundation.dart';
+import '../exceptions/content_processing_exceptions.dart';
+import '../models/output_format.dart';
+import '../models/preflight_report.dart';
+import 'llm_service.dart';
+import 'error_log_service.dart';
+import 'template_service.dart';
+
+/// Результат генерации одного элемента пакета
+class BatchItemResult {
+  final int index; // позиция во входном списке
+  final String input;
+  final String? output;
+  final String? error;
+
+  const BatchItemResult({
+    required this.index,
+    required this.input,
+    this.output,
+    this.error,
+  });
+
+  bool get isSuccess => output != null;
+}
+
+/// Прогресс пакета (событие `batch:progress`): сколько элементов завершено
+/// и какой элемент сейчас взят в работу или только что завершён
+class BatchProgressEvent {
+  final int completed;
+  final int total;
+  final int currentIndex;
+  final String currentInput;
+
+  const BatchProgressEvent({
+    required this.completed,
+    required this.total,
+    required this.currentIndex,
+    required this.currentInput,
+  });
+
+  double get fraction => total == 0 ? 1.0 : completed / total;
+}
+
+/// Пакетная генерация ТЗ по нескольким наборам требований с ограничением
+/// параллельности и возможностью прервать пакет целиком.
+class BatchGenerationService extends ChangeNotifier {
+  final LLMService _llmService;
+  final TemplateService? _templateService; // нужен только для preflightBatch
+
+  BatchGenerationService({required LLMService llmService, TemplateService? templateService})
+      : _llmService = llmService,
+        _templateService = templateService;
+
+  final List<BatchItemResult> _results = [];
+  Completer<List<BatchItemResult>>? _running;
+  bool _cancelled = false;
+  int _generation = 0; // номер пакета: ответы отменённого пакета отбрасываются
+  CancelToken? _cancelToken; // прерывает HTTP-запросы текущего пакета
+
+  // События публикуются из воркеров одного изолята: гонок между ними нет,
+  // а отменённый пакет событий больше не отправляет
+  final StreamController<BatchProgressEvent> _progress = StreamController<BatchProgressEvent>.broadcast();
+  final StreamController<BatchItemResult> _itemDone = StreamController<BatchItemResult>.broadcast();
+
+  /// Поток прогресса пакета (`batch:progress`) — для индикатора выполнения
+  Stream<BatchProgressEvent> get progress => _progress.stream;
+
+  /// Результат каждого элемента сразу по завершении (`batch:item-done`)
+  Stream<BatchItemResult> get itemDone => _itemDone.stream;
+
+  bool get isRunning => _running != null;
+
+  /// Результаты, собранные к текущему моменту (в порядке завершения)
+  List<BatchItemResult> get results => List.unmodifiable(_results);
+
+  /// Запускает пакет. Возвращает результаты всех элементов или, если пакет
+  /// отменён через [cancelBatch], только завершившихся до отмены.
+  Future<List<BatchItemResult>> runBatch({
+    required List<String> inputs,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+    int? concurrency, // null — из настроек (LLMService.concurrencyFor)
+    String? model, // null — модель по умолчанию
+  }) async {
+    if (_running != null) {
+      throw StateError('Batch generation is already running');
+    }
+    final generation = ++_generation;
+    final completer = Completer<List<BatchItemResult>>();
+    _running = completer;
+    _cancelled = false;
+    final cancelToken = CancelToken();
+    _cancelToken = cancelToken;
+    _results.clear();
+    notifyListeners();
+
+    var next = 0;
+    Future<void> worker() async {
+      while (!_cancelled && generation == _generation && next < inputs.length) {
+        final index = next++;
+        final input = inputs[index];
+        _progress.add(BatchProgressEvent(
+          completed: _results.length,
+          total: inputs.length,
+          currentIndex: index,
+          currentInput: input,
+        ));
+        BatchItemResult result;
+        try {
+          final output = await _llmService.generateTZ(
+            rawRequirements: input,
+            templateContent: templateContent,
+            format: format,
+            model: model,
+            cancelToken: cancelToken,
+          );
+          result = BatchItemResult(index: index, input: input, output: output);
+        } catch (e) {
+          ErrorLogService().record('batch', e);
+          result = BatchItemResult(index: index, input: input, error: e.toString());
+        }
+        // Запрос, завершившийся после отмены, в результаты не попадает
+        if (_cancelled || generation != _generation) return;
+        _results.add(result);
+        _itemDone.add(result);
+        _progress.add(BatchProgressEvent(
+          completed: _results.length,
+          total: inputs.length,
+          currentIndex: index,
+          currentInput: input,
+        ));
+        notifyListeners();
+      }
+    }
+
+    final workerCount = concurrency != null
+        ? concurrency.clamp(1, inputs.isEmpty ? 1 : inputs.length)
+        : _llmService.concurrencyFor(inputs.length);
+    final workers = List.generate(workerCount, (_) => worker());
+    unawaited(Future.wait(workers).then((_) {
+      if (!completer.isCompleted) completer.complete(List.unmodifiable(_results));
+    }));
+
+    try {
+      return await completer.future;
+    } finally {
+      if (identical(_running, completer)) {
+        _running = null;
+        notifyListeners();
+      }
+    }
+  }
+
+  /// Проверяет пакет до запуска: настройки провайдера, доступность модели,
+  /// наличие шаблона и бюджет токенов каждого ввода. Запросов генерации не делает —
+  /// только запрос списка моделей, чтобы не тратить длинный пакет на ошибку настройки.
+  Future<PreflightReport> preflightBatch({
+    required List<String> inputs,
+    String? templateId,
+    String? model,
+    OutputFormat format = OutputFormat.markdown,
+  }) async {
+    final problems = <String>[];
+    final modelId = (model != null && model.isNotEmpty) ? model : _llmService.defaultModel;
+
+    var modelAvailable = false;
+    if (_llmService.provider == null) {
+      problems.add('LLM провайдер не настроен');
+    } else if (modelId == null || modelId.isEmpty) {
+      problems.add('Модель не выбрана');
+    } else {
+      try {
+        modelAvailable = await _llmService.isSelectedModelAvailable(model: modelId);
+        if (!modelAvailable) problems.add('Модель "$modelId" недоступна у текущего провайдера');
+      } catch (e) {
+        problems.add('Не удалось получить список моделей: $e');
+      }
+    }
+
+    var templateFound = templateId == null;
+    String? templateContent;
+    if (templateId != null) {
+      final templateService = _templateService;
+      if (templateService == null) {
+        problems.add('Сервис шаблонов недоступен — шаблон $templateId не проверен');
+      } else if (await templateService.getTemplate(templateId) == null) {
+        problems.add('Шаблон $templateId не найден');
+      } else {
+        templateFound = true;
+        templateContent = await templateService.resolveTemplate(templateId);
+      }
+    }
+
+    final items = <PreflightItem>[];
+    for (var i = 0; i < inputs.length; i++) {
+      try {
+        final plan = _llmService.getGenerationPlan(
+          rawRequirements: inputs[i],
+          templateContent: templateContent,
+          model: modelId,
+          format: format,
+        );
+        items.add(PreflightItem(
+          index: i,
+          promptTokens: plan.promptTokens,
+          contextWindow: plan.contextWindow,
+          overBudget: plan.overBudget,
+        ));
+      } on LLMResponseValidationException catch (e) {
+        items.add(PreflightItem(index: i, promptTokens: 0, overBudget: false, error: e.message));
+      } catch (e) {
+        items.add(PreflightItem(index: i, promptTokens: 0, overBudget: false, error: e.toString()));
+      }
+    }
+
+    return PreflightReport(
+      model: modelId,
+      problems: problems,
+      modelAvailable: modelAvailable,
+      templateFound: templateFound,
+      items: items,
+    );
+  }
+
+  @override
+  void dispose() {
+    _cancelled = true;
+    _cancelToken?.cancel('batch_disposed');
+    _progress.close();
+    _itemDone.close();
+    super.dispose();
+  }
+
+  /// Прерывает пакет: ожидающие элементы не запускаются, выполняющиеся HTTP-запросы
+  /// отменяются, а ответы, успевшие прийти, отбрасываются.
+  /// Возвращает результаты, собранные до отмены.
+  List<BatchItemResult> cancelBatch() {
+    final completer = _running;
+    if (completer == null) return results;
+    _cancelled = true;
+    _cancelToken?.cancel('batch_cancelled');
+    final partial = List<BatchItemResult>.unmodifiable(_results);
+    if (!completer.isCompleted) completer.complete(partial);
+    return partial;
+  }
+}
@@ -4,6 +4,12 @@ import 'dart:io';
 import 'package:path_provider/path_provider.dart';
 import 'package:hive/hive.dart';
 import '../models/app_config.dart';
+import '../utils/atomic_file.dart';
+import '../utils/messages.dart';
+import '../utils/model_capabilities.dart';
+import '../utils/logit_bias.dart';
+import '../utils/provider_url_check.dart';
+import 'http_client_config.dart';
 import '../models/output_format.dart';
 import '../services/confluence_error_handler.dart';
 import '../models/confluence_config.dart';
@@ -18,13 +24,20 @@ class ConfigService extends ChangeNotifier {
   Box<AppConfig>? _box;
   bool _initialized = false;
   bool _useFileFallback = false; // macOS fallback when Hive serialization is broken
+  Future<void>? _initFuture; // текущая инициализация; параллельные вызовы ждут её
   
   AppConfig? get config => _config;
   
-  Future<void> init() async {
+  /// Инициализация хранилища конфигурации. Параллельные вызовы (экран запуска,
+  /// главный экран, настройки) не открывают бокс повторно, а ждут текущую загрузку.
+  Future<void> init() {
     if (_initialized && _box != null && _box!.isOpen) {
-      return; // Уже инициализировано
+      return Future.value(); // Уже инициализировано
     }
+    return _initFuture ??= _load().whenComplete(() => _initFuture = null);
+  }
+
+  Future<void> _load() async {
     try {
       if (_useFileFallback) {
         // Уже в режиме fallback – просто пробуем восстановить из файла
@@ -269,14 +282,65 @@ class ConfigService extends ChangeNotifier {
     return valid;
   }
   
+  List<String> _configWarnings = const [];
+
+  /// Некритичные предупреждения последнего [saveConfig] (сохранение они не блокируют)
+  List<String> get configWarnings => _configWarnings;
+
+  /// Проверяет, что URL API соответствует выбранному провайдеру.
+  /// Возвращает предупреждения; собственные шлюзы с неизвестными хостами допустимы.
+  List<String> checkConfigConsistency(AppConfig config) {
+    final warnings = <String>[];
+    switch (config.provider) {
+      case 'openai':
+        final warning = providerUrlWarning('openai', config.apiUrl);
+        if (warning != null) warnings.add(warning);
+        break;
+      case 'llmops':
+        final url = config.llmopsBaseUrl ?? '';
+        final warning = url.isEmpty ? null : providerUrlWarning('llmops', url);
+        if (warning != null) warnings.add(warning);
+        break;
+    }
+    return warnings;
+  }
+
   Future<void> saveConfig(AppConfig config) async {
     if (!_initialized) {
       await init();
     }
+    // URL поменяли вручную — окружение из списка больше не активно
+    config = config.withoutStaleEndpoint();
+
+    if (config.maxConcurrency != null && config.maxConcurrency! < 1) {
+      throw ArgumentError('maxConcurrency must be at least 1: ${config.maxConcurrency}');
+    }
+    if (config.emptyResponseRetries != null && config.emptyResponseRetries! < 0) {
+      throw ArgumentError('emptyResponseRetries must not be negative: ${config.emptyResponseRetries}');
+    }
+    final effort = config.reasoningEffort?.trim().toLowerCase();
+    if (effort != null && effort.isNotEmpty && !reasoningEffortLevels.contains(effort)) {
+      throw ArgumentError('reasoningEffort must be one of ${reasoningEffortLevels.join('/')}: ${config.reasoningEffort}');
+    }
+    if (config.logitBias != null) validateLogitBias(config.logitBias!);
+    final caPath = config.caCertPath?.trim();
+    if (caPath != null && caPath.isNotEmpty) {
+      loadCaBundle(caPath); // CaCertificateException с понятным сообщением
+    }
+    for (final path in [config.completionsPath, config.modelsPath, config.healthPath]) {
+      if (path != null && path.isNotEmpty && !path.startsWith('/')) {
+        throw ArgumentError('API path must start with "/": $path');
+      }
+    }
+    _configWarnings = checkConfigConsistency(config);
+    for (final warning in _configWarnings) {
+      print('[ConfigService:saveConfig] warning: $warning');
+    }
     
     try {
       if (_useFileFallback) {
         _config = config;
+        setUiLanguage(config.uiLanguage);
         await _writeBackup(config); // используем backup как основной storage
         notifyListeners();
         return;
@@ -301,9 +365,51 @@ class ConfigService extends ChangeNotifier {
         // КРИТИЧЕСКИ ВАЖНО: сохраняем конфигурацию музикации
         specMusicConfig: config.specMusicConfig,
         isDarkTheme: config.isDarkTheme,
+        modelPrefix: config.modelPrefix,
+        outputFilters: config.outputFilters,
+        connectTimeoutSeconds: config.connectTimeoutSeconds,
+        readTimeoutSeconds: config.readTimeoutSeconds,
+        modelsCacheTtlSeconds: config.modelsCacheTtlSeconds,
+        maxInputTokens: config.maxInputTokens,
+        completionsPath: config.completionsPath,
+        modelsPath: config.modelsPath,
+        favoriteModels: config.favoriteModels,
+        markdownFlavor: config.markdownFlavor,
+        extraBodyFields: config.extraBodyFields,
+        templateStorageMode: config.templateStorageMode,
+        templatesDirectory: config.templatesDirectory,
+        maxHistoryEntries: config.maxHistoryEntries,
+        maxHistoryAgeDays: config.maxHistoryAgeDays,
+        manualModels: config.manualModels,
+        uiLanguage: config.uiLanguage,
+        jsonSchema: config.jsonSchema,
+        templateProfile: config.templateProfile,
+        maxConcurrency: config.maxConcurrency,
+        streamIdleTimeoutSeconds: config.streamIdleTimeoutSeconds,
+        appendAcceptanceCriteria: config.appendAcceptanceCriteria,
+        insecureSkipVerify: config.insecureSkipVerify,
+        caCertPath: config.caCertPath,
+        redactPii: config.redactPii,
+        modelPricing: config.modelPricing,
+        costCurrency: config.costCurrency,
+        reasoningEffort: config.reasoningEffort,
+        dateFormat: config.dateFormat,
+        trimIncompleteEndings: config.trimIncompleteEndings,
+        emptyResponseRetries: config.emptyResponseRetries,
+        logitBias: config.logitBias,
+        healthPath: config.healthPath,
+        systemPromptOverrides: config.systemPromptOverrides,
+        templateTokenWarningThreshold: config.templateTokenWarningThreshold,
+        endpoints: config.endpoints,
+        activeEndpoint: config.activeEndpoint,
+        captureRawResponses: config.captureRawResponses,
+        endpointCapabilities: config.endpointCapabilities,
+        prependTableOfContents: config.prependTableOfContents,
+        deprecatedModels: config.deprecatedModels,
       );
       
       _config = newConfig;
+      setUiLanguage(newConfig.uiLanguage);
       
       // Очищаем ключ перед записью, чтобы избежать конфликтов типов
   // Не удаляем предварительно без необходимости – Hive перезапишет значение
@@ -352,6 +458,65 @@ class ConfigService extends ChangeNotifier {
     }
   }
 
+  /// Добавляет модель в избранное или убирает из него
+  Future<void> toggleFavoriteModel(String model) async {
+    if (_config != null) {
+      final favorites = List<String>.of(_config!.favoriteModels ?? const []);
+      if (!favorites.remove(model)) favorites.add(model);
+      final updatedConfig = _config!.copyWith(favoriteModels: favorites);
+      await saveConfig(updatedConfig);
+    }
+  }
+
+  // Идентификатор модели: буквы, цифры и . _ : / @ - (например, ft:gpt-4o:org:name:abc123)
+  static final RegExp _modelIdPattern = RegExp(r'^[A-Za-z0-9][A-Za-z0-9._:/@-]{0,199}$');
+
+  /// Добавляет модель, отсутствующую в списке /models (fine-tuned, кастомные).
+  /// Повторное добавление игнорируется. Возвращает обновлённый список ручных моделей.
+  Future<List<String>> addManualModel(String id) async {
+    final modelId = id.trim();
+    if (!_modelIdPattern.hasMatch(modelId)) {
+      throw ArgumentError('Некорректный идентификатор модели: "$id"');
+    }
+    final manual = List<String>.of(_config?.manualModels ?? const []);
+    if (_config != null && !manual.contains(modelId)) {
+      manual.add(modelId);
+      await saveConfig(_config!.copyWith(manualModels: manual));
+    }
+    return manual;
+  }
+
+  Future<List<String>> removeManualModel(String id) async {
+    final manual = List<String>.of(_config?.manualModels ?? const []);
+    if (_config != null && manual.remove(id)) {
+      await saveConfig(_config!.copyWith(manualModels: manual));
+    }
+    return manual;
+  }
+
+  /// Переключает базовый URL на окружение [name] из [AppConfig.endpoints]
+  /// без повторного ввода ключа. Для LLMOps меняется llmopsBaseUrl, для остальных — apiUrl.
+  /// Провайдер нужно переинициализировать (LLMService.initializeProvider).
+  Future<void> switchEndpoint(String name) async {
+    if (!_initialized) await init();
+    final config = _config;
+    if (config == null) {
+      throw StateError('Configuration is not loaded');
+    }
+    final url = config.endpoints?[name]?.trim();
+    if (url == null || url.isEmpty) {
+      throw ArgumentError('Endpoint "$name" not found');
+    }
+    final uri = Uri.tryParse(url);
+    if (uri == null || !(uri.isScheme('http') || uri.isScheme('https')) || uri.host.isEmpty) {
+      throw ArgumentError('Endpoint "$name" has invalid URL: $url');
+    }
+    final updated = config.provider == 'llmops'
+        ? config.copyWith(llmopsBaseUrl: url, activeEndpoint: name)
+        : config.copyWith(apiUrl: url, activeEndpoint: name);
+    await saveConfig(updated);
+  }
+
   Future<void> updatePreferredFormat(OutputFormat format) async {
     if (_config != null) {
       final updatedConfig = _config!.copyWith(outputFormat: format);
@@ -422,6 +587,19 @@ class ConfigService extends ChangeNotifier {
     };
   }
 
+  /// Размер хранилища конфигурации (бокс Hive и резервная JSON-копия) в байтах
+  Future<int> storageBytes() async {
+    var total = 0;
+    for (final path in [_box?.path, (await _backupFile()).path]) {
+      if (path == null) continue;
+      try {
+        final f = File(path);
+        if (await f.exists()) total += await f.length();
+      } catch (_) {}
+    }
+    return total;
+  }
+
   // ===== Backup JSON persistence =====
   Future<File> _backupFile() async {
     final dir = await getApplicationSupportDirectory();
@@ -431,7 +609,7 @@ class ConfigService extends ChangeNotifier {
   Future<void> _writeBackup(AppConfig config) async {
     try {
       final f = await _backupFile();
-      await f.writeAsString(jsonEncode(config.toJson()));
+      await writeStringAtomically(f, jsonEncode(config.toJson()));
     } catch (e) {
       print('Не удалось создать резервную копию: $e');
     }
@@ -0,0 +1,146 @@
+import 'dart:convert';
+import 'dart:io';
+import 'package:flutter/foundation.dart';
+import 'package:path_provider/path_provider.dart';
+import '../models/chat_message.dart';
+import '../models/conversation.dart';
+import '../models/output_format.dart';
+import '../utils/atomic_file.dart';
+import 'llm_service.dart';
+import 'template_service.dart';
+
+/// Итеративное уточнение ТЗ в диалоге: первая генерация по шаблону, затем
+/// правки сообщениями пользователя с полной историей. Диалоги хранятся в
+/// `conversations.json` в каталоге поддержки приложения и переживают перезапуск.
+class ConversationService extends ChangeNotifier {
+  final LLMService _llmService;
+  final TemplateService _templateService;
+  final List<Conversation> _conversations = [];
+  Future<void>? _loadFuture;
+
+  ConversationService({
+    required LLMService llmService,
+    required TemplateService templateService,
+  })  : _llmService = llmService,
+        _templateService = templateService;
+
+  /// Диалоги от новых к старым
+  List<Conversation> get conversations => List.unmodifiable(_conversations);
+
+  Future<File> _conversationsFile() async {
+    final dir = await getApplicationSupportDirectory();
+    return File('${dir.path}/conversations.json');
+  }
+
+  /// Загружает диалоги с диска (однократно)
+  Future<void> init() => _loadFuture ??= _load();
+
+  Future<void> _load() async {
+    try {
+      final f = await _conversationsFile();
+      if (!await f.exists()) return;
+      final content = await f.readAsString();
+      if (content.trim().isEmpty) return;
+      final list = jsonDecode(content) as List<dynamic>;
+      _conversations
+        ..clear()
+        ..addAll(list.whereType<Map<String, dynamic>>().map(Conversation.fromJson));
+      notifyListeners();
+    } catch (e) {
+      print('Ошибка чтения диалогов: $e');
+    }
+  }
+
+  Future<void> _save() async {
+    final f = await _conversationsFile();
+    await writeStringAtomically(f, jsonEncode(_conversations.map((c) => c.toJson()).toList()));
+  }
+
+  Conversation? getConversation(String id) {
+    for (final c in _conversations) {
+      if (c.id == id) return c;
+    }
+    return null;
+  }
+
+  /// Начинает диалог: генерирует ТЗ по шаблону [templateId] и вводу [userInput].
+  /// Возвращает id диалога и первый ответ модели.
+  Future<({String id, String answer})> startConversation(
+    String? templateId,
+    String userInput, {
+    OutputFormat format = OutputFormat.markdown,
+    String? model,
+  }) async {
+    await init();
+    String? templateContent;
+    if (templateId != null) {
+      if (await _templateService.getTemplate(templateId) == null) {
+        throw ArgumentError('Template with id $templateId not found');
+      }
+      templateContent = await _templateService.resolveTemplate(templateId);
+    }
+    final prompts = _llmService.buildGenerationPrompts(
+      rawRequirements: userInput,
+      templateContent: templateContent,
+      format: format,
+      model: model,
+    );
+    final messages = [
+      ChatMessage(role: 'system', content: prompts['system']!),
+      ChatMessage(role: 'user', content: prompts['user']!),
+    ];
+    final answer = await _llmService.sendConversation(messages, model: model);
+
+    final now = DateTime.now();
+    final conversation = Conversation(
+      templateId: templateId,
+      model: model,
+      format: format,
+      createdAt: now,
+      messages: [...messages, ChatMessage(role: 'assistant', content: answer)],
+    );
+    _conversations.insert(0, conversation);
+    notifyListeners();
+    await _save();
+    return (id: conversation.id, answer: answer);
+  }
+
+  /// Добавляет сообщение пользователя в диалог [conversationId] и возвращает ответ модели
+  Future<String> continueConversation(String conversationId, String message) async {
+    await init();
+    final index = _conversations.indexWhere((c) => c.id == conversationId);
+    if (index < 0) {
+      throw ArgumentError('Conversation with id $conversationId not found');
+    }
+    if (message.trim().isEmpty) {
+      throw ArgumentError('Сообщение не может быть пустым');
+    }
+    final conversation = _conversations[index];
+    // Каждая реплика проходит ту же подготовку, что и первый запрос (Confluence, маскирование ПДн)
+    final prepared = _llmService.prepareUserInput(message.trim());
+    final messages = [...conversation.messages, ChatMessage(role: 'user', content: prepared)];
+    final answer = await _llmService.sendConversation(messages, model: conversation.model);
+
+    // Недавно продолженный диалог поднимается в начало списка
+    _conversations
+      ..removeAt(index)
+      ..insert(0, conversation.copyWith(
+        updatedAt: DateTime.now(),
+        messages: [...messages, ChatMessage(role: 'assistant', content: answer)],
+      ));
+    notifyListeners();
+    await _save();
+    return answer;
+  }
+
+  Future<void> deleteConversation(String id) async {
+    await init();
+    final before = _conversations.length;
+    _conversations.removeWhere((c) => c.id == id);
+    if (_conversations.length == before) {
+      throw ArgumentError('Conversation with id $id not found');
+    }
+    notifyListeners();
+    await _save();
+  }
+}
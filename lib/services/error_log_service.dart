@@ -0,0 +1,56 @@
+import 'dart:collection';
+import 'package:flutter/foundation.dart';
+
+/// Запись об ошибке фоновой операции
+class ErrorEntry {
+  final DateTime timestamp;
+  final String source; // где произошла ошибка: 'startup', 'generation', ...
+  final String message;
+
+  const ErrorEntry({
+    required this.timestamp,
+    required this.source,
+    required this.message,
+  });
+
+  @override
+  String toString() => '[${timestamp.toIso8601String()}] $source: $message';
+}
+
+/// In-memory журнал последних ошибок для панели диагностики.
+///
+/// Ошибки запуска и генерации раньше уходили только в stdout; теперь они
+/// сохраняются в кольцевом буфере и доступны UI.
+class ErrorLogService extends ChangeNotifier {
+  static final ErrorLogService _instance = ErrorLogService._internal();
+  factory ErrorLogService() => _instance;
+  ErrorLogService._internal();
+
+  static const int maxEntries = 50;
+
+  final ListQueue<ErrorEntry> _entries = ListQueue<ErrorEntry>();
+
+  /// Текст последней ошибки или null, если ошибок не было
+  String? get lastError => _entries.isEmpty ? null : _entries.last.message;
+
+  /// Последние ошибки, от новых к старым
+  List<ErrorEntry> get recentErrors => _entries.toList().reversed.toList(growable: false);
+
+  /// Регистрирует ошибку из [source]
+  void record(String source, Object error) {
+    final raw = error.toString();
+    final message = raw.startsWith('Exception: ') ? raw.substring('Exception: '.length) : raw;
+    _entries.addLast(ErrorEntry(timestamp: DateTime.now(), source: source, message: message));
+    while (_entries.length > maxEntries) {
+      _entries.removeFirst();
+    }
+    debugPrint('[ErrorLogService] $source: $message');
+    notifyListeners();
+  }
+
+  void clear() {
+    if (_entries.isEmpty) return;
+    _entries.clear();
+    notifyListeners();
+  }
+}
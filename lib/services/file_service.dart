@@ -1,6 +1,11 @@
 import 'package:file_picker/file_picker.dart';
 import 'dart:io';
+import 'dart:convert';
 import '../models/output_format.dart';
+import '../models/generation_metadata.dart';
+import '../utils/document_blocks.dart';
+import '../utils/docx_writer.dart';
+import '../utils/pdf_writer.dart';
 
 class FileService {
   static Future<String?> saveFile(String content, String filename) async {
@@ -31,13 +36,14 @@ class FileService {
     required String content,
     required OutputFormat format,
     String? customFilename,
+    GenerationMetadata? metadata,
   }) async {
     try {
       // Validate content based on format
       final validatedContent = validateContentForFormat(content, format);
       
       // Generate format-specific filename
-      final filename = generateFilename(format, customFilename);
+      final filename = generateFilename(format, customFilename, project: metadata?.project);
       
       // Get format-specific dialog title and file extension
       final dialogTitle = getDialogTitle(format);
@@ -54,12 +60,180 @@ class FileService {
       
       final file = File(outputFile);
       await file.writeAsString(validatedContent);
+      if (metadata != null) await writeMetadataSidecar(outputFile, metadata);
       return outputFile;
     } catch (e) {
       throw Exception('Ошибка при сохранении файла: $e');
     }
   }
 
+  /// Путь к файлу метаданных рядом с документом: `TZ.md` → `TZ.meta.json`
+  static String metadataSidecarPath(String documentPath) {
+    final slash = documentPath.lastIndexOf(Platform.pathSeparator);
+    final dot = documentPath.lastIndexOf('.');
+    final base = dot > slash ? documentPath.substring(0, dot) : documentPath;
+    return '$base.meta.json';
+  }
+
+  /// Записывает метаданные генерации рядом с сохранённым документом
+  static Future<void> writeMetadataSidecar(String documentPath, GenerationMetadata metadata) async {
+    final encoder = const JsonEncoder.withIndent('  ');
+    await File(metadataSidecarPath(documentPath)).writeAsString(encoder.convert(metadata.toJson()));
+  }
+
+  /// Форматы, доступные для экспорта (для построения меню «Экспорт»)
+  static const List<ExportFormat> exportFormats = [
+    ExportFormat(id: 'md', displayName: 'Markdown', fileExtension: 'md'),
+    ExportFormat(id: 'txt', displayName: 'Обычный текст', fileExtension: 'txt'),
+    ExportFormat(id: 'html', displayName: 'HTML', fileExtension: 'html'),
+    ExportFormat(id: 'pdf', displayName: 'PDF', fileExtension: 'pdf'),
+    ExportFormat(id: 'docx', displayName: 'Word (DOCX)', fileExtension: 'docx'),
+  ];
+
+  static List<ExportFormat> getExportFormats() => List.unmodifiable(exportFormats);
+
+  /// Единая точка экспорта: преобразует [content] (Markdown или HTML) в формат
+  /// [formatId] и записывает в [destPath]. Возвращает путь к записанному файлу.
+  static Future<String> exportRequirements({
+    required String content,
+    required String destPath,
+    required String formatId,
+  }) async {
+    final format = exportFormats.where((f) => f.id == formatId).firstOrNull;
+    if (format == null) {
+      throw FileExportException('Unsupported export format: $formatId');
+    }
+
+    final isHtml = _looksLikeHtml(content);
+    final path = destPath.toLowerCase().endsWith('.${format.fileExtension}')
+        ? destPath
+        : '$destPath.${format.fileExtension}';
+
+    if (format.id == 'pdf' || format.id == 'docx') {
+      final bytes = format.id == 'pdf'
+          ? await _buildPdf(_documentBlocks(content, isHtml))
+          : buildDocx(_documentBlocks(content, isHtml));
+      try {
+        await File(path).writeAsBytes(bytes);
+      } catch (e) {
+        throw FileExportException('Ошибка при сохранении файла: $e');
+      }
+      return path;
+    }
+
+    final String output;
+    switch (format.id) {
+      case 'md':
+        if (isHtml) {
+          throw FileExportException('Cannot export HTML content as Markdown');
+        }
+        output = validateMarkdownContent(content);
+        break;
+      case 'txt':
+        if (content.trim().isEmpty) {
+          throw FileExportException('Cannot export empty content');
+        }
+        output = isHtml ? _htmlToPlainText(content) : _markdownToPlainText(content);
+        break;
+      default: // html
+        output = isHtml ? _validateHtmlContent(content) : _markdownToHtmlDocument(validateMarkdownContent(content));
+    }
+
+    try {
+      await File(path).writeAsString(output);
+    } catch (e) {
+      throw FileExportException('Ошибка при сохранении файла: $e');
+    }
+    return path;
+  }
+
+  /// Структура документа для DOCX и PDF; HTML предварительно сводится к упрощённому Markdown
+  static List<DocumentBlock> _documentBlocks(String content, bool isHtml) {
+    if (content.trim().isEmpty) {
+      throw FileExportException('Cannot export empty content');
+    }
+    return parseMarkdownBlocks(isHtml ? _htmlToMarkdown(content) : validateMarkdownContent(content));
+  }
+
+  static Future<List<int>> _buildPdf(List<DocumentBlock> blocks) async {
+    final fontPath = findUnicodeFontPath();
+    if (fontPath == null) {
+      throw FileExportException('No Unicode font found for PDF export');
+    }
+    return buildPdf(blocks, fontBytes: await File(fontPath).readAsBytes());
+  }
+
+  /// Заголовки и пункты списков HTML переводятся в Markdown, остальное — в текст
+  static String _htmlToMarkdown(String content) {
+    final marked = content
+        .replaceAllMapped(RegExp(r'<h([1-6])[^>]*>', caseSensitive: false), (m) => '\n${'#' * int.parse(m[1]!)} ')
+        .replaceAll(RegExp(r'<li[^>]*>', caseSensitive: false), '\n- ');
+    return _htmlToPlainText(marked);
+  }
+
+  static bool _looksLikeHtml(String content) =>
+      RegExp(r'^\s*<(h[1-6]|p|div|table|ul|ol|ac:|!DOCTYPE|html)', caseSensitive: false).hasMatch(content);
+
+  static String _markdownToPlainText(String content) {
+    return content
+        .split('\n')
+        .map((line) => line
+            .replaceFirst(RegExp(r'^\s{0,3}#{1,6}\s+'), '')
+            .replaceAll(RegExp(r'\*\*|__|`'), ''))
+        .join('\n')
+        .trim();
+  }
+
+  static String _htmlToPlainText(String content) {
+    return content
+        .replaceAll(RegExp(r'<br\s*/?>', caseSensitive: false), '\n')
+        .replaceAll(RegExp(r'</(p|h[1-6]|li|tr|div)>', caseSensitive: false), '\n')
+        .replaceAll(RegExp(r'<[^>]+>'), '')
+        .replaceAll('&lt;', '<')
+        .replaceAll('&gt;', '>')
+        .replaceAll('&quot;', '"')
+        .replaceAll('&nbsp;', ' ')
+        .replaceAll('&amp;', '&')
+        .replaceAll(RegExp(r'\n{3,}'), '\n\n')
+        .trim();
+  }
+
+  /// Минимальное преобразование Markdown в HTML: заголовки, списки, абзацы
+  static String _markdownToHtmlDocument(String markdown) {
+    String escape(String s) => s.replaceAll('&', '&amp;').replaceAll('<', '&lt;').replaceAll('>', '&gt;');
+    String inline(String s) => escape(s)
+        .replaceAllMapped(RegExp(r'\*\*(.+?)\*\*'), (m) => '<strong>${m[1]}</strong>')
+        .replaceAllMapped(RegExp(r'`(.+?)`'), (m) => '<code>${m[1]}</code>');
+
+    final body = StringBuffer();
+    var inList = false;
+    for (final line in markdown.split('\n')) {
+      final trimmed = line.trim();
+      final heading = RegExp(r'^(#{1,6})\s+(.*)$').firstMatch(trimmed);
+      final item = RegExp(r'^[-*+]\s+(.*)$').firstMatch(trimmed);
+      if (item == null && inList) {
+        body.writeln('</ul>');
+        inList = false;
+      }
+      if (heading != null) {
+        final level = heading.group(1)!.length;
+        body.writeln('<h$level>${inline(heading.group(2)!)}</h$level>');
+      } else if (item != null) {
+        if (!inList) {
+          body.writeln('<ul>');
+          inList = true;
+        }
+        body.writeln('<li>${inline(item.group(1)!)}</li>');
+      } else if (trimmed.isNotEmpty) {
+        body.writeln('<p>${inline(trimmed)}</p>');
+      }
+    }
+    if (inList) body.writeln('</ul>');
+
+    return '<!DOCTYPE html>\n<html>\n<head><meta charset="utf-8"><title>Техническое задание</title></head>\n'
+        '<body>\n$body</body>\n</html>\n';
+  }
+
   /// Validates content based on the selected format
   static String validateContentForFormat(String content, OutputFormat format) {
     switch (format) {
@@ -151,7 +325,7 @@ class FileService {
   }
 
   /// Generates format-specific filename with timestamp and format identifier
-  static String generateFilename(OutputFormat format, String? customFilename) {
+  static String generateFilename(OutputFormat format, String? customFilename, {String? project}) {
     if (customFilename != null && customFilename.isNotEmpty) {
       // Ensure custom filename has correct extension
       final parts = customFilename.split('.');
@@ -164,7 +338,10 @@ class FileService {
 
     final timestamp = DateTime.now().millisecondsSinceEpoch;
     final formatId = format == OutputFormat.markdown ? 'MD' : 'HTML';
-    return 'TZ_${formatId}_$timestamp.${format.fileExtension}';
+    // Проект — префикс имени файла, чтобы результаты группировались в папке
+    final projectPrefix = project?.trim().replaceAll(RegExp(r'[^\wА-Яа-яЁё-]+'), '_') ?? '';
+    final prefix = projectPrefix.isEmpty ? '' : '${projectPrefix}_';
+    return '${prefix}TZ_${formatId}_$timestamp.${format.fileExtension}';
   }
 
   /// Gets format-specific dialog title
@@ -178,6 +355,19 @@ class FileService {
   }
 }
 
+/// Формат экспорта, доступный в меню «Экспорт»
+class ExportFormat {
+  final String id; // 'md', 'txt', 'html', 'pdf', 'docx'
+  final String displayName;
+  final String fileExtension;
+
+  const ExportFormat({
+    required this.id,
+    required this.displayName,
+    required this.fileExtension,
+  });
+}
+
 /// Exception thrown when file export fails
 class FileExportException implements Exception {
   final String message;
@@ -0,0 +1,140 @@
+import 'dart:convert';
+import 'dart:io';
+import '../models/app_config.dart';
+import '../utils/atomic_file.dart';
+import 'config_service.dart';
+import 'history_service.dart';
+import 'llm_service.dart';
+import 'template_service.dart';
+
+/// Экспорт генерации из истории в JSON-пакет для баг-репортов и настройки промтов:
+/// промты, модель, параметры запроса и полный ответ. Секреты в пакет не попадают.
+class GenerationBundleService {
+  static const int bundleVersion = 1;
+  static const String redacted = '***';
+
+  final LLMService _llmService;
+  final TemplateService _templateService;
+  final HistoryService _historyService;
+  final ConfigService _configService;
+
+  GenerationBundleService({
+    required LLMService llmService,
+    required TemplateService templateService,
+    required HistoryService historyService,
+    required ConfigService configService,
+  })  : _llmService = llmService,
+        _templateService = templateService,
+        _historyService = historyService,
+        _configService = configService;
+
+  /// Записывает пакет генерации [historyId] в [destPath]
+  Future<void> exportGenerationBundle(String historyId, String destPath) async {
+    final bundle = await buildBundle(historyId);
+    const encoder = JsonEncoder.withIndent('  ');
+    await writeStringAtomically(File(destPath), encoder.convert(bundle));
+  }
+
+  /// Собирает пакет без записи на диск
+  Future<Map<String, dynamic>> buildBundle(String historyId) async {
+    await _historyService.init();
+    final entry = _historyService.getEntry(historyId);
+    if (entry == null) {
+      throw ArgumentError('History entry with id $historyId not found');
+    }
+    final metadata = entry.metadata;
+    final config = _configService.config;
+
+    // Промты в истории не хранятся — собираем их так же, как при генерации (dry-run).
+    // Если шаблон с тех пор изменён или удалён, промт будет отличаться от исходного.
+    String? templateContent;
+    String? promptsNote;
+    final templateId = metadata?.templateId;
+    if (templateId != null) {
+      if (await _templateService.getTemplate(templateId) != null) {
+        templateContent = await _templateService.resolveTemplate(templateId);
+      } else {
+        promptsNote = 'Template $templateId no longer exists; prompts built without it';
+      }
+    }
+    Map<String, String>? prompts;
+    try {
+      prompts = _llmService.buildGenerationPrompts(
+        rawRequirements: entry.rawRequirements,
+        changes: entry.changes,
+        templateContent: templateContent,
+        format: entry.format,
+        model: entry.model,
+      );
+    } catch (e) {
+      promptsNote = 'Prompts could not be rebuilt: $e';
+    }
+
+    final bundle = <String, dynamic>{
+      'bundleVersion': bundleVersion,
+      'exportedAt': DateTime.now().toIso8601String(),
+      'historyId': entry.id,
+      'timestamp': entry.timestamp.toIso8601String(),
+      'model': entry.model,
+      'format': entry.format.name,
+      'template': {
+        'id': templateId,
+        'name': metadata?.templateName,
+      },
+      'parameters': {
+        'temperature': metadata?.temperature,
+        'reasoningEffort': config?.reasoningEffort,
+        'provider': config?.provider,
+        'apiUrl': config?.apiUrl,
+        'apiToken': (config?.apiToken.isNotEmpty ?? false) ? redacted : null,
+        'extraBodyFields': config?.extraBodyFields,
+      },
+      'input': {
+        'rawRequirements': entry.rawRequirements,
+        'changes': entry.changes,
+      },
+      'prompts': {
+        'system': prompts?['system'],
+        'user': prompts?['user'],
+        if (promptsNote != null) 'note': promptsNote,
+      },
+      'response': {
+        'content': entry.generatedTz,
+        'partial': entry.partial,
+        'usage': {
+          'inputTokens': metadata?.inputTokens,
+          'outputTokens': metadata?.outputTokens,
+          'estimated': true, // в истории хранится оценка токенов
+        },
+      },
+      if (metadata?.sourceHistoryId != null) 'sourceHistoryId': metadata!.sourceHistoryId,
+    };
+    return _redactSecrets(bundle, config) as Map<String, dynamic>;
+  }
+
+  // Ключ мог оказаться в тексте (вставлен во ввод или в поле шлюза) — вычищаем его везде
+  Object? _redactSecrets(Object? value, AppConfig? config) {
+    final secrets = [
+      config?.apiToken,
+      config?.llmopsAuthHeader,
+      config?.cerebrasToken,
+      config?.groqToken,
+    ].whereType<String>().where((s) => s.trim().length >= 8).toList();
+    if (secrets.isEmpty) return value;
+
+    Object? walk(Object? node) {
+      if (node is String) {
+        var text = node;
+        for (final secret in secrets) {
+          text = text.replaceAll(secret, redacted);
+        }
+        return text;
+      }
+      if (node is Map) return <String, dynamic>{for (final e in node.entries) '${e.key}': walk(e.value)};
+      if (node is List) return node.map(walk).toList();
+      return node;
+    }
+
+    return walk(value);
+  }
+}
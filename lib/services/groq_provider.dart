@@ -2,7 +2,14 @@ import 'package:dio/dio.dart';
 import '../models/openai_model.dart';
 import '../models/chat_message.dart';
 import '../models/app_config.dart';
+import '../utils/error_body.dart';
+import '../models/finish_reason.dart';
+import '../models/llm_response.dart';
+import '../models/token_usage.dart';
+import '../exceptions/llm_exceptions.dart';
 import 'llm_provider.dart';
+import 'request_abort_registry.dart';
+import 'http_client_config.dart';
 
 class GroqProvider implements LLMProvider {
   final Dio _dio = Dio();
@@ -15,7 +22,10 @@ class GroqProvider implements LLMProvider {
   bool _isLoading = false;
   String? _error;
   
-  GroqProvider(this._config);
+  GroqProvider(this._config) {
+    configureTls(_dio, _config);
+    _dio.interceptors.add(RequestAbortRegistry().interceptor);
+  }
 
   String _resolveModel(String? model) {
     if (model != null && model.isNotEmpty && model != 'default') {
@@ -40,7 +50,7 @@ class GroqProvider implements LLMProvider {
       }
       if (data['message'] != null) return data['message'].toString();
     }
-    if (data != null) return data.toString();
+    if (data != null) return describeErrorBody(data, statusCode: e.response?.statusCode);
     return e.message ?? 'DioException';
   }
   
@@ -55,6 +65,19 @@ class GroqProvider implements LLMProvider {
   
   @override
   String? get error => _error;
+
+  FinishReason? _lastFinishReason;
+
+  @override
+  FinishReason? get lastFinishReason => _lastFinishReason;
+
+  String _contentOf(ChatChoice choice) {
+    _lastFinishReason = FinishReason.parse(choice.finishReason);
+    if (_lastFinishReason == FinishReason.contentFilter) {
+      throw const ContentFilteredException();
+    }
+    return choice.message.content;
+  }
   
   @override
   Future<bool> testConnection() async {
@@ -151,6 +174,27 @@ class GroqProvider implements LLMProvider {
     String? model,
     int? maxTokens,
     double? temperature,
+    CancelToken? cancelToken,
+  }) async {
+    final response = await sendRequestDetailed(
+      systemPrompt: systemPrompt,
+      userPrompt: userPrompt,
+      model: model,
+      maxTokens: maxTokens,
+      temperature: temperature,
+      cancelToken: cancelToken,
+    );
+    return response.content;
+  }
+
+  @override
+  Future<LLMResponse> sendRequestDetailed({
+    required String systemPrompt,
+    required String userPrompt,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+    CancelToken? cancelToken,
   }) async {
     try {
       _isLoading = true;
@@ -176,6 +220,7 @@ class GroqProvider implements LLMProvider {
         return _dio.post(
           '$_baseUrl/chat/completions',
           data: request.toJson(),
+          cancelToken: cancelToken,
           options: Options(
             headers: {
               'Authorization': 'Bearer ${_config.groqToken}',
@@ -202,11 +247,16 @@ class GroqProvider implements LLMProvider {
       if (response.statusCode == 200) {
         final chatResponse = ChatResponse.fromJson(response.data);
         if (chatResponse.choices.isNotEmpty) {
-          return chatResponse.choices.first.message.content;
+          final choice = chatResponse.choices.first;
+          return LLMResponse(
+            content: _contentOf(choice),
+            usage: TokenUsage.fromResponse(response.data),
+            finishReason: FinishReason.parse(choice.finishReason),
+          );
         }
       }
       
-      throw Exception('Пустой ответ от Groq');
+      throw const EmptyResponseException('Groq');
     } catch (e) {
       if (e is DioException) {
         final status = e.response?.statusCode;
@@ -0,0 +1,93 @@
+import 'package:uuid/uuid.dart';
+import '../exceptions/content_processing_exceptions.dart';
+import '../models/generation_history.dart';
+import '../models/generation_metadata.dart';
+import 'history_service.dart';
+import 'llm_service.dart';
+import 'template_service.dart';
+
+/// Повторная генерация по записи истории: тот же ввод, шаблон, модель и формат.
+/// Новая запись истории ссылается на исходную через [GenerationMetadata.sourceHistoryId].
+class HistoryRegenerationService {
+  final LLMService _llmService;
+  final TemplateService _templateService;
+  final HistoryService _historyService;
+
+  HistoryRegenerationService({
+    required LLMService llmService,
+    required TemplateService templateService,
+    required HistoryService historyService,
+  })  : _llmService = llmService,
+        _templateService = templateService,
+        _historyService = historyService;
+
+  /// Генерирует ТЗ заново и сохраняет результат в истории. Возвращает новую запись.
+  Future<GenerationHistory> regenerateFromHistory(String historyId) async {
+    await _historyService.init();
+    final original = _historyService.getEntry(historyId);
+    if (original == null) {
+      throw ArgumentError('History entry with id $historyId not found');
+    }
+    final metadata = original.metadata;
+
+    // Шаблон могли удалить после исходной генерации — молча подменять его нельзя
+    String? templateContent;
+    double? templateTemperature;
+    final templateId = metadata?.templateId;
+    if (templateId != null) {
+      final template = await _templateService.getTemplate(templateId);
+      if (template == null) {
+        throw LLMResponseValidationException(
+          'Шаблон «${metadata?.templateName ?? templateId}» из исходной генерации удалён',
+          '',
+          recoveryAction: 'Выберите другой шаблон и сгенерируйте ТЗ заново',
+          technicalDetails: 'Template $templateId not found',
+        );
+      }
+      templateContent = await _templateService.resolveTemplate(templateId);
+      templateTemperature = template.temperature;
+    }
+    final temperature = metadata?.temperature ?? templateTemperature;
+
+    // Недоступную модель отклонит generateTZ с понятным сообщением
+    final generated = await _llmService.generateTZ(
+      rawRequirements: original.rawRequirements,
+      changes: original.changes,
+      templateContent: templateContent,
+      format: original.format,
+      model: original.model,
+      temperature: temperature,
+    );
+
+    final estimator = _llmService.tokenEstimator;
+    final id = const Uuid().v4();
+    final timestamp = DateTime.now();
+    final entry = GenerationHistory(
+      id: id,
+      rawRequirements: original.rawRequirements,
+      changes: original.changes,
+      generatedTz: generated,
+      timestamp: timestamp,
+      model: original.model,
+      format: original.format,
+      project: original.project,
+      metadata: GenerationMetadata(
+        historyId: id,
+        model: original.model,
+        timestamp: timestamp,
+        templateId: templateId,
+        templateName: metadata?.templateName,
+        temperature: temperature,
+        inputTokens: estimator.estimate(original.rawRequirements, model: original.model) +
+            estimator.estimate(original.changes ?? '', model: original.model),
+        outputTokens: estimator.estimate(generated, model: original.model),
+        userInput: original.rawRequirements,
+        changes: original.changes,
+        sourceHistoryId: original.id,
+        project: original.project,
+      ),
+    );
+    await _historyService.add(entry);
+    return entry;
+  }
+}
@@ -0,0 +1,210 @@
+import 'dart:convert';
+import 'dart:io';
+import 'package:flutter/foundation.dart';
+import 'package:path_provider/path_provider.dart';
+import '../models/cost_estimate.dart';
+import '../models/generation_history.dart';
+import '../models/generation_metadata.dart';
+import '../utils/atomic_file.dart';
+
+/// История генераций с сохранением между запусками
+/// (JSON-файл в каталоге поддержки приложения).
+class HistoryService extends ChangeNotifier {
+  final List<GenerationHistory> _entries = [];
+  Future<void>? _loadFuture;
+  int? _maxEntries;
+  int? _maxAgeDays;
+
+  /// Записи истории, от новых к старым
+  List<GenerationHistory> get entries => List.unmodifiable(_entries);
+
+  Future<File> _historyFile() async {
+    final dir = await getApplicationSupportDirectory();
+    return File('${dir.path}/generation_history.json');
+  }
+
+  /// Загружает историю с диска (однократно)
+  Future<void> init() => _loadFuture ??= _load();
+
+  Future<void> _load() async {
+    try {
+      final f = await _historyFile();
+      if (!await f.exists()) return;
+      final content = await f.readAsString();
+      if (content.trim().isEmpty) return;
+      final list = jsonDecode(content) as List<dynamic>;
+      _entries
+        ..clear()
+        ..addAll(list.whereType<Map<String, dynamic>>().map(GenerationHistory.fromJson));
+      notifyListeners();
+    } catch (e) {
+      print('Ошибка чтения истории генераций: $e');
+    }
+  }
+
+  Future<void> _save() async {
+    try {
+      final f = await _historyFile();
+      await writeStringAtomically(f, jsonEncode(_entries.map((e) => e.toJson()).toList()));
+    } catch (e) {
+      print('Не удалось сохранить историю генераций: $e');
+    }
+  }
+
+  /// Задаёт политику хранения: не более [maxEntries] записей и не старше
+  /// [maxAgeDays] дней. null или значение <= 0 — без ограничения.
+  void configureRetention({int? maxEntries, int? maxAgeDays}) {
+    _maxEntries = maxEntries != null && maxEntries > 0 ? maxEntries : null;
+    _maxAgeDays = maxAgeDays != null && maxAgeDays > 0 ? maxAgeDays : null;
+  }
+
+  Future<void> add(GenerationHistory entry) async {
+    await init();
+    _entries.insert(0, entry);
+    _applyRetention();
+    notifyListeners();
+    await _save();
+  }
+
+  /// Применяет политику хранения и сохраняет результат.
+  /// Возвращает число удалённых записей.
+  Future<int> prune() async {
+    await init();
+    final removed = _applyRetention();
+    if (removed > 0) {
+      notifyListeners();
+      await _save();
+    }
+    return removed;
+  }
+
+  // Удаляет устаревшие записи, затем самые старые сверх лимита (FIFO)
+  int _applyRetention() {
+    final before = _entries.length;
+    if (_maxAgeDays != null) {
+      final cutoff = DateTime.now().subtract(Duration(days: _maxAgeDays!));
+      _entries.removeWhere((e) => e.timestamp.isBefore(cutoff));
+    }
+    if (_maxEntries != null && _entries.length > _maxEntries!) {
+      _entries.removeRange(_maxEntries!, _entries.length);
+    }
+    return before - _entries.length;
+  }
+
+  Future<void> clear() async {
+    await init();
+    if (_entries.isEmpty) return;
+    _entries.clear();
+    notifyListeners();
+    await _save();
+  }
+
+  /// Размер файла истории в байтах
+  Future<int> storageBytes() async {
+    try {
+      final f = await _historyFile();
+      return await f.exists() ? await f.length() : 0;
+    } catch (_) {
+      return 0;
+    }
+  }
+
+  /// Поиск по истории: подстрока [query] без учёта регистра во вводе
+  /// пользователя, изменениях и сгенерированном ТЗ. Результаты — от новых к старым.
+  /// [templateId] и [model] дополнительно сужают выборку.
+  Future<List<GenerationHistory>> search(String query, {String? templateId, String? model}) async {
+    await init();
+    final needle = query.trim().toLowerCase();
+    final results = _entries.where((e) {
+      if (templateId != null && e.metadata?.templateId != templateId) return false;
+      if (model != null && e.model != model) return false;
+      if (needle.isEmpty) return true;
+      return e.rawRequirements.toLowerCase().contains(needle) ||
+          (e.changes?.toLowerCase().contains(needle) ?? false) ||
+          e.generatedTz.toLowerCase().contains(needle);
+    }).toList();
+    results.sort((a, b) => b.timestamp.compareTo(a.timestamp));
+    return results;
+  }
+
+  /// Записи проекта [project] (без учёта регистра), от новых к старым
+  Future<List<GenerationHistory>> getHistoryByProject(String project) async {
+    await init();
+    final key = project.trim().toLowerCase();
+    final results = _entries.where((e) => e.project?.trim().toLowerCase() == key).toList();
+    results.sort((a, b) => b.timestamp.compareTo(a.timestamp));
+    return results;
+  }
+
+  /// Проекты, встречающиеся в истории, по алфавиту
+  Future<List<String>> listProjects() async {
+    await init();
+    final projects = <String>{
+      for (final e in _entries)
+        if (e.project != null && e.project!.trim().isNotEmpty) e.project!.trim(),
+    }.toList();
+    projects.sort((a, b) => a.toLowerCase().compareTo(b.toLowerCase()));
+    return projects;
+  }
+
+  static const int csvSnippetLength = 200;
+
+  /// Экспортирует историю в CSV для отчётов: по строке на запись, от старых к новым.
+  /// [costOf] оценивает стоимость записи (например, через LLMService.estimateCost);
+  /// если он не задан или цена неизвестна, колонка стоимости остаётся пустой.
+  /// Файл пишется в UTF-8 с BOM, чтобы Excel правильно показал кириллицу.
+  Future<void> exportToCsv(String destPath, {CostEstimate Function(GenerationHistory entry)? costOf}) async {
+    await init();
+    final rows = <List<Object?>>[
+      ['timestamp', 'template', 'model', 'prompt_tokens', 'completion_tokens', 'total_tokens',
+        'estimated_cost', 'currency', 'output_snippet'],
+    ];
+    final sorted = List.of(_entries)..sort((a, b) => a.timestamp.compareTo(b.timestamp));
+    for (final e in sorted) {
+      final input = e.metadata?.inputTokens;
+      final output = e.metadata?.outputTokens;
+      CostEstimate? cost;
+      if (costOf != null) {
+        try {
+          cost = costOf(e);
+        } catch (_) {
+          cost = null; // модель без цены
+        }
+      }
+      final text = e.generatedTz.replaceAll(RegExp(r'\s+'), ' ').trim();
+      rows.add([
+        e.timestamp.toIso8601String(),
+        e.metadata?.templateName,
+        e.model,
+        input,
+        output,
+        input != null && output != null ? input + output : null,
+        cost?.total.toStringAsFixed(6),
+        cost?.currency,
+        text.length > csvSnippetLength ? '${text.substring(0, csvSnippetLength)}…' : text,
+      ]);
+    }
+    final csv = rows.map((r) => r.map(_csvField).join(',')).join('\r\n');
+    await writeStringAtomically(File(destPath), '\uFEFF$csv\r\n');
+  }
+
+  // Поле CSV по RFC 4180: кавычки, запятые и переводы строк — в двойных кавычках
+  static String _csvField(Object? value) {
+    final text = value?.toString() ?? '';
+    if (!text.contains(RegExp(r'[",\r\n]'))) return text;
+    return '"${text.replaceAll('"', '""')}"';
+  }
+
+  GenerationHistory? getEntry(String historyId) {
+    for (final e in _entries) {
+      if (e.id == historyId) return e;
+    }
+    return null;
+  }
+
+  /// Метаданные генерации (модель, шаблон, оценка токенов, ввод пользователя)
+  Future<GenerationMetadata?> getGenerationMetadata(String historyId) async {
+    await init();
+    return getEntry(historyId)?.metadata;
+  }
+}
@@ -0,0 +1,68 @@
+import 'dart:io';
+import 'package:dio/dio.dart';
+import 'package:dio/io.dart';
+import '../models/app_config.dart';
+import 'error_log_service.dart';
+
+/// Ошибка загрузки пользовательского набора корневых сертификатов
+class CaCertificateException implements Exception {
+  final String message;
+  const CaCertificateException(this.message);
+
+  @override
+  String toString() => message;
+}
+
+/// Контекст TLS, доверяющий системным корневым сертификатам и сертификатам
+/// из PEM-файла [path]. Бросает [CaCertificateException], если файла нет или
+/// в нём нет ни одного корректного сертификата.
+SecurityContext loadCaBundle(String path) {
+  final file = File(path);
+  if (!file.existsSync()) {
+    throw CaCertificateException('Файл сертификатов не найден: $path');
+  }
+  final bytes = file.readAsBytesSync();
+  if (!String.fromCharCodes(bytes).contains('-----BEGIN CERTIFICATE-----')) {
+    throw CaCertificateException('В файле $path нет сертификатов в формате PEM');
+  }
+  try {
+    return SecurityContext(withTrustedRoots: true)..setTrustedCertificatesBytes(bytes);
+  } on TlsException catch (e) {
+    throw CaCertificateException('Не удалось загрузить сертификаты из $path: ${e.message}');
+  }
+}
+
+/// Настройка TLS для HTTP-клиентов LLM-провайдеров.
+///
+/// [AppConfig.caCertPath] добавляет корпоративные корневые сертификаты к системным.
+/// [AppConfig.insecureSkipVerify] отключает проверку сертификата — только для
+/// внутренних шлюзов с самоподписанным сертификатом. Включается лишь явно;
+/// при каждом применении в журнал пишется предупреждение.
+void configureTls(Dio dio, AppConfig config) {
+  final caPath = config.caCertPath?.trim();
+  if (config.insecureSkipVerify != true) {
+    if (caPath == null || caPath.isEmpty) return;
+    try {
+      final context = loadCaBundle(caPath);
+      dio.httpClientAdapter = IOHttpClientAdapter(createHttpClient: () => HttpClient(context: context));
+    } on CaCertificateException catch (e) {
+      // Файл мог пропасть после сохранения настроек: запросы завершаются понятной
+      // ошибкой, а не падением при создании провайдера
+      ErrorLogService().record('security', e.message);
+      dio.interceptors.add(InterceptorsWrapper(
+        onRequest: (options, handler) => handler.reject(
+          DioException(requestOptions: options, error: e, message: e.message),
+        ),
+      ));
+    }
+    return;
+  }
+
+  const warning = 'ВНИМАНИЕ: проверка TLS-сертификатов отключена (insecureSkipVerify). '
+      'Соединение с API не защищено от перехвата — используйте только для доверенных внутренних шлюзов';
+  ErrorLogService().record('security', warning);
+
+  dio.httpClientAdapter = IOHttpClientAdapter(
+    createHttpClient: () => HttpClient()..badCertificateCallback = (cert, host, port) => true,
+  );
+}
@@ -0,0 +1,22 @@
+import '../models/chat_message.dart';
+import '../models/llm_response.dart';
+
+/// Interface for providers that accept a full multi-turn conversation
+/// (system / user / assistant messages) instead of a single user prompt.
+abstract class LLMChatProvider {
+  /// Sends [messages] as-is and returns the assistant reply.
+  Future<String> sendMessages({
+    required List<ChatMessage> messages,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+  });
+
+  /// Like [sendMessages], but also returns usage and finish reason of this request.
+  Future<LLMResponse> sendMessagesDetailed({
+    required List<ChatMessage> messages,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+  });
+}
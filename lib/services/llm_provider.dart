@@ -1,12 +1,30 @@
+import 'package:dio/dio.dart';
+import '../models/finish_reason.dart';
+import '../models/llm_response.dart';
+
 /// Абстрактный провайдер LLM
 abstract class LLMProvider {
-  /// Отправляет запрос к LLM провайдеру
+  /// Отправляет запрос к LLM провайдеру. [cancelToken] прерывает HTTP-запрос
+  /// (лимит времени генерации, отмена пакета), а не только ожидание ответа.
   Future<String> sendRequest({
     required String systemPrompt,
     required String userPrompt,
     String? model,
     int? maxTokens,
     double? temperature,
+    CancelToken? cancelToken,
+  });
+
+  /// Как [sendRequest], но возвращает ответ вместе с расходом токенов и причиной
+  /// завершения этого запроса. Для параллельных запросов через один провайдер
+  /// вместо чтения [lastFinishReason] после await.
+  Future<LLMResponse> sendRequestDetailed({
+    required String systemPrompt,
+    required String userPrompt,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+    CancelToken? cancelToken,
   });
   
   /// Получает список доступных моделей
@@ -26,4 +44,7 @@ abstract class LLMProvider {
   
   /// Получает ошибку, если есть
   String? get error;
+
+  /// Причина завершения последнего ответа (null, если провайдер её не сообщает)
+  FinishReason? get lastFinishReason;
 }
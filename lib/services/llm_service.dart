@@ -1,17 +1,69 @@
+import 'dart:async';
+import 'dart:convert';
+import 'dart:io';
+import 'dart:math' as math;
+import 'package:dio/dio.dart' show CancelToken;
 import 'package:flutter/foundation.dart';
 import '../models/app_config.dart';
+import '../models/openai_model.dart';
+import '../models/verbosity.dart';
 import '../models/output_format.dart';
 import '../exceptions/content_processing_exceptions.dart';
+import '../exceptions/llm_exceptions.dart';
+import '../utils/output_filters.dart';
 import 'llm_provider.dart';
 import 'openai_provider.dart';
 import 'llmops_provider.dart';
 import 'cerebras_provider.dart';
 import 'groq_provider.dart';
-// import 'llm_streaming_provider.dart'; // kept for future conditional logic (currently unused explicitly)
+import 'llm_vision_provider.dart';
+import 'llm_chat_provider.dart';
+import 'llm_structured_output_provider.dart';
+import '../models/chat_message.dart';
+import '../models/model_comparison.dart';
+import '../models/generation_plan.dart';
+import '../models/finish_reason.dart';
+import '../models/generation_result.dart';
+import '../models/endpoint_capabilities.dart';
+import '../models/rate_limit_status.dart';
+import '../models/cost_estimate.dart';
+import '../models/token_usage.dart';
+import '../models/llm_response.dart';
+import '../utils/continuation_merge.dart';
+import '../utils/model_capabilities.dart';
+import '../utils/connection_errors.dart';
+import '../utils/token_estimator.dart';
+import '../utils/messages.dart';
+import '../utils/json_schema.dart';
+import '../utils/reasoning.dart';
+import '../utils/concurrency.dart';
+import '../utils/pii_redaction.dart';
+import '../utils/template_renderer.dart';
+import '../utils/truncation.dart';
+import '../utils/logit_bias.dart';
+import '../utils/document_headings.dart';
+import '../utils/context_files.dart';
+import '../utils/table_of_contents.dart';
+import '../models/llm_stream_chunk.dart';
+import 'llm_streaming_provider.dart';
+import 'error_log_service.dart';
+import 'request_abort_registry.dart';
 
 class LLMService extends ChangeNotifier {
   LLMProvider? _provider;
   AppConfig? _config;
+
+  // Кеш списка моделей: пикер перерисовывается часто, а запрос к API медленный
+  List<String>? _cachedModels;
+  DateTime? _modelsFetchedAt;
+
+  // Результаты проб потоковой генерации для моделей, отсутствующих в таблице возможностей
+  final Map<String, bool> _streamingProbeResults = {};
+  // Незавершённые пробы: повторный запрос той же модели ждёт уже отправленную пробу
+  final Map<String, Future<bool>> _streamingProbesInFlight = {};
+
+  // Пробы платные, поэтому одновременно выполняется не больше нескольких
+  static const int _maxConcurrentStreamingProbes = 3;
   
   // Системный промт для ревью шаблонов
   static const String templateReviewPrompt = '''
@@ -19,15 +71,35 @@ class LLMService extends ChangeNotifier {
 Обязательно выдели есть ли КРИТИЧЕСКИЕ замечания к шаблону. При наличии критических замечаний введи в ответ текст "[CRITICAL_ALERT]"
 ''';
   
+  /// Оценщик токенов для проверки размера запроса и плана генерации;
+  /// можно заменить более точной реализацией [TokenEstimator]
+  TokenEstimator tokenEstimator = const HeuristicTokenEstimator();
+
   LLMProvider? get provider => _provider;
+  String? get defaultModel => _config?.defaultModel; // модель генерации по умолчанию
   bool get isLoading => _provider?.isLoading ?? false;
   String? get error => _provider?.error;
+
+  /// Причина завершения последнего ответа (например, [FinishReason.length] — можно продолжить генерацию)
+  FinishReason? get lastFinishReason => _provider?.lastFinishReason;
   List<String> get availableModels => _provider?.availableModels ?? [];
   bool get hasModels => _provider?.hasModels ?? false;
+
+  /// «Остановить всё»: отменяет все выполняющиеся запросы к провайдеру
+  /// (генерации, проверку соединения, загрузку моделей). Следующие запросы
+  /// выполняются как обычно.
+  void abortAll() {
+    RequestAbortRegistry().abortAll();
+    notifyListeners();
+  }
   
   /// Инициализирует провайдер на основе конфигурации
   void initializeProvider(AppConfig config) {
     _config = config;
+    setUiLanguage(config.uiLanguage);
+    _invalidateModelsCache(); // новая конфигурация — другой провайдер или ключ
+    _streamingProbeResults.clear();
+    _streamingProbesInFlight.clear();
     
     print('LLMService: Initializing provider for: ${config.provider}');
     
@@ -50,211 +122,1889 @@ class LLMService extends ChangeNotifier {
         print('LLMService: Initialized OpenAIProvider');
         break;
     }
-    
-    notifyListeners();
+    
+    notifyListeners();
+  }
+
+  /// Подключает готовый провайдер вместо создаваемого по [AppConfig.provider] —
+  /// для тестов без сетевых запросов
+  @visibleForTesting
+  void initializeWithProvider(LLMProvider provider, AppConfig config) {
+    _config = config;
+    _provider = provider;
+    _invalidateModelsCache();
+    _streamingProbeResults.clear();
+    _streamingProbesInFlight.clear();
+  }
+
+  List<String> _lastRedactions = const [];
+  List<String> _lastGenerationWarnings = const [];
+
+  /// Некритичные предупреждения последней генерации (например, устаревшая модель);
+  /// генерацию они не прерывают
+  List<String> get lastGenerationWarnings => _lastGenerationWarnings;
+
+  /// Значения, скрытые маскированием персональных данных в последнем запросе
+  /// (чтобы UI показал пользователю, что не было отправлено)
+  List<String> get lastRedactions => List.unmodifiable(_lastRedactions);
+
+  // Обработка Confluence-маркеров и, если включено в настройках, маскирование ПДн
+  String _prepareInput(String text, {bool resetRedactions = false}) {
+    if (resetRedactions) _lastRedactions = const [];
+    final processed = processConfluenceContent(text);
+    if (_config?.redactPii != true) return processed;
+    final result = redactPii(processed);
+    if (result.hasRedactions) _lastRedactions = [..._lastRedactions, ...result.redacted];
+    return result.text;
+  }
+
+  /// Готовит к отправке текст пользователя вне генерации ТЗ (например, реплику диалога):
+  /// раскрывает Confluence-маркеры и маскирует ПДн так же, как ввод генерации.
+  /// Скрытые значения попадают в [lastRedactions].
+  String prepareUserInput(String text) => _prepareInput(text, resetRedactions: true);
+
+  /// Public helper to build prompts (system + user) for streaming generation
+  /// without performing the actual provider request. Reuses validation logic.
+  /// Returns a map { 'system': ..., 'user': ... }.
+  Map<String, String> buildGenerationPrompts({
+    required String rawRequirements,
+    String? changes,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+  bool forStreaming = false,
+    List<String> promptSnippets = const [],
+    String? model, // для системного промта модели из AppConfig.systemPromptOverrides
+  }) {
+    _validateServiceState();
+
+    final processedRawRequirements = _prepareInput(rawRequirements, resetRedactions: true);
+    final processedChanges = changes != null ? _prepareInput(changes) : null;
+    validateGenerationParameters(processedRawRequirements, format, templateContent);
+
+    if (forStreaming) {
+      final streamingSystem = _buildStreamingSystemPrompt(
+        templateContent: templateContent,
+        format: format,
+      );
+      final streamingUser = _buildStreamingUserPrompt(
+        requirements: processedRawRequirements,
+        changes: processedChanges,
+        format: format,
+      );
+      return {
+        'system': withPromptSnippets(_withAcceptanceCriteria(streamingSystem, format), promptSnippets),
+        'user': streamingUser,
+      };
+    } else {
+      // Build system prompt (legacy non-stream markers)
+      final systemPrompt = _systemPromptFor(format, templateContent, model);
+      final userPrompt = _buildUserPrompt(processedRawRequirements, processedChanges, format);
+      return {
+        'system': withPromptSnippets(_withAcceptanceCriteria(systemPrompt, format), promptSnippets),
+        'user': userPrompt,
+      };
+    }
+  }
+
+  /// Системный промт генерации: переопределение для модели из
+  /// [AppConfig.systemPromptOverrides] или стандартный промт формата
+  String _systemPromptFor(OutputFormat format, String? templateContent, String? model) {
+    final modelId = model ?? _config?.defaultModel;
+    final override = modelId == null ? null : _config?.systemPromptOverrides?[modelId];
+    if (override is String && override.trim().isNotEmpty) {
+      return _applySystemPromptOverride(override.trim(), templateContent, format);
+    }
+    switch (format) {
+      case OutputFormat.markdown:
+        return _buildMarkdownSystemPrompt(templateContent);
+      case OutputFormat.confluence:
+        return _buildConfluenceSystemPrompt(templateContent);
+    }
+  }
+
+  // Шаблон подставляется вместо {{template}} или добавляется в конец; требование
+  // маркеров добавляется, если его нет в тексте — без маркеров ответ не пройдёт проверку
+  String _applySystemPromptOverride(String override, String? templateContent, OutputFormat format) {
+    final template = _withBuiltInVariables(templateContent)?.trim() ?? '';
+    final placeholder = RegExp(r'\{\{\s*template\s*\}\}');
+    var prompt = placeholder.hasMatch(override)
+        ? override.replaceAll(placeholder, template)
+        : (template.isEmpty ? override : '$override\n\nШаблон:\n$template');
+    if (format == OutputFormat.markdown && !prompt.contains('@@@START@@@')) {
+      prompt += '\n\nОбязательно оберни весь ответ в маркеры @@@START@@@ и @@@END@@@ '
+          'и ничего не пиши до и после них.';
+    }
+    return prompt;
+  }
+
+  // {{today}}, {{datetime}}, {{uuid}} заполняются до отправки шаблона модели
+  String? _withBuiltInVariables(String? templateContent) {
+    if (templateContent == null || templateContent.isEmpty) return templateContent;
+    return applyBuiltInVariables(templateContent, dateFormat: _config?.dateFormat);
+  }
+
+  /// Streaming system prompt (NDJSON spec, no @@@ markers)
+  String _buildStreamingSystemPrompt({
+    required String? templateContent,
+    required OutputFormat format,
+  }) {
+    final formatLabel = format == OutputFormat.markdown ? 'Markdown' : 'HTML (Confluence)';
+    templateContent = _withBuiltInVariables(templateContent);
+    final nowIso = DateTime.now().toUtc().toIso8601String();
+    final templateHint = (templateContent == null || templateContent.trim().isEmpty)
+        ? '(нет активного шаблона — структура на усмотрение модели)'
+        : templateContent.trim();
+    return '''Ты ИИ-помощник по созданию технического задания. Отвечай СТРОГО стримом NDJSON. Каждая строка — одиночный валидный JSON без текста вне JSON.
+
+ФАЗЫ: init → plan → structure → draft_sections → refine → validate → finalize.
+
+ФОРМАТ ВЫВОДА: $formatLabel (структура и заголовки внутри текста чанков).
+
+ПРАВИЛА СТРИМА:
+1. Первая строка: {"stream_type":"status","phase":"init","progress":0,"message":"Инициализация","ts":"<ISO8601>"}
+2. Вторая строка: пустой контент: {"stream_type":"content","append":""}
+3. Используй преимущественно append с небольшими логическими фрагментами. При крупной переработке допускается full.
+4. НИКОГДА не используй ключи разделов — только текст.
+5. Прогресс растёт монотонно. Финальная строка: {"stream_type":"final","progress":100,"message":"Готово","summary":"..."}
+6. Без плейсхолдеров и заглушек.
+7. Только один JSON на строку.
+
+КОНТУР ШАБЛОНА (ориентир):
+$templateHint
+
+ЗАДАЧА: Постепенно сгенерировать цельное, отредактированное ТЗ высокого качества. Время запроса: $nowIso.''';
+  }
+
+  /// Streaming user prompt (no legacy markers)
+  String _buildStreamingUserPrompt({
+    required String requirements,
+    required String? changes,
+    required OutputFormat format,
+  }) {
+    final formatInstr = format == OutputFormat.markdown
+        ? 'Форматируй в Markdown без HTML. ${_markdownFlavorInstruction()}'
+        : 'Форматируй в допустимом Confluence Storage HTML.';
+    final b = StringBuffer()
+      ..writeln('Требования для ТЗ:\n\n$requirements');
+    if (changes != null && changes.isNotEmpty) {
+      b.writeln('\nИзменения / уточнения:\n\n$changes');
+    }
+    b..writeln('\n$formatInstr')
+     ..writeln('Начинай поток немедленно, соблюдая протокол фаз.');
+    return b.toString();
+  }
+  
+  // Проверка подключения повторяется при временных сбоях (холодный шлюз, сетевой сбой),
+  // чтобы пользователь не решил, что ключ неверный
+  static const int _connectionAttempts = 3;
+  static const Duration _connectionRetryDelay = Duration(milliseconds: 500);
+
+  ConnectionFailureKind? _lastConnectionFailure;
+
+  /// Тип последней неудачной проверки подключения (null — проверка прошла или не выполнялась)
+  ConnectionFailureKind? get lastConnectionFailure => _lastConnectionFailure;
+
+  /// Понятное пользователю описание последней ошибки подключения
+  String? get connectionErrorMessage {
+    final details = error;
+    switch (_lastConnectionFailure) {
+      case ConnectionFailureKind.auth:
+        return 'Ошибка аутентификации: проверьте API-ключ${details != null ? ' ($details)' : ''}';
+      case ConnectionFailureKind.transient:
+        return 'Сервис временно недоступен, повторите попытку позже${details != null ? ' ($details)' : ''}';
+      case ConnectionFailureKind.other:
+        return details;
+      case null:
+        return null;
+    }
+  }
+
+  /// Тестирует соединение с провайдером
+  Future<bool> testConnection() async {
+    if (_provider == null) return false;
+    _lastConnectionFailure = null;
+
+    var delay = _connectionRetryDelay;
+    for (var attempt = 1; ; attempt++) {
+      final result = await _provider!.testConnection();
+      if (result) break;
+
+      final kind = classifyConnectionError(_provider!.error);
+      if (kind != ConnectionFailureKind.transient || attempt >= _connectionAttempts) {
+        _lastConnectionFailure = kind;
+        ErrorLogService().record('connection', _provider!.error ?? 'connection test failed');
+        notifyListeners();
+        return false;
+      }
+      print('LLMService: transient connection error on attempt $attempt, retrying...');
+      await Future.delayed(delay);
+      delay *= 2; // Exponential backoff
+    }
+
+    notifyListeners();
+    return true;
+  }
+  
+  /// Проверка ключа запросом генерации на 1 токен — для ключей без доступа к /models.
+  /// Поддерживается провайдером OpenAI-совместимого API; для остальных используется [testConnection].
+  Future<bool> validateKeyByCompletion(String? model) async {
+    final provider = _provider;
+    if (provider is! OpenAIProvider) return testConnection();
+    final ok = await provider.validateKeyByCompletion(model);
+    _lastConnectionFailure = ok ? null : classifyConnectionError(provider.error);
+    notifyListeners();
+    return ok;
+  }
+
+  static const Duration _defaultModelsCacheTtl = Duration(seconds: 60);
+
+  Duration get _modelsCacheTtl {
+    final seconds = _config?.modelsCacheTtlSeconds;
+    return seconds == null ? _defaultModelsCacheTtl : Duration(seconds: seconds < 0 ? 0 : seconds);
+  }
+
+  void _invalidateModelsCache() {
+    _cachedModels = null;
+    _modelsFetchedAt = null;
+  }
+
+  /// Получает список доступных моделей (из кеша, если он ещё не устарел)
+  Future<List<String>> getModels() async {
+    if (_provider == null) {
+      print('LLMService: getModels called but provider is null');
+      return [];
+    }
+
+    final fetchedAt = _modelsFetchedAt;
+    if (_cachedModels != null && fetchedAt != null && DateTime.now().difference(fetchedAt) < _modelsCacheTtl) {
+      return _cachedModels!;
+    }
+    return refreshModels();
+  }
+
+  /// Проверяет, что выбранная модель ([model] или модель по умолчанию из
+  /// конфигурации) есть в (кешированном) списке моделей провайдера.
+  /// Отсутствие модели — не ошибка: возвращается false, чтобы UI предложил
+  /// выбрать другую до генерации. Ошибки запроса списка пробрасываются.
+  Future<bool> isSelectedModelAvailable({String? model}) async {
+    final selected = model ?? _config?.defaultModel;
+    if (selected == null || selected.isEmpty) return false;
+    final models = await getModels();
+    return models.contains(selected);
+  }
+
+  /// Список моделей: сначала избранные (в заданном порядке), затем остальные по алфавиту.
+  /// [favorites] по умолчанию берутся из конфигурации провайдера.
+  Future<List<String>> getModelsOrdered({List<String>? favorites}) async {
+    final models = await getModels();
+    final favs = favorites ?? _config?.favoriteModels ?? const [];
+    final available = models.toSet();
+    final ordered = favs.where(available.contains).toList();
+    final rest = models.where((m) => !ordered.contains(m)).toList()..sort();
+    return [...ordered, ...rest];
+  }
+
+  /// Модели, сгруппированные по владельцу (`owned_by`: openai, meta, своя организация) —
+  /// длинный список легче просматривать. Внутри группы сохраняется порядок [getModels];
+  /// модели без владельца попадают в группу с именем провайдера.
+  Future<Map<String, List<OpenAIModel>>> getModelsGroupedByOwner() async {
+    final models = await getModels();
+    final provider = _provider;
+    final fallbackOwner = _config?.provider ?? 'other';
+    final groups = <String, List<OpenAIModel>>{};
+    for (final id in models) {
+      final model = (provider is OpenAIProvider ? provider.cachedModel(id) : null) ??
+          OpenAIModel(id: id, object: 'model', created: 0, ownedBy: '');
+      final owner = model.ownedBy.trim().isEmpty ? fallbackOwner : model.ownedBy.trim();
+      groups.putIfAbsent(owner, () => []).add(model);
+    }
+    return groups;
+  }
+
+  /// true, если модель отмечена устаревшей в [AppConfig.deprecatedModels]
+  bool isModelDeprecated(String model) =>
+      _config?.deprecatedModels?.any((m) => m.trim() == model.trim()) ?? false;
+
+  /// Модели без устаревших — для выбора модели. [includeDeprecated] возвращает полный
+  /// список, чтобы UI показал устаревшие модели неактивными (см. [isModelDeprecated]).
+  Future<List<String>> getActiveModels({bool includeDeprecated = false}) async {
+    final models = await getModelsOrdered();
+    if (includeDeprecated) return models;
+    return models.where((m) => !isModelDeprecated(m)).toList();
+  }
+
+  /// Быстрая проверка доступности провайдера для индикатора статуса.
+  /// Ограничена коротким таймаутом; при недоступности бросает исключение.
+  Future<void> ping() async {
+    final provider = _provider;
+    if (provider == null) {
+      throw StateError('LLM provider is not initialized');
+    }
+    if (provider is OpenAIProvider) return provider.ping();
+    // У остальных провайдеров нет настраиваемого пути — проверяем соединение с тем же таймаутом
+    final ok = await provider.testConnection().timeout(OpenAIProvider.pingTimeout);
+    if (!ok) throw Exception(provider.error ?? 'Ping failed');
+  }
+
+  /// Подробности модели [id]. OpenAI-совместимый провайдер запрашивает `/models/{id}`;
+  /// остальные провайдеры возвращают только идентификатор из списка моделей.
+  Future<OpenAIModel> getModelDetails(String id) async {
+    final provider = _provider;
+    if (provider == null) {
+      throw LLMResponseValidationException(
+        localize('provider.notInitialized'),
+        '',
+        recoveryAction: localize('provider.notInitialized.recovery'),
+        technicalDetails: 'LLM provider is null',
+      );
+    }
+    if (provider is OpenAIProvider) return provider.getModel(id);
+    final models = await getModels();
+    if (!models.contains(id)) {
+      throw ArgumentError('Model with id $id not found');
+    }
+    return OpenAIModel(id: id, object: 'model', created: 0, ownedBy: _config?.provider ?? '');
+  }
+
+  /// Принудительно запрашивает список моделей у провайдера, минуя кеш
+  Future<List<String>> refreshModels() async {
+    if (_provider == null) {
+      print('LLMService: refreshModels called but provider is null');
+      return [];
+    }
+    
+    print('LLMService: Getting models for provider: ${_config?.provider}');
+    
+    final models = await _provider!.getModels();
+    
+    print('LLMService: Got ${models.length} models: $models');
+
+    // Пустой список обычно означает ошибку запроса — не кешируем его
+    if (models.isNotEmpty) {
+      _cachedModels = _withManualModels(models);
+      _modelsFetchedAt = DateTime.now();
+    } else {
+      _invalidateModelsCache();
+    }
+    
+    notifyListeners();
+
+    // Запрос прошёл без ошибки, но моделей нет — эндпоинт настроен неверно
+    final manual = _config?.manualModels ?? const [];
+    if (models.isEmpty && manual.isEmpty && _provider!.error == null) {
+      throw NoModelsAvailableException(provider: _config?.provider);
+    }
+    return _withManualModels(models);
+  }
+
+  /// Обновляет список моделей, добавленных вручную (см. ConfigService.addManualModel)
+  void setManualModels(List<String> models) {
+    if (_config == null) return;
+    _config = _config!.copyWith(manualModels: models);
+    _invalidateModelsCache(); // удалённая модель не должна остаться в кеше
+    notifyListeners();
+  }
+
+  // Дополняет список провайдера ручными моделями без дублей
+  List<String> _withManualModels(List<String> live) {
+    final manual = _config?.manualModels ?? const [];
+    if (manual.isEmpty) return live;
+    final known = live.toSet();
+    return [...live, ...manual.where(known.add)];
+  }
+  
+  /// Генерирует техническое задание.
+  /// [model] — модель только для этого запроса (например, для A/B сравнения);
+  /// сохранённая модель по умолчанию при этом не меняется.
+  /// [promptSnippets] — тексты фрагментов из библиотеки (см. PromptSnippetService.resolveSnippets),
+  /// добавляются в начало системного промта.
+  Future<String> generateTZ({
+    required String rawRequirements,
+    String? changes,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+    String? model,
+    List<String> promptSnippets = const [],
+    Verbosity verbosity = Verbosity.normal,
+    List<String> sectionOrder = const [],
+    double? temperature,
+    CancelToken? cancelToken,
+  }) async {
+    final result = await generateTZDetailed(
+      rawRequirements: rawRequirements,
+      changes: changes,
+      templateContent: templateContent,
+      format: format,
+      model: model,
+      promptSnippets: promptSnippets,
+      verbosity: verbosity,
+      sectionOrder: sectionOrder,
+      temperature: temperature,
+      cancelToken: cancelToken,
+    );
+    return result.content;
+  }
+
+  /// Генерирует ТЗ по шаблону с условными блоками `{{#if flag}}...{{/if}}`:
+  /// блоки раскрываются по [flags] до построения промта, невыполненные удаляются.
+  Future<String> generateTZWithFlags({
+    required String rawRequirements,
+    String? changes,
+    required String templateContent,
+    Map<String, bool> flags = const {},
+    OutputFormat format = OutputFormat.markdown,
+    String? model,
+  }) {
+    return generateTZ(
+      rawRequirements: rawRequirements,
+      changes: changes,
+      templateContent: applyTemplateConditions(templateContent, flags),
+      format: format,
+      model: model,
+    );
+  }
+
+  /// То же, что [generateTZ], но рассуждения модели (поле `reasoning` или
+  /// блоки `<think>`) возвращаются отдельно от ТЗ в [GenerationResult.reasoning].
+  /// [reasoningEffort] и [logitBias] переопределяют значения из [AppConfig] для этого запроса.
+  Future<GenerationResult> generateTZDetailed({
+    required String rawRequirements,
+    String? changes,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+    String? model,
+    List<String> promptSnippets = const [],
+    String? reasoningEffort,
+    Map<String, dynamic>? logitBias,
+    Verbosity verbosity = Verbosity.normal,
+    List<String> sectionOrder = const [],
+    String? additionalContext, // дополнительный контекст (например, текст приложенных файлов)
+    double? temperature, // null — значение провайдера; температуру шаблона подставляет вызывающий
+    Duration? timeout, // жёсткий лимит на эту генерацию независимо от таймаутов клиента
+    CancelToken? cancelToken, // отменяет HTTP-запрос генерации (например, при отмене пакета)
+  }) async {
+    // Validate service state
+    _validateServiceState();
+    if (model != null) await _validateModelAvailable(model);
+    _lastGenerationWarnings = const [];
+    final modelId = model ?? _config!.defaultModel;
+    if (modelId != null && isModelDeprecated(modelId)) {
+      // Модель ещё работает, но её скоро уберут — предупреждаем заранее
+      final warning = 'Модель "$modelId" отмечена как устаревшая: выберите другую, пока провайдер её не отключил';
+      _lastGenerationWarnings = [warning];
+      ErrorLogService().record('models', warning);
+    }
+    
+    // Process Confluence content markers before validation
+    final processedRawRequirements = _prepareInput(rawRequirements, resetRedactions: true);
+    final processedChanges = changes != null ? _prepareInput(changes) : null;
+    final processedContext = additionalContext != null && additionalContext.trim().isNotEmpty
+        ? _prepareInput(additionalContext)
+        : null;
+    
+    // Validate input parameters with processed content
+    validateGenerationParameters(processedRawRequirements, format, templateContent);
+    
+    // Generate format-specific system prompt
+    String systemPrompt;
+    try {
+      systemPrompt = _systemPromptFor(format, templateContent, model);
+    } catch (e) {
+      throw LLMResponseValidationException(
+        'Ошибка при создании системного промта для формата ${format.displayName}',
+        '',
+        recoveryAction: 'Проверьте шаблон и попробуйте другой формат',
+        technicalDetails: e.toString(),
+      );
+    }
+    systemPrompt = withPromptSnippets(
+      withVerbosity(_withAcceptanceCriteria(systemPrompt, format), verbosity),
+      promptSnippets,
+    );
+    final reorder = sectionOrder.isNotEmpty && templateContent != null && templateContent.trim().isNotEmpty;
+    if (reorder) systemPrompt = withSectionOrder(systemPrompt, sectionOrder);
+    
+    // Формируем пользовательский промт с обработанным контентом
+    String userPrompt;
+    try {
+      userPrompt = _buildUserPrompt(processedRawRequirements, processedChanges, format, context: processedContext);
+    } catch (e) {
+      throw LLMResponseValidationException(
+        'Ошибка при создании пользовательского промта',
+        '',
+        recoveryAction: 'Проверьте введенные требования и попробуйте снова',
+        technicalDetails: e.toString(),
+      );
+    }
+    
+    var result = await _runGenerationDetailed(
+      systemPrompt: systemPrompt,
+      userPrompt: userPrompt,
+      format: format,
+      model: model,
+      reasoningEffort: reasoningEffort,
+      logitBias: logitBias,
+      temperature: temperature,
+      timeout: timeout,
+      cancelToken: cancelToken,
+    );
+    if (reorder) {
+      // Модель писала разделы в порядке приоритета — возвращаем раскладку шаблона
+      result = result.withContent(_restoreTemplateLayout(result.content, templateContent));
+    }
+    if (_config!.appendAcceptanceCriteria == true && !hasAcceptanceCriteria(result.content)) {
+      // Модель пропустила раздел — догенерируем только критерии по готовому ТЗ
+      final content = await _appendAcceptanceCriteria(result.content, format, model);
+      result = result.withContent(content);
+    }
+    // Оглавление строится последним, чтобы в него попали все разделы
+    if (_config!.prependTableOfContents == true && format == OutputFormat.markdown) {
+      result = result.withContent(prependTableOfContents(result.content));
+    }
+    return result;
+  }
+
+  /// Оглавление со ссылками на разделы Markdown-документа [content] (якоря в стиле GitHub,
+  /// кириллица сохраняется). Бросает [ArgumentError], если в документе нет заголовков.
+  String generateTableOfContents(String content) {
+    final start = content.indexOf('@@@START@@@');
+    final end = content.indexOf('@@@END@@@');
+    final body = start >= 0 && end > start ? content.substring(start + '@@@START@@@'.length, end) : content;
+    return buildTableOfContents(body);
+  }
+
+  /// Генерирует ТЗ с текстом файлов [filePaths] (.txt/.md) как дополнительным контекстом.
+  /// Неподдерживаемые и двоичные файлы не прерывают генерацию, а возвращаются в rejected;
+  /// included — файлы, реально попавшие в запрос. Если подходящих файлов нет — ArgumentError.
+  Future<({String content, List<String> included, Map<String, String> rejected})> generateTZWithFiles({
+    required String rawRequirements,
+    required List<String> filePaths,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+    String? model,
+  }) async {
+    final files = await readContextFiles(filePaths);
+    for (final entry in files.rejected.entries) {
+      ErrorLogService().record('context-files', '${entry.key}: ${entry.value}');
+    }
+    if (filePaths.isNotEmpty && files.included.isEmpty) {
+      throw ArgumentError('None of the files can be used as context: '
+          '${files.rejected.entries.map((e) => '${e.key} (${e.value})').join('; ')}');
+    }
+    final result = await generateTZDetailed(
+      rawRequirements: rawRequirements,
+      templateContent: templateContent,
+      format: format,
+      model: model,
+      additionalContext: files.text,
+    );
+    return (content: result.content, included: files.included, rejected: files.rejected);
+  }
+
+  static const String acceptanceCriteriaTitle = 'Критерии приёмки';
+
+  // Требование раздела критериев приёмки, если оно включено в настройках
+  String _withAcceptanceCriteria(String systemPrompt, OutputFormat format) {
+    if (_config?.appendAcceptanceCriteria != true) return systemPrompt;
+    final heading = format == OutputFormat.markdown
+        ? '## $acceptanceCriteriaTitle'
+        : '<h2>$acceptanceCriteriaTitle</h2>';
+    return '$systemPrompt\n\n'
+        'ОБЯЗАТЕЛЬНО: последним разделом документа должен идти раздел "$heading" '
+        'с критериями в формате Gherkin (Given / When / Then) — по одному сценарию на каждое проверяемое требование.';
+  }
+
+  /// true, если в документе есть раздел «Критерии приёмки» (в том числе через «е»)
+  static bool hasAcceptanceCriteria(String document) {
+    final key = normalizeHeadingTitle(acceptanceCriteriaTitle);
+    return extractHeadings(document).any((h) => normalizeHeadingTitle(h.title).contains(key));
+  }
+
+  // Второй проход: критерии приёмки по готовому ТЗ, вставляются перед @@@END@@@
+  Future<String> _appendAcceptanceCriteria(String document, OutputFormat format, String? model) async {
+    final isMarkdown = format == OutputFormat.markdown;
+    final systemPrompt = 'Ты аналитик. По техническому заданию составь ТОЛЬКО раздел '
+        '"${isMarkdown ? '## $acceptanceCriteriaTitle' : '<h2>$acceptanceCriteriaTitle</h2>'}" '
+        'со сценариями в формате Gherkin (Given / When / Then). '
+        '${isMarkdown ? 'Формат — Markdown, сценарии в блоках ```gherkin.' : 'Формат — Confluence Storage Format (HTML).'} '
+        'Без вступлений и без маркеров.';
+    final userPrompt = _stripContentMarkers(document);
+    String criteria;
+    try {
+      final response = await _provider!.sendRequestDetailed(
+        systemPrompt: systemPrompt,
+        userPrompt: userPrompt,
+        model: model ?? _config!.defaultModel,
+      );
+      criteria = response.content;
+      _recordSessionUsage(systemPrompt, userPrompt, criteria, model, usage: response.usage, countGeneration: false);
+    } catch (e) {
+      // ТЗ уже готово — без критериев его всё равно можно использовать
+      ErrorLogService().record('acceptance-criteria', e);
+      return document;
+    }
+    criteria = _stripContentMarkers(splitReasoning(criteria).content);
+    if (criteria.isEmpty) return document;
+
+    const endMarker = '@@@END@@@';
+    final end = document.lastIndexOf(endMarker);
+    if (end < 0) return '${document.trimRight()}\n\n$criteria';
+    return '${document.substring(0, end).trimRight()}\n\n$criteria\n${document.substring(end)}';
+  }
+
+  /// Добавляет к системному промту указание о степени детализации;
+  /// [Verbosity.normal] оставляет промт без изменений
+  static String withVerbosity(String systemPrompt, Verbosity verbosity) {
+    final instruction = verbosity.promptInstruction;
+    if (instruction == null) return systemPrompt;
+    return '$systemPrompt\n\nДЕТАЛИЗАЦИЯ: $instruction';
+  }
+
+  /// Просит модель писать разделы в порядке [sectionOrder] (заголовки шаблона).
+  /// Раскладка шаблона в готовом документе восстанавливается после генерации.
+  static String withSectionOrder(String systemPrompt, List<String> sectionOrder) {
+    final titles = sectionOrder.map((t) => t.trim()).where((t) => t.isNotEmpty).toList();
+    if (titles.isEmpty) return systemPrompt;
+    final list = [for (var i = 0; i < titles.length; i++) '${i + 1}. ${titles[i]}'].join('\n');
+    return '$systemPrompt\n\nПОРЯДОК РАЗДЕЛОВ: сначала полностью напиши эти разделы, '
+        'в указанном порядке, затем остальные разделы шаблона:\n$list';
+  }
+
+  // Переставляет разделы ответа в порядок шаблона; для Markdown — только текст между маркерами
+  String _restoreTemplateLayout(String text, String templateContent) {
+    final titles = splitTopLevelSections(templateContent).map((s) => s.title).toList();
+    if (titles.isEmpty) return text;
+    const startMarker = '@@@START@@@';
+    const endMarker = '@@@END@@@';
+    final start = text.indexOf(startMarker);
+    final end = text.indexOf(endMarker);
+    if (start >= 0 && end > start) {
+      final inner = text.substring(start + startMarker.length, end);
+      return text.substring(0, start + startMarker.length) +
+          reorderTopLevelSections(inner, titles) +
+          text.substring(end);
+    }
+    return reorderTopLevelSections(text, titles);
+  }
+
+  /// Добавляет фрагменты из библиотеки промтов перед системным промтом
+  static String withPromptSnippets(String systemPrompt, List<String> snippets) {
+    final parts = snippets.map((s) => s.trim()).where((s) => s.isNotEmpty).toList();
+    if (parts.isEmpty) return systemPrompt;
+    return 'ДОПОЛНИТЕЛЬНЫЕ ИНСТРУКЦИИ:\n${parts.map((p) => '- $p').join('\n')}\n\n$systemPrompt';
+  }
+
+  /// Генерирует одно и то же ТЗ несколькими моделями параллельно для сравнения.
+  /// Ошибка отдельной модели попадает в её [ModelComparison.error] и не
+  /// прерывает остальные генерации.
+  Future<List<ModelComparison>> compareModels({
+    required String rawRequirements,
+    required List<String> models,
+    String? changes,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+  }) async {
+    _validateServiceState();
+    // Для моделей, завершившихся ошибкой, вход оценивается по полному промту с шаблоном;
+    // системный промт у модели может быть свой (systemPromptOverrides)
+    int? promptTokensFor(String model) {
+      try {
+        final prompts = buildGenerationPrompts(
+          rawRequirements: rawRequirements,
+          changes: changes,
+          templateContent: templateContent,
+          format: format,
+          model: model,
+        );
+        return tokenEstimator.estimate('${prompts['system']}\n${prompts['user']}', model: model);
+      } catch (_) {
+        // Некорректный ввод: та же ошибка вернётся для каждой модели из generateTZDetailed
+        return null;
+      }
+    }
+
+    Future<ModelComparison> runOne(String model) async {
+      final stopwatch = Stopwatch()..start();
+      try {
+        final result = await generateTZDetailed(
+          rawRequirements: rawRequirements,
+          changes: changes,
+          templateContent: templateContent,
+          format: format,
+          model: model,
+        );
+        return ModelComparison(
+          model: model,
+          output: result.content,
+          latency: stopwatch.elapsed,
+          inputTokens: result.usage?.inputTokens ?? promptTokensFor(model),
+          outputTokens: result.usage?.outputTokens ?? tokenEstimator.estimate(result.content, model: model),
+          estimated: result.usage?.estimated ?? true,
+        );
+      } catch (e) {
+        final message = e is LLMResponseValidationException ? e.message : e.toString();
+        return ModelComparison(
+          model: model,
+          error: message,
+          latency: stopwatch.elapsed,
+          inputTokens: promptTokensFor(model),
+          estimated: true,
+        );
+      }
+    }
+
+    final unique = models.toSet().toList();
+    return mapWithConcurrency(unique, concurrencyFor(unique.length), runOne);
+  }
+
+  static const int defaultStreamIdleTimeoutSeconds = 60;
+
+  /// Сколько ждать очередного чанка стрима; null — не ограничивать
+  Duration? get streamIdleTimeout {
+    final seconds = _config?.streamIdleTimeoutSeconds ?? defaultStreamIdleTimeoutSeconds;
+    return seconds > 0 ? Duration(seconds: seconds) : null;
+  }
+
+  static const int defaultMaxConcurrency = 3;
+
+  /// Число параллельных запросов из конфигурации (не меньше 1)
+  int get maxConcurrency {
+    final configured = _config?.maxConcurrency ?? defaultMaxConcurrency;
+    return configured < 1 ? 1 : configured;
+  }
+
+  /// Лимиты запросов по заголовкам последнего ответа (только OpenAI-совместимые шлюзы)
+  RateLimitStatus? get rateLimitStatus {
+    final provider = _provider;
+    return provider is OpenAIProvider ? provider.rateLimitStatus : null;
+  }
+
+  /// Сколько воркеров запускать для [items] задач.
+  ///
+  /// Клиентского ограничителя частоты нет: каждый воркер отправляет запросы
+  /// сразу, поэтому [maxConcurrency] фактически задаёт пиковую частоту запросов.
+  /// Если шлюз сообщил остаток запросов (`x-ratelimit-remaining-requests`),
+  /// воркеров не больше этого остатка, чтобы пакет не упёрся в 429 с первых
+  /// же запросов. Остаток 0 оставляет одного воркера — он дождётся ошибки
+  /// лимита и отчитается о ней, а не зависнет.
+  int concurrencyFor(int items) {
+    var workers = maxConcurrency;
+    final remaining = rateLimitStatus?.remainingRequests;
+    if (remaining != null && remaining < workers) workers = remaining;
+    if (items < workers) workers = items;
+    return workers < 1 ? 1 : workers;
+  }
+
+  // Проверяет, что модель есть у текущего провайдера. Если список моделей
+  // получить не удалось, проверку пропускаем — ошибку вернёт сам запрос
+  Future<void> _validateModelAvailable(String model) async {
+    final models = await getModels();
+    if (models.isNotEmpty && !models.contains(model)) {
+      throw LLMResponseValidationException(
+        localize('models.unavailable', {'model': model}),
+        '',
+        recoveryAction: localize('models.unavailable.recovery'),
+        technicalDetails: 'Model $model not in ${models.length} available models',
+      );
+    }
+  }
+
+  /// Генерирует ТЗ на основе имеющегося черновика: модель дополняет и уточняет
+  /// его по шаблону, а не пишет документ заново. Разделы черновика, уже
+  /// соответствующие шаблону, сохраняются без изменений.
+  Future<String> generateFromDraft({
+    required String draft,
+    String? rawRequirements,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+  }) async {
+    _validateServiceState();
+    if (draft.trim().isEmpty) {
+      throw LLMResponseValidationException(
+        'Черновик пуст',
+        '',
+        recoveryAction: 'Вставьте текст черновика или воспользуйтесь обычной генерацией',
+        technicalDetails: 'draft is empty',
+      );
+    }
+
+    final processedDraft = _prepareInput(draft, resetRedactions: true);
+    final processedRequirements = rawRequirements != null && rawRequirements.trim().isNotEmpty
+        ? _prepareInput(rawRequirements)
+        : null;
+
+    final String systemPrompt;
+    try {
+      systemPrompt = _systemPromptFor(format, templateContent, null);
+    } catch (e) {
+      throw LLMResponseValidationException(
+        'Ошибка при создании системного промта для формата ${format.displayName}',
+        '',
+        recoveryAction: 'Проверьте шаблон и попробуйте другой формат',
+        technicalDetails: e.toString(),
+      );
+    }
+
+    final startInstruction = format == OutputFormat.markdown
+        ? 'ВАЖНО: Обязательно начни ответ с @@@START@@@ и закончи @@@END@@@!'
+        : 'ВАЖНО: Верни только HTML-документ в формате Confluence Storage Format. Начинай с <h1>Техническое задание</h1>!';
+    final buffer = StringBuffer()
+      ..writeln('Ниже черновик технического задания. Доработай его до полного документа по шаблону:')
+      ..writeln('- сохрани текст разделов, которые уже соответствуют шаблону, без изменений;')
+      ..writeln('- дополни недостающие и неполные разделы;')
+      ..writeln('- не удаляй сведения из черновика и не начинай документ с нуля.')
+      ..writeln()
+      ..writeln('Черновик:')
+      ..writeln(processedDraft);
+    if (processedRequirements != null) {
+      buffer
+        ..writeln()
+        ..writeln('Дополнительные требования:')
+        ..writeln(processedRequirements);
+    }
+    buffer
+      ..writeln()
+      ..write(startInstruction);
+
+    return _runGeneration(systemPrompt: systemPrompt, userPrompt: buffer.toString(), format: format);
+  }
+
+  // Токены, резервируемые под ответ модели (max_tokens провайдеров по умолчанию)
+  static const int _reservedOutputTokens = 4000;
+
+  /// Проверяет размер запроса до отправки: огромный ввод иначе отклоняется
+  /// шлюзом с непонятной ошибкой 413. Лимит берётся из [AppConfig.maxInputTokens]
+  /// или из контекстного окна модели; для неизвестных моделей проверка пропускается.
+  void checkRequestSize({
+    required String systemPrompt,
+    required String userPrompt,
+    String? model,
+  }) {
+    final modelId = model ?? _config?.defaultModel ?? '';
+    final override = _config?.maxInputTokens;
+    if (override == 0) return;
+
+    int? limit = override;
+    if (limit == null) {
+      final window = knownContextWindow(modelId);
+      if (window == null) return;
+      limit = window - _reservedOutputTokens;
+    }
+
+    final tokens = tokenEstimator.estimate(systemPrompt, model: modelId) +
+        tokenEstimator.estimate(userPrompt, model: modelId);
+    if (tokens > limit) {
+      final modelLabel = modelId.isEmpty || modelId == 'default' ? 'выбранной модели' : 'модели $modelId';
+      throw LLMResponseValidationException(
+        'Входные данные слишком велики для $modelLabel: ~$tokens токенов, лимит $limit',
+        '',
+        recoveryAction: 'Сократите требования или выберите модель с большим контекстным окном',
+        technicalDetails: 'Estimated input tokens $tokens exceed limit $limit for "$modelId"',
+      );
+    }
+  }
+
+  /// Оценка бюджета токенов до генерации: размер промтов, контекстное окно
+  /// модели и остаток на ответ. Флаг [GenerationPlan.overBudget] выставляется,
+  /// если промты превышают лимит или на ответ остаётся меньше зарезервированного.
+  GenerationPlan getGenerationPlan({
+    required String rawRequirements,
+    String? changes,
+    String? templateContent,
+    String? model,
+    OutputFormat format = OutputFormat.markdown,
+  }) {
+    final prompts = buildGenerationPrompts(
+      rawRequirements: rawRequirements,
+      changes: changes,
+      templateContent: templateContent,
+      format: format,
+      model: model,
+    );
+    final modelId = model ?? _config?.defaultModel ?? '';
+    final promptTokens = tokenEstimator.estimate(prompts['system']!, model: modelId) +
+        tokenEstimator.estimate(prompts['user']!, model: modelId);
+    final window = knownContextWindow(modelId);
+    final override = _config?.maxInputTokens;
+
+    final completionBudget = window != null ? window - promptTokens : null;
+    final overInputLimit = override != null && override > 0 && promptTokens > override;
+    final overWindow = completionBudget != null && completionBudget < _reservedOutputTokens;
+
+    return GenerationPlan(
+      model: modelId,
+      promptTokens: promptTokens,
+      contextWindow: window,
+      completionBudget: completionBudget,
+      overBudget: overInputLimit || overWindow,
+    );
+  }
+
+  /// Цена модели: из [AppConfig.modelPricing] (в валюте [AppConfig.costCurrency])
+  /// или встроенная (USD). Бросает [ArgumentError], если цена неизвестна.
+  CostEstimate estimateCost({
+    required int inputTokens,
+    required int outputTokens,
+    String? model,
+  }) {
+    final modelId = model ?? _config?.defaultModel ?? '';
+    ModelPricing? pricing = ModelPricing.fromJson(_config?.modelPricing?[modelId]);
+    var currency = _config?.costCurrency ?? 'USD';
+    if (pricing == null) {
+      final known = knownPricingUsdPer1K(modelId);
+      if (known == null) {
+        throw ArgumentError('No pricing for model "$modelId": add it to modelPricing in settings');
+      }
+      pricing = ModelPricing(inputPer1K: known[0], outputPer1K: known[1]);
+      currency = 'USD'; // встроенные цены всегда в долларах
+    }
+    return CostEstimate(
+      model: modelId,
+      inputTokens: inputTokens,
+      outputTokens: outputTokens,
+      inputCost: inputTokens / 1000 * pricing.inputPer1K,
+      outputCost: outputTokens / 1000 * pricing.outputPer1K,
+      currency: currency,
+    );
+  }
+
+  /// Оценка стоимости до генерации: промты считаются по [getGenerationPlan],
+  /// ответ — [expectedOutputTokens] (по умолчанию зарезервированный бюджет на ответ).
+  CostEstimate estimateCostForInput({
+    required String rawRequirements,
+    String? changes,
+    String? templateContent,
+    String? model,
+    OutputFormat format = OutputFormat.markdown,
+    int expectedOutputTokens = _reservedOutputTokens,
+  }) {
+    final plan = getGenerationPlan(
+      rawRequirements: rawRequirements,
+      changes: changes,
+      templateContent: templateContent,
+      model: model,
+      format: format,
+    );
+    return estimateCost(
+      inputTokens: plan.promptTokens,
+      outputTokens: expectedOutputTokens,
+      model: plan.model,
+    );
+  }
+
+  // Счётчик расхода за сессию (с запуска приложения или последнего сброса)
+  int _sessionGenerations = 0;
+  int _sessionInputTokens = 0;
+  int _sessionOutputTokens = 0;
+  int _sessionUnpriced = 0;
+  final Map<String, double> _sessionCost = {};
+  DateTime _sessionSince = DateTime.now();
+
+  /// Суммарные токены и оценка стоимости успешных генераций за сессию
+  SessionUsage get sessionUsage => SessionUsage(
+        generations: _sessionGenerations,
+        inputTokens: _sessionInputTokens,
+        outputTokens: _sessionOutputTokens,
+        costByCurrency: Map.unmodifiable(_sessionCost),
+        unpricedGenerations: _sessionUnpriced,
+        since: _sessionSince,
+      );
+
+  void resetSessionUsage() {
+    _sessionGenerations = 0;
+    _sessionInputTokens = 0;
+    _sessionOutputTokens = 0;
+    _sessionUnpriced = 0;
+    _sessionCost.clear();
+    _sessionSince = DateTime.now();
+    notifyListeners();
+  }
+
+  /// Сырой JSON последнего ответа провайдера для диагностики странного вывода.
+  /// Пустая строка, если captureRawResponses выключен или провайдер это не поддерживает.
+  String getLastRawResponse() {
+    final provider = _provider;
+    return (provider is OpenAIProvider ? provider.lastRawResponse : null) ?? '';
+  }
+
+  // Расход запроса: usage из ответа провайдера ([reported]), а если его нет — оценка токенов
+  TokenUsage _requestUsage(String prompt, String output, String modelId, [TokenUsage? reported]) {
+    return reported ??
+        TokenUsage(
+          inputTokens: tokenEstimator.estimate(prompt, model: modelId),
+          outputTokens: tokenEstimator.estimate(output, model: modelId),
+          estimated: true,
+        );
+  }
+
+  // [usage] — уже подсчитанный расход (например, сумма по нескольким запросам);
+  // [countGeneration] = false — дополнительный запрос к уже учтённой генерации
+  void _recordSessionUsage(
+    String systemPrompt,
+    String userPrompt,
+    String output,
+    String? model, {
+    TokenUsage? usage,
+    bool countGeneration = true,
+  }) {
+    final modelId = model ?? _config?.defaultModel ?? '';
+    usage ??= _requestUsage('$systemPrompt\n$userPrompt', output, modelId);
+    if (countGeneration) _sessionGenerations++;
+    _sessionInputTokens += usage.inputTokens;
+    _sessionOutputTokens += usage.outputTokens;
+    try {
+      final cost = estimateCost(inputTokens: usage.inputTokens, outputTokens: usage.outputTokens, model: modelId);
+      _sessionCost[cost.currency] = (_sessionCost[cost.currency] ?? 0) + cost.total;
+    } on ArgumentError {
+      if (countGeneration) _sessionUnpriced++;
+    }
+  }
+
+  /// Отправляет подготовленные промты, проверяет ответ и применяет фильтры результата
+  Future<String> _runGeneration({
+    required String systemPrompt,
+    required String userPrompt,
+    required OutputFormat format,
+    String? model,
+  }) async {
+    final result = await _runGenerationDetailed(
+      systemPrompt: systemPrompt,
+      userPrompt: userPrompt,
+      format: format,
+      model: model,
+    );
+    return result.content;
+  }
+
+  // Запрос генерации: проверка параметров и размера, лимит времени, отмена и повторы
+  // пустого ответа. Ответ возвращается как есть — без проверки и постобработки
+  Future<LLMResponse> _sendGenerationRequest({
+    required String systemPrompt,
+    required String userPrompt,
+    String? model,
+    String? reasoningEffort,
+    Map<String, dynamic>? logitBias,
+    double? temperature,
+    Duration? timeout,
+    CancelToken? cancelToken, // внешняя отмена (например, отмена пакета)
+  }) async {
+    if (timeout != null && timeout <= Duration.zero) {
+      throw ArgumentError('timeout must be positive: $timeout');
+    }
+    checkRequestSize(systemPrompt: systemPrompt, userPrompt: userPrompt, model: model);
+    final effort = reasoningEffort?.trim().toLowerCase();
+    if (effort != null && effort.isNotEmpty && !reasoningEffortLevels.contains(effort)) {
+      throw ArgumentError('reasoningEffort must be one of ${reasoningEffortLevels.join('/')}: $reasoningEffort');
+    }
+    if (logitBias != null) validateLogitBias(logitBias);
+    final hasOverrides = (effort != null && effort.isNotEmpty) || (logitBias != null && logitBias.isNotEmpty);
+    // Лимит общий на все попытки, включая повторы пустого ответа
+    final deadline = timeout != null ? DateTime.now().add(timeout) : null;
+
+    // Send request with error handling.
+    // Пустой ответ (нет choices или только пробелы) повторяем отдельно от HTTP-ретраев
+    final attempts = 1 + math.max(0, _config!.emptyResponseRetries ?? 0);
+    // Ответ берётся из результата вызова, а не из состояния провайдера:
+    // параллельные генерации (пакет, сравнение моделей) делят один провайдер
+    LLMResponse response = const LLMResponse(content: '');
+    for (var attempt = 1; attempt <= attempts; attempt++) {
+      // Лимиту времени нужен свой токен на попытку; внешняя отмена его тоже прерывает
+      var attemptToken = cancelToken;
+      if (deadline != null) {
+        final token = CancelToken();
+        cancelToken?.whenCancel.then((_) => token.cancel('cancelled'));
+        attemptToken = token;
+      }
+      try {
+        final provider = _provider!;
+        // reasoning_effort и logit_bias поддерживает только OpenAI-совместимый провайдер;
+        // отмену запроса по лимиту времени — все провайдеры
+        var request = provider is OpenAIProvider && hasOverrides
+            ? provider.sendRequestDetailed(
+                systemPrompt: systemPrompt,
+                userPrompt: userPrompt,
+                model: model ?? _config!.defaultModel,
+                temperature: temperature,
+                reasoningEffort: effort != null && effort.isNotEmpty ? effort : null,
+                logitBias: logitBias,
+                cancelToken: attemptToken,
+              )
+            : provider.sendRequestDetailed(
+                systemPrompt: systemPrompt,
+                userPrompt: userPrompt,
+                model: model ?? _config!.defaultModel,
+                temperature: temperature,
+                cancelToken: attemptToken,
+              );
+        if (deadline != null) {
+          final remaining = deadline.difference(DateTime.now());
+          request = request.timeout(remaining.isNegative ? Duration.zero : remaining, onTimeout: () {
+            attemptToken?.cancel('generation_timeout');
+            throw GenerationTimeoutException(timeout!);
+          });
+        }
+        response = await request;
+      } on GenerationTimeoutException catch (e) {
+        ErrorLogService().record('generation', e.message);
+        rethrow;
+      } on ContentFilteredException catch (e) {
+        ErrorLogService().record('generation', e.message);
+        throw LLMResponseValidationException(
+          e.message,
+          '',
+          recoveryAction: localize('response.contentFiltered.recovery'),
+          technicalDetails: 'finish_reason: content_filter',
+        );
+      } on EmptyResponseException catch (e) {
+        if (attempt < attempts && cancelToken?.isCancelled != true) {
+          ErrorLogService().record('generation', '${e.message}, повтор $attempt из ${attempts - 1}');
+          continue;
+        }
+        throw _requestFailure(e);
+      } catch (e) {
+        throw _requestFailure(e);
+      }
+      if (attempt == attempts || cancelToken?.isCancelled == true) break;
+      if (splitReasoning(response.content).content.trim().isNotEmpty) break;
+      ErrorLogService().record('generation', 'Пустой ответ модели, повтор $attempt из ${attempts - 1}');
+    }
+    return response;
+  }
+
+  Future<GenerationResult> _runGenerationDetailed({
+    required String systemPrompt,
+    required String userPrompt,
+    required OutputFormat format,
+    String? model,
+    String? reasoningEffort,
+    Map<String, dynamic>? logitBias,
+    double? temperature,
+    Duration? timeout,
+    CancelToken? cancelToken, // внешняя отмена (например, отмена пакета)
+  }) async {
+    final response = await _sendGenerationRequest(
+      systemPrompt: systemPrompt,
+      userPrompt: userPrompt,
+      model: model,
+      reasoningEffort: reasoningEffort,
+      logitBias: logitBias,
+      temperature: temperature,
+      timeout: timeout,
+      cancelToken: cancelToken,
+    );
+
+    // Рассуждения модели не должны попасть в ТЗ и в проверку маркеров
+    final split = splitReasoning(response.content);
+    var result = split.content;
+    result = _trimTruncatedOutput(result, response.finishReason);
+
+    // Validate LLM response
+    try {
+      _validateLLMResponse(result, format);
+    } on LLMResponseValidationException catch (e) {
+      ErrorLogService().record('generation', e.message);
+      rethrow;
+    }
+
+    result = postProcessOutput(result);
+    
+    final usage = _requestUsage('$systemPrompt\n$userPrompt', result, model ?? _config!.defaultModel ?? '', response.usage);
+    notifyListeners();
+    _recordSessionUsage(systemPrompt, userPrompt, result, model, usage: usage);
+    return GenerationResult(
+      content: result,
+      reasoning: split.reasoning,
+      usage: usage,
+      finishReason: response.finishReason,
+    );
+  }
+
+  /// Отправляет многоходовый диалог [messages] и возвращает ответ модели
+  /// (без рассуждений, с фильтрами результата). Провайдеры без поддержки
+  /// диалога получают историю одним пользовательским промтом.
+  Future<String> sendConversation(List<ChatMessage> messages, {String? model}) async {
+    _validateServiceState();
+    if (model != null) await _validateModelAvailable(model);
+    final provider = _provider!;
+    final modelId = model ?? _config!.defaultModel;
+    final system = messages.where((m) => m.role == 'system').map((m) => m.content).join('\n\n');
+    final transcript = messages
+        .where((m) => m.role != 'system')
+        .map((m) => '${m.role == 'assistant' ? 'Ассистент' : 'Пользователь'}:\n${m.content}')
+        .join('\n\n');
+    LLMResponse response;
+    try {
+      response = provider is LLMChatProvider
+          ? await (provider as LLMChatProvider).sendMessagesDetailed(messages: messages, model: modelId)
+          : await provider.sendRequestDetailed(systemPrompt: system, userPrompt: transcript, model: modelId);
+    } on ContentFilteredException catch (e) {
+      ErrorLogService().record('generation', e.message);
+      throw LLMResponseValidationException(
+        e.message,
+        '',
+        recoveryAction: localize('response.contentFiltered.recovery'),
+        technicalDetails: 'finish_reason: content_filter',
+      );
+    } catch (e) {
+      throw _requestFailure(e);
+    }
+    final result = splitReasoning(response.content).content;
+    if (result.trim().isEmpty) {
+      throw LLMResponseValidationException(
+        localize('response.empty'),
+        result,
+        recoveryAction: localize('response.empty.recovery'),
+        technicalDetails: 'Empty conversation reply',
+      );
+    }
+    _recordSessionUsage(system, transcript, result, model, usage: response.usage);
+    notifyListeners();
+    return postProcessOutput(result);
+  }
+
+  // Ошибка запроса к провайдеру с сохранением подробностей для UI и журнала
+  LLMResponseValidationException _requestFailure(Object e) {
+    final raw = e.toString();
+    // Preserve provider error details when available
+    final detailed = raw.startsWith('Exception: ')
+        ? raw.substring('Exception: '.length)
+        : raw;
+    final message = detailed.isNotEmpty
+        ? localize('request.failedWithDetails', {'details': detailed})
+        : localize('request.failed');
+    ErrorLogService().record('generation', message);
+    return LLMResponseValidationException(
+      message,
+      '',
+      recoveryAction: localize('request.failed.recovery'),
+      technicalDetails: raw,
+    );
+  }
+
+  /// При включённом [AppConfig.trimIncompleteEndings] обрезает ответ, усечённый по
+  /// лимиту токенов ([finishReason] этого ответа), до последнего законченного предложения.
+  /// Полные ответы не меняются.
+  String _trimTruncatedOutput(String text, FinishReason? finishReason) {
+    if (_config?.trimIncompleteEndings != true || finishReason != FinishReason.length) {
+      return text;
+    }
+    const startMarker = '@@@START@@@';
+    const endMarker = '@@@END@@@';
+    final start = text.indexOf(startMarker);
+    if (start >= 0 && !text.contains(endMarker)) {
+      // Усечённый Markdown-ответ не дошёл до конечного маркера — закрываем его сами
+      final body = trimIncompleteEnding(text.substring(start + startMarker.length));
+      return '${text.substring(0, start + startMarker.length)}$body\n$endMarker';
+    }
+    return trimIncompleteEnding(text);
+  }
+
+  /// Генерирует ТЗ по разделам шаблона: каждый раздел верхнего уровня — отдельный
+  /// запрос, в который передаются уже готовые разделы. Больше запросов, зато
+  /// каждый помещается в небольшое контекстное окно.
+  /// Если в шаблоне меньше двух разделов, выполняется обычная генерация.
+  Future<String> generateBySection({
+    required String rawRequirements,
+    String? changes,
+    required String templateContent,
+    OutputFormat format = OutputFormat.markdown,
+    String? model,
+  }) async {
+    _validateServiceState();
+    final sections = splitTopLevelSections(templateContent);
+    if (sections.length < 2) {
+      return generateTZ(
+        rawRequirements: rawRequirements,
+        changes: changes,
+        templateContent: templateContent,
+        format: format,
+        model: model,
+      );
+    }
+
+    final processedRawRequirements = _prepareInput(rawRequirements, resetRedactions: true);
+    final processedChanges = changes != null ? _prepareInput(changes) : null;
+    validateGenerationParameters(processedRawRequirements, format, templateContent);
+    final baseUserPrompt = _buildUserPrompt(processedRawRequirements, processedChanges, format);
+
+    final generated = <String>[];
+    for (var i = 0; i < sections.length; i++) {
+      final section = sections[i];
+      final systemPrompt = _systemPromptFor(format, section.content, model);
+      final buffer = StringBuffer(baseUserPrompt)
+        ..writeln()
+        ..writeln()
+        ..writeln('Сейчас сгенерируй ТОЛЬКО раздел «${section.title}» '
+            '(${i + 1} из ${sections.length}) по шаблону выше. Другие разделы не пиши.');
+      if (generated.isNotEmpty) {
+        buffer
+          ..writeln()
+          ..writeln('Уже написанные разделы (для согласованности, не повторяй их):')
+          ..writeln(generated.join('\n\n'));
+      }
+
+      final String part;
+      try {
+        part = await _runGeneration(
+          systemPrompt: systemPrompt,
+          userPrompt: buffer.toString(),
+          format: format,
+          model: model,
+        );
+      } on LLMResponseValidationException catch (e) {
+        throw LLMResponseValidationException(
+          'Раздел «${section.title}»: ${e.message}',
+          e.rawResponse,
+          recoveryAction: e.recoveryAction,
+          technicalDetails: e.technicalDetails,
+        );
+      }
+      generated.add(_stripContentMarkers(part));
+    }
+
+    return '@@@START@@@\n${generated.join('\n\n')}\n@@@END@@@';
+  }
+
+  // Содержимое между маркерами @@@START@@@/@@@END@@@ (или весь текст, если маркеров нет)
+  String _stripContentMarkers(String text) {
+    const startMarker = '@@@START@@@';
+    const endMarker = '@@@END@@@';
+    final start = text.indexOf(startMarker);
+    final end = text.lastIndexOf(endMarker);
+    if (start >= 0 && end > start) {
+      return text.substring(start + startMarker.length, end).trim();
+    }
+    return text.replaceAll(startMarker, '').replaceAll(endMarker, '').trim();
   }
 
-  /// Public helper to build prompts (system + user) for streaming generation
-  /// without performing the actual provider request. Reuses validation logic.
-  /// Returns a map { 'system': ..., 'user': ... }.
-  Map<String, String> buildGenerationPrompts({
+  /// Генерирует ТЗ в виде JSON-объекта, соответствующего схеме: из
+  /// [AppConfig.jsonSchema], а если она не задана — построенной по разделам шаблона.
+  /// Ответ проверяется на клиенте; при нарушениях модель получает их список и
+  /// одну попытку исправиться. Возвращает разобранный и проверенный объект.
+  Future<Map<String, dynamic>> generateStructured({
     required String rawRequirements,
     String? changes,
     String? templateContent,
-    OutputFormat format = OutputFormat.markdown,
-  bool forStreaming = false,
-  }) {
+    String? model,
+  }) async {
     _validateServiceState();
-
-    final processedRawRequirements = processConfluenceContent(rawRequirements);
-    final processedChanges = changes != null ? processConfluenceContent(changes) : null;
-    validateGenerationParameters(processedRawRequirements, format, templateContent);
-
-    if (forStreaming) {
-      final streamingSystem = _buildStreamingSystemPrompt(
-        templateContent: templateContent,
-        format: format,
-      );
-      final streamingUser = _buildStreamingUserPrompt(
-        requirements: processedRawRequirements,
-        changes: processedChanges,
-        format: format,
+    final provider = _provider;
+    if (provider is! LLMStructuredOutputProvider) {
+      throw LLMResponseValidationException(
+        'Провайдер ${_config!.provider} не поддерживает вывод по JSON Schema',
+        '',
+        recoveryAction: 'Используйте OpenAI-совместимого провайдера',
+        technicalDetails: 'Provider does not implement LLMStructuredOutputProvider',
       );
-      return {'system': streamingSystem, 'user': streamingUser};
-    } else {
-      // Build system prompt (legacy non-stream markers)
-      late final String systemPrompt;
-      switch (format) {
-        case OutputFormat.markdown:
-          systemPrompt = _buildMarkdownSystemPrompt(templateContent);
-          break;
-        case OutputFormat.confluence:
-          systemPrompt = _buildConfluenceSystemPrompt(templateContent);
-          break;
-      }
-      final userPrompt = _buildUserPrompt(processedRawRequirements, processedChanges, format);
-      return {'system': systemPrompt, 'user': userPrompt};
     }
-  }
 
-  /// Streaming system prompt (NDJSON spec, no @@@ markers)
-  String _buildStreamingSystemPrompt({
-    required String? templateContent,
-    required OutputFormat format,
-  }) {
-    final formatLabel = format == OutputFormat.markdown ? 'Markdown' : 'HTML (Confluence)';
-    final nowIso = DateTime.now().toUtc().toIso8601String();
-    final templateHint = (templateContent == null || templateContent.trim().isEmpty)
-        ? '(нет активного шаблона — структура на усмотрение модели)'
-        : templateContent.trim();
-    return '''Ты ИИ-помощник по созданию технического задания. Отвечай СТРОГО стримом NDJSON. Каждая строка — одиночный валидный JSON без текста вне JSON.
+    final Map<String, dynamic> schema;
+    final configured = _config!.jsonSchema;
+    if (configured != null && configured.trim().isNotEmpty) {
+      try {
+        schema = (jsonDecode(configured) as Map).cast<String, dynamic>();
+      } catch (e) {
+        throw LLMResponseValidationException(
+          'JSON Schema в настройках некорректна',
+          '',
+          recoveryAction: 'Исправьте схему в настройках или удалите её, чтобы использовать схему шаблона',
+          technicalDetails: e.toString(),
+        );
+      }
+    } else if (templateContent != null && templateContent.trim().isNotEmpty) {
+      schema = schemaFromTemplate(templateContent);
+    } else {
+      throw LLMResponseValidationException(
+        'Не из чего построить JSON Schema',
+        '',
+        recoveryAction: 'Выберите шаблон с разделами или задайте схему в настройках',
+        technicalDetails: 'No jsonSchema in config and no template content',
+      );
+    }
 
-ФАЗЫ: init → plan → structure → draft_sections → refine → validate → finalize.
+    final processedRawRequirements = _prepareInput(rawRequirements, resetRedactions: true);
+    final processedChanges = changes != null ? _prepareInput(changes) : null;
+    validateGenerationParameters(processedRawRequirements, OutputFormat.markdown, templateContent);
 
-ФОРМАТ ВЫВОДА: $formatLabel (структура и заголовки внутри текста чанков).
+    final systemPrompt = 'Ты ИИ-помощник по созданию технического задания. '
+        'Верни ТЗ строго в виде JSON по заданной схеме: каждое поле — текст соответствующего раздела в Markdown. '
+        'Никакого текста вне JSON.'
+        '${templateContent != null && templateContent.trim().isNotEmpty ? '\n\nШАБЛОН:\n$templateContent' : ''}';
+    final userPrompt = StringBuffer('ТРЕБОВАНИЯ:\n$processedRawRequirements');
+    if (processedChanges != null && processedChanges.trim().isNotEmpty) {
+      userPrompt.write('\n\nИЗМЕНЕНИЯ:\n$processedChanges');
+    }
 
-ПРАВИЛА СТРИМА:
-1. Первая строка: {"stream_type":"status","phase":"init","progress":0,"message":"Инициализация","ts":"<ISO8601>"}
-2. Вторая строка: пустой контент: {"stream_type":"content","append":""}
-3. Используй преимущественно append с небольшими логическими фрагментами. При крупной переработке допускается full.
-4. НИКОГДА не используй ключи разделов — только текст.
-5. Прогресс растёт монотонно. Финальная строка: {"stream_type":"final","progress":100,"message":"Готово","summary":"..."}
-6. Без плейсхолдеров и заглушек.
-7. Только один JSON на строку.
+    var prompt = userPrompt.toString();
+    List<String> problems = const [];
+    String raw = '';
+    // Запрос со схемой не возвращает usage — расход всех попыток оценивается
+    var inputTokens = 0;
+    var outputTokens = 0;
+    for (var attempt = 0; attempt < 2; attempt++) {
+      try {
+        raw = await (provider as LLMStructuredOutputProvider).sendRequestWithSchema(
+          systemPrompt: systemPrompt,
+          userPrompt: prompt,
+          schema: schema,
+          model: model ?? _config!.defaultModel,
+        );
+        final usage = _requestUsage('$systemPrompt\n$prompt', raw, model ?? _config!.defaultModel ?? '');
+        inputTokens += usage.inputTokens;
+        outputTokens += usage.outputTokens;
+      } catch (e) {
+        ErrorLogService().record('generation', e);
+        throw LLMResponseValidationException(
+          localize('request.failed'),
+          '',
+          recoveryAction: localize('request.failed.recovery'),
+          technicalDetails: e.toString(),
+        );
+      }
 
-КОНТУР ШАБЛОНА (ориентир):
-$templateHint
+      dynamic decoded;
+      try {
+        decoded = jsonDecode(raw);
+        problems = validateJsonSchema(decoded, schema);
+      } on FormatException catch (e) {
+        problems = ['Ответ не является корректным JSON: ${e.message}'];
+      }
+      if (problems.isEmpty && decoded is Map) {
+        _recordSessionUsage(systemPrompt, prompt, raw, model,
+            usage: TokenUsage(inputTokens: inputTokens, outputTokens: outputTokens, estimated: true));
+        return decoded.cast<String, dynamic>();
+      }
+      // Повторяем один раз, сообщая модели о нарушениях
+      prompt = '$userPrompt\n\nПредыдущий ответ не прошёл проверку схемы:\n'
+          '${problems.map((p) => '- $p').join('\n')}\nВерни исправленный JSON целиком.';
+    }
 
-ЗАДАЧА: Постепенно сгенерировать цельное, отредактированное ТЗ высокого качества. Время запроса: $nowIso.''';
+    ErrorLogService().record('generation', 'JSON Schema: ${problems.join('; ')}');
+    throw LLMResponseValidationException(
+      'Ответ AI не соответствует JSON Schema',
+      raw,
+      recoveryAction: 'Повторите генерацию или упростите схему',
+      technicalDetails: problems.join('\n'),
+    );
   }
 
-  /// Streaming user prompt (no legacy markers)
-  String _buildStreamingUserPrompt({
-    required String requirements,
-    required String? changes,
-    required OutputFormat format,
-  }) {
-    final formatInstr = format == OutputFormat.markdown
-        ? 'Форматируй в Markdown без HTML.'
-        : 'Форматируй в допустимом Confluence Storage HTML.';
-    final b = StringBuffer()
-      ..writeln('Требования для ТЗ:\n\n$requirements');
-    if (changes != null && changes.isNotEmpty) {
-      b.writeln('\nИзменения / уточнения:\n\n$changes');
+  /// Продолжает генерацию, оборванную по лимиту токенов (finish_reason = "length").
+  /// Обрезанный ответ отправляется модели как её собственная реплика с просьбой
+  /// продолжить с места остановки; продолжение склеивается без повторов на стыке.
+  Future<String> continueGeneration({
+    required String previousOutput,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+  }) async {
+    _validateServiceState();
+    if (previousOutput.trim().isEmpty) {
+      throw LLMResponseValidationException(
+        'Нет текста для продолжения',
+        '',
+        recoveryAction: 'Сначала сгенерируйте техническое задание',
+        technicalDetails: 'previousOutput is empty',
+      );
     }
-    b..writeln('\n$formatInstr')
-     ..writeln('Начинай поток немедленно, соблюдая протокол фаз.');
-    return b.toString();
-  }
-  
-  /// Тестирует соединение с провайдером
-  Future<bool> testConnection() async {
-    if (_provider == null) return false;
-    
-    final result = await _provider!.testConnection();
+
+    final systemPrompt = _systemPromptFor(format, templateContent, null);
+
+    String continuation;
+    try {
+      final response = await _requestContinuation(systemPrompt, previousOutput, _config!.defaultModel);
+      continuation = response.content;
+      _recordSessionUsage(systemPrompt, '$previousOutput\n$_continuePrompt', continuation, null,
+          usage: response.usage, countGeneration: false);
+    } catch (e) {
+      final raw = e.toString();
+      final message = 'Ошибка при продолжении генерации: '
+          '${raw.startsWith('Exception: ') ? raw.substring('Exception: '.length) : raw}';
+      ErrorLogService().record('generation', message);
+      throw LLMResponseValidationException(
+        message,
+        '',
+        recoveryAction: 'Проверьте подключение к интернету и попробуйте продолжить ещё раз',
+        technicalDetails: raw,
+      );
+    }
+
+    final result = postProcessOutput(mergeContinuation(previousOutput, continuation));
     notifyListeners();
     return result;
   }
-  
-  /// Получает список доступных моделей
-  Future<List<String>> getModels() async {
-    if (_provider == null) {
-      print('LLMService: getModels called but provider is null');
-      return [];
+
+  static const String _continuePrompt = 'Ответ был обрезан. Продолжи ровно с того места, где остановился: '
+      'не повторяй уже написанный текст и не начинай документ заново. '
+      'Заверши документ маркером @@@END@@@.';
+
+  // Обрезанный ответ отправляется модели как её собственная реплика с просьбой продолжить
+  Future<LLMResponse> _requestContinuation(String systemPrompt, String previousOutput, String? model) {
+    final provider = _provider!;
+    if (provider is LLMChatProvider) {
+      return (provider as LLMChatProvider).sendMessagesDetailed(
+        messages: [
+          ChatMessage(role: 'system', content: systemPrompt),
+          ChatMessage(role: 'assistant', content: previousOutput),
+          ChatMessage(role: 'user', content: _continuePrompt),
+        ],
+        model: model,
+      );
     }
-    
-    print('LLMService: Getting models for provider: ${_config?.provider}');
-    
-    final models = await _provider!.getModels();
-    
-    print('LLMService: Got ${models.length} models: $models');
-    
-    notifyListeners();
-    return models;
+    // Провайдеры без поддержки диалога получают обрезанный текст в пользовательском промте
+    return provider.sendRequestDetailed(
+      systemPrompt: systemPrompt,
+      userPrompt: '$_continuePrompt\n\nУже написанный текст:\n$previousOutput',
+      model: model,
+    );
   }
-  
-  /// Генерирует техническое задание
-  Future<String> generateTZ({
+
+  static const int defaultMaxContinuations = 3;
+
+  /// Генерирует ТЗ и, пока ответ обрывается по лимиту токенов (finish_reason = "length"),
+  /// автоматически запрашивает продолжение — не более [maxContinuations] раз.
+  /// Части склеиваются без повторов на стыке; в результате — суммарный расход токенов.
+  /// Если лимит продолжений исчерпан, документ закрывается как есть и помечается truncated.
+  /// Первый запрос выполняется как обычная генерация (повторы пустого ответа, [temperature],
+  /// [reasoningEffort], [logitBias]); [timeout] и [cancelToken] действуют и на продолжения.
+  Future<CompleteGenerationResult> generateComplete({
     required String rawRequirements,
-    String? changes,
     String? templateContent,
     OutputFormat format = OutputFormat.markdown,
+    String? model,
+    int maxContinuations = defaultMaxContinuations,
+    String? reasoningEffort,
+    Map<String, dynamic>? logitBias,
+    double? temperature,
+    Duration? timeout,
+    CancelToken? cancelToken,
   }) async {
-    // Validate service state
-    _validateServiceState();
-    
-    // Process Confluence content markers before validation
-    final processedRawRequirements = processConfluenceContent(rawRequirements);
-    final processedChanges = changes != null ? processConfluenceContent(changes) : null;
-    
-    // Validate input parameters with processed content
-    validateGenerationParameters(processedRawRequirements, format, templateContent);
-    
-    // Generate format-specific system prompt
-    String systemPrompt;
+    if (maxContinuations < 0) {
+      throw ArgumentError('maxContinuations must not be negative: $maxContinuations');
+    }
+    final prompts = buildGenerationPrompts(
+      rawRequirements: rawRequirements,
+      templateContent: templateContent,
+      format: format,
+      model: model,
+    );
+    final systemPrompt = prompts['system']!;
+    final userPrompt = prompts['user']!;
+    if (model != null) await _validateModelAvailable(model);
+    final modelId = model ?? _config!.defaultModel;
+    final deadline = timeout != null ? DateTime.now().add(timeout) : null;
+
+    var inputTokens = 0;
+    var outputTokens = 0;
+    var estimated = false;
+    void addUsage(String requestText, String output, TokenUsage? reported) {
+      final usage = _requestUsage(requestText, output, modelId ?? '', reported);
+      inputTokens += usage.inputTokens;
+      outputTokens += usage.outputTokens;
+      estimated = estimated || usage.estimated;
+    }
+
+    final first = await _sendGenerationRequest(
+      systemPrompt: systemPrompt,
+      userPrompt: userPrompt,
+      model: modelId,
+      reasoningEffort: reasoningEffort,
+      logitBias: logitBias,
+      temperature: temperature,
+      timeout: timeout,
+      cancelToken: cancelToken,
+    );
+    var text = splitReasoning(first.content).content;
+    var finishReason = first.finishReason;
+    addUsage('$systemPrompt\n$userPrompt', text, first.usage);
+
+    var continuations = 0;
     try {
-      switch (format) {
-        case OutputFormat.markdown:
-          systemPrompt = _buildMarkdownSystemPrompt(templateContent);
-          break;
-        case OutputFormat.confluence:
-          systemPrompt = _buildConfluenceSystemPrompt(templateContent);
-          break;
+      while (finishReason == FinishReason.length &&
+          continuations < maxContinuations &&
+          cancelToken?.isCancelled != true) {
+        continuations++;
+        var request = _requestContinuation(systemPrompt, text, modelId);
+        if (deadline != null) {
+          final remaining = deadline.difference(DateTime.now());
+          request = request.timeout(remaining.isNegative ? Duration.zero : remaining,
+              onTimeout: () => throw GenerationTimeoutException(timeout!));
+        }
+        final next = await request;
+        final piece = splitReasoning(next.content).content;
+        finishReason = next.finishReason;
+        addUsage('$systemPrompt\n$text\n$_continuePrompt', piece, next.usage);
+        text = mergeContinuation(text, piece);
       }
-    } catch (e) {
+    } on GenerationTimeoutException catch (e) {
+      ErrorLogService().record('generation', e.message);
+      rethrow;
+    } on ContentFilteredException catch (e) {
+      ErrorLogService().record('generation', e.message);
       throw LLMResponseValidationException(
-        'Ошибка при создании системного промта для формата ${format.displayName}',
+        e.message,
         '',
-        recoveryAction: 'Проверьте шаблон и попробуйте другой формат',
-        technicalDetails: e.toString(),
+        recoveryAction: localize('response.contentFiltered.recovery'),
+        technicalDetails: 'finish_reason: content_filter',
       );
+    } catch (e) {
+      throw _requestFailure(e);
+    }
+
+    final truncated = finishReason == FinishReason.length;
+    if (truncated) {
+      text = _trimTruncatedOutput(text, finishReason);
+      // Без trimIncompleteEndings маркер всё равно нужен, иначе проверка отклонит документ
+      if (text.contains('@@@START@@@') && !text.contains('@@@END@@@')) text = '$text\n@@@END@@@';
     }
-    
-    // Формируем пользовательский промт с обработанным контентом
-    String userPrompt;
     try {
-      userPrompt = _buildUserPrompt(processedRawRequirements, processedChanges, format);
-    } catch (e) {
+      _validateLLMResponse(text, format);
+    } on LLMResponseValidationException catch (e) {
+      ErrorLogService().record('generation', e.message);
+      rethrow;
+    }
+    text = postProcessOutput(text);
+
+    final usage = TokenUsage(inputTokens: inputTokens, outputTokens: outputTokens, estimated: estimated);
+    _recordSessionUsage(systemPrompt, userPrompt, text, model, usage: usage);
+    notifyListeners();
+    return CompleteGenerationResult(
+      content: text,
+      usage: usage,
+      continuations: continuations,
+      truncated: truncated,
+    );
+  }
+
+  /// Применяет к результату генерации фильтры из конфигурации
+  /// (или встроенные, если в конфигурации они не заданы).
+  /// Ошибки в выражениях не прерывают генерацию — они попадают в журнал ошибок.
+  String postProcessOutput(String text) {
+    final patterns = _config?.outputFilters ?? defaultOutputFilters;
+    final filtered = applyOutputFilters(text, patterns);
+    for (final error in filtered.errors) {
+      ErrorLogService().record('output-filters', error);
+    }
+    if (_isCommonMark) {
+      // В CommonMark нет чек-листов — заменяем их на символы, чтобы не остались "[ ]"
+      return filtered.text
+          .replaceAllMapped(RegExp(r'^(\s*[-*+]\s+)\[ \]\s', multiLine: true), (m) => '${m[1]}☐ ')
+          .replaceAllMapped(RegExp(r'^(\s*[-*+]\s+)\[[xX]\]\s', multiLine: true), (m) => '${m[1]}☑ ');
+    }
+    return filtered.text;
+  }
+
+  // Ограничения на изображения для мультимодальных запросов
+  static const int maxImageBytes = 10 * 1024 * 1024;
+  static const Map<String, String> _imageMimeTypes = {
+    'png': 'image/png',
+    'jpg': 'image/jpeg',
+    'jpeg': 'image/jpeg',
+  };
+
+  /// Генерирует техническое задание с учетом изображения (скриншот макета, диаграмма).
+  /// Доступно только для моделей с поддержкой изображений.
+  Future<String> generateTZWithImage({
+    required String rawRequirements,
+    required String imagePath,
+    String? changes,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+  }) async {
+    _validateServiceState();
+
+    final provider = _provider;
+    final model = _config!.defaultModel;
+    if (provider is! LLMVisionProvider || !(provider as LLMVisionProvider).supportsVision(model)) {
       throw LLMResponseValidationException(
-        'Ошибка при создании пользовательского промта',
+        'Модель $model не поддерживает работу с изображениями',
         '',
-        recoveryAction: 'Проверьте введенные требования и попробуйте снова',
-        technicalDetails: e.toString(),
+        recoveryAction: 'Выберите модель с поддержкой изображений (например, gpt-4o) или уберите изображение',
+        technicalDetails: 'Provider ${_config!.provider} / model $model has no vision support',
       );
     }
-    
-    // Send request with error handling
+
+    final imageDataUrl = await _encodeImageAsDataUrl(imagePath);
+    final prompts = buildGenerationPrompts(
+      rawRequirements: rawRequirements,
+      changes: changes,
+      templateContent: templateContent,
+      format: format,
+      model: model,
+    );
+
+    final userPrompt = '${prompts['user']!}\n\nК требованиям приложено изображение (макет или диаграмма) — учти его содержимое.';
     String result;
     try {
-      result = await _provider!.sendRequest(
-        systemPrompt: systemPrompt,
+      result = await (provider as LLMVisionProvider).sendRequestWithImage(
+        systemPrompt: prompts['system']!,
         userPrompt: userPrompt,
-        model: _config!.defaultModel,
+        imageDataUrl: imageDataUrl,
+        model: model,
       );
     } catch (e) {
       final raw = e.toString();
-      // Preserve provider error details when available
-      final detailed = raw.startsWith('Exception: ')
-          ? raw.substring('Exception: '.length)
-          : raw;
-      final message = detailed.isNotEmpty
-          ? 'Ошибка при отправке запроса к AI провайдеру: $detailed'
-          : 'Ошибка при отправке запроса к AI провайдеру';
+      final detailed = raw.startsWith('Exception: ') ? raw.substring('Exception: '.length) : raw;
+      ErrorLogService().record('generation', detailed);
       throw LLMResponseValidationException(
-        message,
+        'Ошибка при отправке запроса с изображением к AI провайдеру: $detailed',
         '',
-        recoveryAction: 'Проверьте подключение к интернету и настройки API. Попробуйте повторить запрос',
+        recoveryAction: 'Проверьте подключение и размер изображения. Попробуйте повторить запрос',
         technicalDetails: raw,
       );
     }
-    
-    // Validate LLM response
+
+    result = splitReasoning(result).content;
     _validateLLMResponse(result, format);
-    
+
+    result = postProcessOutput(result);
+    // Usage запрос с изображением не возвращает; токены изображения в оценку не входят
+    _recordSessionUsage(prompts['system']!, userPrompt, result, model);
+
     notifyListeners();
     return result;
   }
-  
+
+  /// Читает изображение и кодирует его в data URL (base64) с проверкой формата и размера
+  Future<String> _encodeImageAsDataUrl(String imagePath) async {
+    final extension = imagePath.split('.').last.toLowerCase();
+    final mimeType = _imageMimeTypes[extension];
+    if (mimeType == null) {
+      throw LLMResponseValidationException(
+        'Неподдерживаемый формат изображения: .$extension',
+        '',
+        recoveryAction: 'Используйте изображение в формате PNG или JPEG',
+        technicalDetails: 'Unsupported image extension: $extension',
+      );
+    }
+
+    final file = File(imagePath);
+    if (!await file.exists()) {
+      throw LLMResponseValidationException(
+        'Файл изображения не найден',
+        '',
+        recoveryAction: 'Проверьте путь к файлу и выберите изображение заново',
+        technicalDetails: 'Image file not found: $imagePath',
+      );
+    }
+
+    final size = await file.length();
+    if (size == 0 || size > maxImageBytes) {
+      throw LLMResponseValidationException(
+        size == 0 ? 'Файл изображения пуст' : 'Изображение слишком большое',
+        '',
+        recoveryAction: 'Используйте изображение размером до ${maxImageBytes ~/ (1024 * 1024)} МБ',
+        technicalDetails: 'Image size: $size bytes (limit $maxImageBytes)',
+      );
+    }
+
+    final bytes = await file.readAsBytes();
+    final isPng = bytes.length > 4 && bytes[0] == 0x89 && bytes[1] == 0x50 && bytes[2] == 0x4E && bytes[3] == 0x47;
+    final isJpeg = bytes.length > 3 && bytes[0] == 0xFF && bytes[1] == 0xD8 && bytes[2] == 0xFF;
+    if ((mimeType == 'image/png' && !isPng) || (mimeType == 'image/jpeg' && !isJpeg)) {
+      throw LLMResponseValidationException(
+        'Содержимое файла не соответствует формату изображения',
+        '',
+        recoveryAction: 'Сохраните изображение заново в формате PNG или JPEG',
+        technicalDetails: 'Image signature mismatch for $mimeType',
+      );
+    }
+
+    return 'data:$mimeType;base64,${base64Encode(bytes)}';
+  }
+
+  /// Модели, заведомо поддерживающие потоковую генерацию: по таблице возможностей
+  /// и уже выполненным пробам. Запросов к моделям не делает — UI отключает
+  /// переключатель стриминга для остальных, а неизвестные модели проверяются
+  /// по требованию через [supportsStreamingFor] или [probeStreamingSupport].
+  Future<List<String>> getStreamableModels() async {
+    final support = await getStreamingSupport();
+    return [
+      for (final entry in support.entries)
+        if (entry.value == StreamingSupport.supported) entry.key,
+    ];
+  }
+
+  /// Поддержка стриминга для каждой модели из списка без пробных запросов:
+  /// модели вне таблицы и без кешированной пробы — [StreamingSupport.unknown]
+  Future<Map<String, StreamingSupport>> getStreamingSupport() async {
+    final models = await getModels();
+    return {for (final model in models) model: _streamingSupportWithoutProbe(model)};
+  }
+
+  StreamingSupport _streamingSupportWithoutProbe(String model) {
+    final provider = _provider;
+    if (provider is! LLMStreamingProvider || !(provider as LLMStreamingProvider).supportsStreaming) {
+      return StreamingSupport.unsupported;
+    }
+    // Шлюз отверг потоковый запрос при проверке настроек
+    if (endpointCapabilities?.streaming == false) return StreamingSupport.unsupported;
+    final known = knownStreamingSupport(model) ?? _streamingProbeResults[model];
+    if (known == null) return StreamingSupport.unknown;
+    return known ? StreamingSupport.supported : StreamingSupport.unsupported;
+  }
+
+  /// Проверяет пробами модели [models] с неизвестной поддержкой стриминга.
+  /// Каждая проба — платный запрос, поэтому вызывать только для моделей,
+  /// которые пользователь действительно выбрал; пробы идут параллельно
+  /// с ограничением [_maxConcurrentStreamingProbes].
+  Future<Map<String, bool>> probeStreamingSupport(List<String> models) async {
+    final results = await mapWithConcurrency(models, _maxConcurrentStreamingProbes, supportsStreamingFor);
+    return Map.fromIterables(models, results);
+  }
+
+  /// Возможности текущего шлюза, сохранённые при проверке [probeEndpointCapabilities].
+  /// null — проверки не было или с тех пор сменился URL.
+  EndpointCapabilities? get endpointCapabilities {
+    final raw = _config?.endpointCapabilities;
+    if (raw == null) return null;
+    final caps = EndpointCapabilities.fromJson(raw);
+    return caps.endpoint == _config!.apiUrl.trim() ? caps : null;
+  }
+
+  /// Пробные запросы к шлюзу из [config] (OpenAI-совместимый провайдер) без смены
+  /// текущего провайдера. Для остальных провайдеров возможности известны заранее — null.
+  Future<EndpointCapabilities?> probeEndpointCapabilities(AppConfig config) async {
+    if (config.provider != 'openai' || config.apiUrl.trim().isEmpty) return null;
+    return OpenAIProvider(config).probeCapabilities(model: config.defaultModel);
+  }
+
+  /// Проверяет, поддерживает ли [model] потоковую генерацию у текущего провайдера
+  Future<bool> supportsStreamingFor(String model) async {
+    final provider = _provider;
+    if (provider is! LLMStreamingProvider || !(provider as LLMStreamingProvider).supportsStreaming) {
+      return false;
+    }
+    // Шлюз отверг потоковый запрос при проверке настроек
+    if (endpointCapabilities?.streaming == false) return false;
+    final known = knownStreamingSupport(model);
+    if (known != null) return known;
+
+    final cached = _streamingProbeResults[model];
+    if (cached != null) return cached;
+
+    return _streamingProbesInFlight.putIfAbsent(model, () async {
+      try {
+        final supported = await _probeStreaming(provider as LLMStreamingProvider, model);
+        _streamingProbeResults[model] = supported;
+        return supported;
+      } finally {
+        _streamingProbesInFlight.remove(model);
+      }
+    });
+  }
+
+  // Минимальный потоковый запрос: достаточно получить первый чанк без ошибки
+  Future<bool> _probeStreaming(LLMStreamingProvider provider, String model) async {
+    try {
+      final first = await provider
+          .streamChat(systemPrompt: 'Reply with one word.', userPrompt: 'ping', model: model, maxTokens: 1)
+          .first
+          .timeout(const Duration(seconds: 15));
+      return first is! LLMStreamChunkError;
+    } catch (e) {
+      print('LLMService: streaming probe failed for $model: $e');
+      return false;
+    }
+  }
 
   /// Проводит ревью шаблона
   Future<String> reviewTemplate(String templateContent, String? modelId) async {
@@ -273,8 +2023,22 @@ $templateHint
     return result;
   }
   
+  static const String markdownFlavorGfm = 'gfm';
+  static const String markdownFlavorCommonMark = 'commonmark';
+
+  bool get _isCommonMark => _config?.markdownFlavor == markdownFlavorCommonMark;
+
+  // Вики различаются поддержкой таблиц и чек-листов: GFM их поддерживает, CommonMark — нет
+  String _markdownFlavorInstruction() {
+    if (_isCommonMark) {
+      return 'Используй строго CommonMark: без таблиц (вместо них — списки), без чек-листов "- [ ]" и без зачёркивания ~~';
+    }
+    return 'Используй GitHub Flavored Markdown: таблицы с разделителем |---|, чек-листы "- [ ]" / "- [x]"';
+  }
+
   /// Builds system prompt for Markdown format generation
   String _buildMarkdownSystemPrompt(String? templateContent) {
+    templateContent = _withBuiltInVariables(templateContent);
     if (templateContent == null || templateContent.isEmpty) {
       return '''Senior System Analyst. Генерируй ТЗ в Markdown формате.
 
@@ -291,6 +2055,7 @@ $templateHint
 3. Обязательно оберни весь ответ в маркеры @@@START@@@ и @@@END@@@
 4. НЕ добавляй никаких комментариев до, после или между маркерами
 5. НЕ пиши ничего после маркера @@@END@@@
+6. ${_markdownFlavorInstruction()}
 
 Пример формата ответа:
 @@@START@@@
@@ -316,6 +2081,7 @@ $templateContent
 3. Обязательно оберни весь ответ в маркеры @@@START@@@ и @@@END@@@
 4. НЕ добавляй никаких комментариев до, после или между маркерами
 5. НЕ пиши ничего после маркера @@@END@@@
+6. ${_markdownFlavorInstruction()}
 
 Пример формата ответа:
 @@@START@@@
@@ -326,6 +2092,7 @@ $templateContent
   
   /// Builds system prompt for Confluence HTML format generation
   String _buildConfluenceSystemPrompt(String? templateContent) {
+    templateContent = _withBuiltInVariables(templateContent);
     if (templateContent == null || templateContent.isEmpty) {
       return '''Senior System Analyst. Генерируй ТЗ в HTML (Confluence Storage Format).
 
@@ -359,7 +2126,7 @@ $templateContent
   }
   
   /// Builds user prompt based on requirements, changes, and format
-  String _buildUserPrompt(String rawRequirements, String? changes, OutputFormat format) {
+  String _buildUserPrompt(String rawRequirements, String? changes, OutputFormat format, {String? context}) {
     if (rawRequirements.isEmpty) {
       throw ArgumentError('Raw requirements cannot be empty');
     }
@@ -383,6 +2150,10 @@ $templateContent
     if (changes != null && changes.isNotEmpty) {
       userPrompt += '\n\nУчти следующие изменения:\n\n$changes';
     }
+
+    if (context != null && context.isNotEmpty) {
+      userPrompt += '\n\nДОПОЛНИТЕЛЬНЫЙ КОНТЕКСТ (приложенные файлы, используй как источник сведений):\n\n$context';
+    }
     
     userPrompt += '\n\n$startInstruction';
     
@@ -393,27 +2164,27 @@ $templateContent
   void _validateServiceState() {
     if (_provider == null || _config == null) {
       throw LLMResponseValidationException(
-        'LLM провайдер не инициализирован',
+        localize('provider.notInitialized'),
         '',
-        recoveryAction: 'Перейдите в настройки и настройте подключение к AI провайдеру',
+        recoveryAction: localize('provider.notInitialized.recovery'),
         technicalDetails: 'LLM provider or config is null',
       );
     }
     
     if (!_provider!.hasModels) {
       throw LLMResponseValidationException(
-        'Список моделей AI не загружен',
+        localize('models.notLoaded'),
         '',
-        recoveryAction: 'Проверьте подключение к интернету и настройки API, затем перезапустите приложение',
+        recoveryAction: localize('models.notLoaded.recovery'),
         technicalDetails: 'No models available from provider',
       );
     }
     
     if (_config!.defaultModel?.isEmpty ?? true) {
       throw LLMResponseValidationException(
-        'Модель AI по умолчанию не выбрана',
+        localize('models.defaultNotSelected'),
         '',
-        recoveryAction: 'Перейдите в настройки и выберите модель AI по умолчанию',
+        recoveryAction: localize('models.defaultNotSelected.recovery'),
         technicalDetails: 'Default model is empty',
       );
     }
@@ -425,18 +2196,18 @@ $templateContent
   void validateGenerationParameters(String rawRequirements, OutputFormat format, String? templateContent) {
     if (rawRequirements.isEmpty) {
       throw LLMResponseValidationException(
-        'Требования не могут быть пустыми',
+        localize('requirements.empty'),
         '',
-        recoveryAction: 'Введите описание требований для генерации технического задания',
+        recoveryAction: localize('requirements.empty.recovery'),
         technicalDetails: 'Raw requirements parameter is empty',
       );
     }
     
     if (rawRequirements.length < 10) {
       throw LLMResponseValidationException(
-        'Требования слишком короткие для качественной генерации',
+        localize('requirements.tooShort'),
         '',
-        recoveryAction: 'Добавьте больше деталей в описание требований (минимум 10 символов)',
+        recoveryAction: localize('requirements.tooShort.recovery'),
         technicalDetails: 'Requirements too short: ${rawRequirements.length} characters',
       );
     }
@@ -504,18 +2275,18 @@ $templateContent
   void _validateLLMResponse(String response, OutputFormat format) {
     if (response.isEmpty) {
       throw LLMResponseValidationException(
-        'AI вернул пустой ответ',
+        localize('response.empty'),
         response,
-        recoveryAction: 'Попробуйте повторить генерацию с более детальными требованиями',
+        recoveryAction: localize('response.empty.recovery'),
         technicalDetails: 'Empty response from LLM',
       );
     }
     
     if (response.length < 50) {
       throw LLMResponseValidationException(
-        'AI вернул слишком короткий ответ',
+        localize('response.tooShort'),
         response,
-        recoveryAction: 'Попробуйте повторить генерацию с более детальными требованиями или проверьте настройки модели',
+        recoveryAction: localize('response.tooShort.recovery'),
         technicalDetails: 'Response too short: ${response.length} characters',
       );
     }
@@ -0,0 +1,15 @@
+/// Interface for providers that can constrain the response to a JSON Schema
+/// (OpenAI `response_format: {type: "json_schema"}`).
+abstract class LLMStructuredOutputProvider {
+  /// Sends a chat completion whose reply must conform to [schema].
+  /// Returns the raw JSON text of the reply.
+  Future<String> sendRequestWithSchema({
+    required String systemPrompt,
+    required String userPrompt,
+    required Map<String, dynamic> schema,
+    String schemaName = 'specification',
+    String? model,
+    int? maxTokens,
+    double? temperature,
+  });
+}
@@ -0,0 +1,16 @@
+/// Interface for providers that accept images alongside text (multimodal chat).
+abstract class LLMVisionProvider {
+  /// Returns true if [model] is known to accept image input.
+  bool supportsVision(String? model);
+
+  /// Sends a chat completion where the user turn carries both [userPrompt]
+  /// and an image passed as a `data:` URL ([imageDataUrl]).
+  Future<String> sendRequestWithImage({
+    required String systemPrompt,
+    required String userPrompt,
+    required String imageDataUrl,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+  });
+}
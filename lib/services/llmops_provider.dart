@@ -1,6 +1,12 @@
 import 'package:dio/dio.dart';
 import '../models/app_config.dart';
+import '../utils/error_body.dart';
+import '../models/finish_reason.dart';
+import '../models/llm_response.dart';
+import '../models/token_usage.dart';
 import 'llm_provider.dart';
+import 'request_abort_registry.dart';
+import 'http_client_config.dart';
 
 class LLMOpsProvider implements LLMProvider {
   final Dio _dio = Dio();
@@ -10,7 +16,10 @@ class LLMOpsProvider implements LLMProvider {
   bool _isLoading = false;
   String? _error;
   
-  LLMOpsProvider(this._config);
+  LLMOpsProvider(this._config) {
+    configureTls(_dio, _config);
+    _dio.interceptors.add(RequestAbortRegistry().interceptor);
+  }
 
   String _resolveModel(String? model) {
     if (model != null && model.isNotEmpty && model != 'default') {
@@ -35,7 +44,7 @@ class LLMOpsProvider implements LLMProvider {
       }
       if (data['message'] != null) return data['message'].toString();
     }
-    if (data != null) return data.toString();
+    if (data != null) return describeErrorBody(data, statusCode: e.response?.statusCode);
     return e.message ?? 'DioException';
   }
   
@@ -50,6 +59,9 @@ class LLMOpsProvider implements LLMProvider {
   
   @override
   String? get error => _error;
+
+  @override
+  FinishReason? get lastFinishReason => null; // LLMOps не сообщает finish_reason
   
   String get _baseUrl => _config.llmopsBaseUrl ?? 'http://localhost:11434';
   
@@ -149,6 +161,27 @@ class LLMOpsProvider implements LLMProvider {
     String? model,
     int? maxTokens,
     double? temperature,
+    CancelToken? cancelToken,
+  }) async {
+    final response = await sendRequestDetailed(
+      systemPrompt: systemPrompt,
+      userPrompt: userPrompt,
+      model: model,
+      maxTokens: maxTokens,
+      temperature: temperature,
+      cancelToken: cancelToken,
+    );
+    return response.content;
+  }
+
+  @override
+  Future<LLMResponse> sendRequestDetailed({
+    required String systemPrompt,
+    required String userPrompt,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+    CancelToken? cancelToken,
   }) async {
     try {
       _isLoading = true;
@@ -167,6 +200,7 @@ class LLMOpsProvider implements LLMProvider {
             'temperature': temperature ?? 0.7,
             'stream': false,
           },
+          cancelToken: cancelToken,
           options: Options(headers: _headers),
         );
       }
@@ -190,7 +224,10 @@ class LLMOpsProvider implements LLMProvider {
         if (responseData['choices'] != null && 
             responseData['choices'].isNotEmpty &&
             responseData['choices'][0]['message'] != null) {
-          return responseData['choices'][0]['message']['content'] as String;
+          return LLMResponse(
+            content: responseData['choices'][0]['message']['content'] as String,
+            usage: TokenUsage.fromResponse(responseData),
+          );
         }
       }
       
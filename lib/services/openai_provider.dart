@@ -5,10 +5,27 @@ import '../models/openai_model.dart';
 import '../models/chat_message.dart';
 import '../models/app_config.dart';
 import '../models/llm_stream_chunk.dart';
+import '../models/rate_limit_status.dart';
+import '../utils/error_body.dart';
+import '../utils/model_capabilities.dart';
+import '../utils/logit_bias.dart';
+import '../utils/sse_completion.dart';
+import '../utils/extra_body_fields.dart';
+import '../models/finish_reason.dart';
+import '../models/token_usage.dart';
+import '../models/llm_response.dart';
+import '../models/endpoint_capabilities.dart';
+import '../exceptions/llm_exceptions.dart';
 import 'llm_provider.dart';
 import 'llm_streaming_provider.dart';
+import 'llm_vision_provider.dart';
+import 'llm_chat_provider.dart';
+import 'llm_structured_output_provider.dart';
+import 'request_abort_registry.dart';
+import 'http_client_config.dart';
 
-class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
+class OpenAIProvider
+    implements LLMProvider, LLMStreamingProvider, LLMVisionProvider, LLMChatProvider, LLMStructuredOutputProvider {
   @override
   bool get supportsStreaming => true;
   final Dio _dio = Dio();
@@ -18,7 +35,32 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
   bool _isLoading = false;
   String? _error;
   
-  OpenAIProvider(this._config);
+  RateLimitStatus? _rateLimitStatus;
+
+  OpenAIProvider(this._config) {
+    configureTls(_dio, _config);
+    _dio.interceptors.add(RequestAbortRegistry().interceptor);
+    // Лимиты приходят в заголовках любого ответа, в том числе 429
+    _dio.interceptors.add(InterceptorsWrapper(
+      onResponse: (response, handler) {
+        _updateRateLimit(response.headers);
+        handler.next(response);
+      },
+      onError: (error, handler) {
+        final headers = error.response?.headers;
+        if (headers != null) _updateRateLimit(headers);
+        handler.next(error);
+      },
+    ));
+  }
+
+  /// Последние известные лимиты запросов (null — шлюз их не сообщает)
+  RateLimitStatus? get rateLimitStatus => _rateLimitStatus;
+
+  void _updateRateLimit(Headers headers) {
+    final status = RateLimitStatus.fromHeaders(headers.value);
+    if (status != null) _rateLimitStatus = status;
+  }
 
   String _resolveModel(String? model) {
     if (model != null && model.isNotEmpty && model != 'default') {
@@ -34,6 +76,25 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
     return 'gpt-4o';
   }
 
+  // Шлюзы OpenRouter-типа ожидают ID вида 'openai/gpt-4o'; в UI показываем короткое имя
+  String? get _modelPrefix {
+    final prefix = _config.modelPrefix?.trim() ?? '';
+    if (prefix.isEmpty) return null;
+    return prefix.endsWith('/') ? prefix : '$prefix/';
+  }
+
+  String _applyModelPrefix(String model) {
+    final prefix = _modelPrefix;
+    if (prefix == null || model.startsWith(prefix) || model.contains('/')) return model;
+    return '$prefix$model';
+  }
+
+  String _stripModelPrefix(String model) {
+    final prefix = _modelPrefix;
+    if (prefix == null || !model.startsWith(prefix)) return model;
+    return model.substring(prefix.length);
+  }
+
   String _extractDetails(DioException e) {
     final data = e.response?.data;
     if (data is Map<String, dynamic>) {
@@ -43,7 +104,7 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
       }
       if (data['message'] != null) return data['message'].toString();
     }
-    if (data != null) return data.toString();
+    if (data != null) return describeErrorBody(data, statusCode: e.response?.statusCode);
     return e.message ?? 'DioException';
   }
 
@@ -54,17 +115,52 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
     return url;
   }
 
+  // Нестандартные шлюзы монтируют эндпоинты по другим путям
+  String get _completionsPath => _configuredPath(_config.completionsPath, 'chat/completions');
+  String get _modelsPath => _configuredPath(_config.modelsPath, 'models');
+  String get _healthPath => _configuredPath(_config.healthPath, _modelsPath);
+
+  String _configuredPath(String? configured, String fallback) {
+    final path = configured?.trim() ?? '';
+    if (path.isEmpty) return fallback;
+    return path.startsWith('/') ? path.substring(1) : path;
+  }
+
+  /// Добавляет в тело запроса поля шлюза из [AppConfig.extraBodyFields]
+  Map<String, dynamic> _withExtraBodyFields(Map<String, dynamic> body) =>
+      mergeExtraBodyFields(body, _config.extraBodyFields);
+
+  /// Добавляет `reasoning_effort` ([override] или из настроек) только для моделей,
+  /// которые его принимают: остальные отклоняют запрос с неизвестным параметром.
+  Map<String, dynamic> _withReasoningEffort(Map<String, dynamic> body, String model, [String? override]) {
+    final effort = (override ?? _config.reasoningEffort)?.trim().toLowerCase();
+    if (effort == null || effort.isEmpty || !supportsReasoningEffort(model)) return body;
+    return {...body, 'reasoning_effort': effort};
+  }
+
   String _endpoint(String path) {
     if (path.startsWith('/')) path = path.substring(1);
     return '$_baseUrl/$path';
   }
   
-  // Инициализируем таймауты (во избежание вечной загрузки моделей при сетевых проблемах)
+  // Соединение обрываем быстро, а ответ генерации ждём долго: на нестабильной сети
+  // лучше сразу узнать об ошибке подключения, но не обрывать длинное ТЗ
+  Duration get _connectTimeout {
+    final seconds = _config.connectTimeoutSeconds ?? 0;
+    return Duration(seconds: seconds > 0 ? seconds : 10);
+  }
+
+  Duration get _readTimeout {
+    final seconds = _config.readTimeoutSeconds ?? 0;
+    return Duration(seconds: seconds > 0 ? seconds : 300);
+  }
+
+  // Инициализируем таймауты (во избежание вечной загрузки моделей при сетевых проблемах).
+  // receiveTimeout по умолчанию — для лёгких запросов (список моделей); генерация передаёт _readTimeout
   void _ensureTimeouts() {
-    // Устанавливаем только один раз
-    if (_dio.options.connectTimeout == null || _dio.options.connectTimeout!.inMilliseconds > 15000) {
+    if (_dio.options.connectTimeout != _connectTimeout) {
       _dio.options = _dio.options.copyWith(
-        connectTimeout: const Duration(seconds: 10),
+        connectTimeout: _connectTimeout,
         receiveTimeout: const Duration(seconds: 20),
         sendTimeout: const Duration(seconds: 20),
       );
@@ -82,6 +178,69 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
   
   @override
   String? get error => _error;
+
+  FinishReason? _lastFinishReason;
+
+  @override
+  FinishReason? get lastFinishReason => _lastFinishReason;
+
+  String? _lastRawResponse;
+
+  /// Тело последнего ответа chat/completions в JSON (при captureRawResponses).
+  /// Ключ передаётся только в заголовке запроса, поэтому в тело не попадает.
+  String? get lastRawResponse => _lastRawResponse;
+
+  void _captureRawResponse(Object? data) {
+    if (_config.captureRawResponses != true || data == null) return;
+    try {
+      _lastRawResponse = data is String ? data : const JsonEncoder.withIndent('  ').convert(data);
+    } catch (_) {
+      _lastRawResponse = data.toString();
+    }
+  }
+
+  // Рассуждения отдельным полем ответа (reasoning_content у DeepSeek/vLLM, reasoning
+  // у OpenRouter) оформляем как <think>, чтобы LLMService отделял их одинаково
+  // независимо от того, как их вернула модель
+  String _withReasoning(String content, dynamic data) {
+    try {
+      final message = (data['choices'] as List).first['message'] as Map;
+      final value = message['reasoning_content'] ?? message['reasoning'];
+      if (value is String && value.trim().isNotEmpty) {
+        return '<think>${value.trim()}</think>\n$content';
+      }
+    } catch (_) {}
+    return content;
+  }
+
+  // Шлюз с неверной настройкой может ответить SSE на запрос со stream: false —
+  // собираем ответ из событий, а если не получилось, объясняем причину
+  Map<String, dynamic> _completionData(Response response) {
+    final data = response.data;
+    if (data is Map<String, dynamic> && !looksLikeEventStream(response.headers.value(Headers.contentTypeHeader), null)) {
+      return data;
+    }
+    final body = data is String ? data : data is List<int> ? utf8.decode(data) : null;
+    if (body != null && looksLikeEventStream(response.headers.value(Headers.contentTypeHeader), body)) {
+      try {
+        return completionFromEventStream(body);
+      } on FormatException catch (e) {
+        throw Exception('Шлюз вернул поток text/event-stream на запрос без stream, '
+            'и его не удалось разобрать (${e.message}). Проверьте настройки шлюза или включите потоковую генерацию');
+      }
+    }
+    if (data is Map) return Map<String, dynamic>.from(data);
+    throw Exception('Шлюз вернул ответ не в формате JSON '
+        '(Content-Type: ${response.headers.value(Headers.contentTypeHeader) ?? 'не указан'})');
+  }
+
+  String _contentOf(ChatChoice choice) {
+    _lastFinishReason = FinishReason.parse(choice.finishReason);
+    if (_lastFinishReason == FinishReason.contentFilter) {
+      throw const ContentFilteredException();
+    }
+    return choice.message.content;
+  }
   
   @override
   Future<bool> testConnection() async {
@@ -91,7 +250,7 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
       _error = null;
       
       final response = await _dio.get(
-        _endpoint('models'),
+        _endpoint(_modelsPath),
         options: Options(
           headers: {
             'Authorization': 'Bearer ${_config.apiToken}',
@@ -102,11 +261,23 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
       
       if (response.statusCode == 200) {
         final modelsResponse = OpenAIModelsResponse.fromJson(response.data);
-        _availableModels = modelsResponse.data.map((model) => model.id).toList();
+        _modelEntries = {
+          for (final model in modelsResponse.data) _stripModelPrefix(model.id): model,
+        };
+        _availableModels = modelsResponse.data.map((model) => _stripModelPrefix(model.id)).toList();
         _availableModels.sort();
         return true;
       }
       return false;
+    } on DioException catch (e) {
+      // Ключ может разрешать генерацию, но не листинг моделей — проверяем его запросом на 1 токен
+      final status = e.response?.statusCode;
+      if (status == 403 || status == 404) {
+        _isLoading = false;
+        return validateKeyByCompletion();
+      }
+      _error = 'Не удалось подключиться к OpenAI API: ${status ?? 'no-status'} ${_extractDetails(e)}';
+      return false;
     } catch (e) {
       _error = 'Не удалось подключиться к OpenAI API: $e';
       return false;
@@ -114,7 +285,191 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
       _isLoading = false;
     }
   }
+
+  /// Проверка ключа минимальным запросом генерации (1 токен) вместо листинга /models.
+  /// При успехе список моделей состоит из проверенной модели.
+  Future<bool> validateKeyByCompletion([String? model]) async {
+    final resolved = _resolveModel(model);
+    try {
+      await sendMessages(
+        messages: [ChatMessage(role: 'user', content: 'ping')],
+        model: resolved,
+        maxTokens: 1,
+        temperature: 0,
+      );
+      if (_availableModels.isEmpty) _availableModels = [resolved];
+      _error = null;
+      return true;
+    } catch (e) {
+      final raw = e.toString();
+      _error = 'Не удалось проверить ключ запросом к модели $resolved: '
+          '${raw.startsWith('Exception: ') ? raw.substring('Exception: '.length) : raw}';
+      return false;
+    }
+  }
   
+  /// Таймаут одного пробного запроса [probeCapabilities]
+  static const Duration probeTimeout = Duration(seconds: 15);
+
+  /// Выясняет возможности шлюза запросами на 1 токен: JSON-режим, потоковую генерацию
+  /// и usage в потоке. Ошибки не пробрасываются — возможность остаётся неизвестной (null).
+  Future<EndpointCapabilities> probeCapabilities({String? model, Duration timeout = probeTimeout}) async {
+    final resolvedModel = _resolveModel(model);
+    Future<Response<dynamic>> post(Map<String, dynamic> extra, {bool stream = false}) {
+      return _dio.post<dynamic>(
+        _endpoint(_completionsPath),
+        data: _withExtraBodyFields({
+          'model': _applyModelPrefix(resolvedModel),
+          'messages': [
+            {'role': 'user', 'content': 'Reply with {"ok": true} as JSON.'},
+          ],
+          'max_tokens': 1,
+          'temperature': 0,
+          ...extra,
+        }),
+        options: Options(
+          headers: {
+            'Authorization': 'Bearer ${_config.apiToken}',
+            'Content-Type': 'application/json',
+            if (stream) 'Accept': 'text/event-stream',
+          },
+          sendTimeout: timeout,
+          receiveTimeout: timeout,
+          validateStatus: (_) => true,
+          responseType: stream ? ResponseType.plain : ResponseType.json,
+        ),
+      ).timeout(timeout);
+    }
+
+    // 2xx — поддерживается, 400/422 — шлюз отверг параметр, остальное — неизвестно
+    bool? verdict(int? status) {
+      if (status == null) return null;
+      if (status >= 200 && status < 300) return true;
+      if (status == 400 || status == 422) return false;
+      return null;
+    }
+
+    bool? jsonMode;
+    try {
+      final response = await post({'response_format': {'type': 'json_object'}});
+      jsonMode = verdict(response.statusCode);
+    } catch (e) {
+      print('OpenAIProvider: JSON mode probe failed: $e');
+    }
+
+    bool? streaming;
+    bool? streamUsage;
+    try {
+      var response = await post({'stream': true, 'stream_options': {'include_usage': true}}, stream: true);
+      if (verdict(response.statusCode) == false) {
+        // Часть шлюзов не знает stream_options — проверяем поток без него
+        streamUsage = false;
+        response = await post({'stream': true}, stream: true);
+      }
+      final body = response.data?.toString() ?? '';
+      final events = body
+          .split('\n')
+          .map((l) => l.trim())
+          .where((l) => l.startsWith('data:') && l != 'data: [DONE]')
+          .toList();
+      final status = verdict(response.statusCode);
+      streaming = status == true ? events.isNotEmpty : status;
+      if (streaming == true && streamUsage == null) {
+        streamUsage = events.any((e) {
+          try {
+            final decoded = jsonDecode(e.substring('data:'.length).trim());
+            return decoded is Map && decoded['usage'] is Map;
+          } catch (_) {
+            return false;
+          }
+        });
+      }
+    } catch (e) {
+      print('OpenAIProvider: streaming probe failed: $e');
+    }
+
+    return EndpointCapabilities(
+      endpoint: _config.apiUrl.trim(),
+      streaming: streaming,
+      jsonMode: jsonMode,
+      streamUsage: streaming == false ? false : streamUsage,
+      probedAt: DateTime.now(),
+    );
+  }
+
+  /// Таймаут ping: индикатор статуса опрашивает шлюз и не должен зависать
+  static const Duration pingTimeout = Duration(seconds: 5);
+
+  /// Быстрая проверка доступности шлюза запросом к [AppConfig.healthPath]
+  /// (по умолчанию — список моделей). Не трогает кеш моделей и таймауты генерации.
+  /// Бросает исключение, если шлюз не ответил 2xx за [timeout].
+  Future<void> ping({Duration timeout = pingTimeout}) async {
+    final cancelToken = CancelToken();
+    try {
+      final response = await _dio.get(
+        _endpoint(_healthPath),
+        cancelToken: cancelToken,
+        options: Options(
+          headers: {'Authorization': 'Bearer ${_config.apiToken}'},
+          sendTimeout: timeout,
+          receiveTimeout: timeout,
+          // Статус проверяем сами, тело ответа не нужно
+          validateStatus: (_) => true,
+          responseType: ResponseType.plain,
+        ),
+      ).timeout(timeout, onTimeout: () {
+        cancelToken.cancel('ping_timeout');
+        throw TimeoutException('Ping timed out', timeout);
+      });
+      final status = response.statusCode ?? 0;
+      if (status < 200 || status >= 300) {
+        throw Exception('Ping failed: HTTP $status');
+      }
+    } on DioException catch (e) {
+      throw Exception('Ping failed: ${_extractDetails(e)}');
+    }
+  }
+
+  // Записи последнего ответа списка моделей — запасной источник для getModel
+  Map<String, OpenAIModel> _modelEntries = {};
+
+  /// Запись модели из последнего списка /models (null — модели нет в списке)
+  OpenAIModel? cachedModel(String id) => _modelEntries[id];
+
+  /// Подробности модели из `/models/{id}`. Если шлюз не поддерживает этот
+  /// эндпоинт (404/405/501), возвращается запись из списка моделей.
+  Future<OpenAIModel> getModel(String id) async {
+    _ensureTimeouts();
+    final remoteId = _applyModelPrefix(id);
+    try {
+      final response = await _dio.get(
+        _endpoint('$_modelsPath/${Uri.encodeComponent(remoteId)}'),
+        options: Options(
+          headers: {
+            'Authorization': 'Bearer ${_config.apiToken}',
+            'Content-Type': 'application/json',
+          },
+        ),
+      );
+      if (response.statusCode == 200 && response.data is Map) {
+        final data = Map<String, dynamic>.from(response.data as Map);
+        return OpenAIModel.fromDetails({...data, 'id': data['id'] ?? remoteId});
+      }
+      throw Exception('Failed to fetch model $id');
+    } on DioException catch (e) {
+      final status = e.response?.statusCode;
+      if (status != 404 && status != 405 && status != 501) {
+        throw Exception('Ошибка при получении модели $id: ${_extractDetails(e)}');
+      }
+    }
+    if (!_modelEntries.containsKey(id)) await getModels();
+    final entry = _modelEntries[id];
+    if (entry == null) {
+      throw ArgumentError('Model with id $id not found');
+    }
+    return entry;
+  }
+
   @override
   Future<List<String>> getModels() async {
   _ensureTimeouts();
@@ -123,7 +478,7 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
       _error = null;
       
       final response = await _dio.get(
-        _endpoint('models'),
+        _endpoint(_modelsPath),
         options: Options(
           headers: {
             'Authorization': 'Bearer ${_config.apiToken}',
@@ -134,7 +489,10 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
       
       if (response.statusCode == 200) {
         final modelsResponse = OpenAIModelsResponse.fromJson(response.data);
-        _availableModels = modelsResponse.data.map((model) => model.id).toList();
+        _modelEntries = {
+          for (final model in modelsResponse.data) _stripModelPrefix(model.id): model,
+        };
+        _availableModels = modelsResponse.data.map((model) => _stripModelPrefix(model.id)).toList();
         _availableModels.sort();
         return _availableModels;
       }
@@ -154,31 +512,138 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
     String? model,
     int? maxTokens,
     double? temperature,
+    String? reasoningEffort, // переопределяет AppConfig.reasoningEffort
+    Map<String, dynamic>? logitBias, // переопределяет AppConfig.logitBias
+    CancelToken? cancelToken, // отмена одного запроса (например, по лимиту времени генерации)
+  }) async {
+    final response = await sendRequestDetailed(
+      systemPrompt: systemPrompt,
+      userPrompt: userPrompt,
+      model: model,
+      maxTokens: maxTokens,
+      temperature: temperature,
+      reasoningEffort: reasoningEffort,
+      logitBias: logitBias,
+      cancelToken: cancelToken,
+    );
+    return response.content;
+  }
+
+  @override
+  Future<LLMResponse> sendRequestDetailed({
+    required String systemPrompt,
+    required String userPrompt,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+    String? reasoningEffort,
+    Map<String, dynamic>? logitBias,
+    CancelToken? cancelToken,
+  }) {
+    return _sendChat(
+      messages: [
+        ChatMessage(role: 'system', content: systemPrompt),
+        ChatMessage(role: 'user', content: userPrompt),
+      ],
+      model: model,
+      maxTokens: maxTokens,
+      temperature: temperature,
+      reasoningEffort: reasoningEffort,
+      logitBias: logitBias,
+      cancelToken: cancelToken,
+    );
+  }
+
+  @override
+  Future<String> sendMessages({
+    required List<ChatMessage> messages,
+    String? model,
+    int? maxTokens,
+    double? temperature,
   }) async {
+    final response = await sendMessagesDetailed(
+      messages: messages,
+      model: model,
+      maxTokens: maxTokens,
+      temperature: temperature,
+    );
+    return response.content;
+  }
+
+  @override
+  Future<LLMResponse> sendMessagesDetailed({
+    required List<ChatMessage> messages,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+  }) {
+    return _sendChat(messages: messages, model: model, maxTokens: maxTokens, temperature: temperature);
+  }
+
+  @override
+  Future<String> sendRequestWithSchema({
+    required String systemPrompt,
+    required String userPrompt,
+    required Map<String, dynamic> schema,
+    String schemaName = 'specification',
+    String? model,
+    int? maxTokens,
+    double? temperature,
+  }) async {
+    final response = await _sendChat(
+      messages: [
+        ChatMessage(role: 'system', content: systemPrompt),
+        ChatMessage(role: 'user', content: userPrompt),
+      ],
+      model: model,
+      maxTokens: maxTokens,
+      temperature: temperature,
+      responseFormat: {
+        'type': 'json_schema',
+        'json_schema': {'name': schemaName, 'strict': true, 'schema': schema},
+      },
+    );
+    return response.content;
+  }
+
+  Future<LLMResponse> _sendChat({
+    required List<ChatMessage> messages,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+    Map<String, dynamic>? responseFormat,
+    String? reasoningEffort,
+    Map<String, dynamic>? logitBias,
+    CancelToken? cancelToken,
+  }) async {
+    _ensureTimeouts();
+    final bias = logitBiasForRequest(logitBias ?? _config.logitBias);
     try {
       _isLoading = true;
       _error = null;
       
-      final messages = [
-        ChatMessage(role: 'system', content: systemPrompt),
-        ChatMessage(role: 'user', content: userPrompt),
-      ];
-      
+      final resolvedModel = _resolveModel(model);
       Future<Response> postOnce(int tokens) {
         final request = ChatRequest(
-          model: _resolveModel(model),
+          model: _applyModelPrefix(resolvedModel),
           messages: messages,
           maxTokens: tokens,
           temperature: temperature ?? 0.7,
         );
         return _dio.post(
-          _endpoint('chat/completions'),
-          data: request.toJson(),
+          _endpoint(_completionsPath),
+          data: _withExtraBodyFields(_withReasoningEffort({
+            ...request.toJson(),
+            if (responseFormat != null) 'response_format': responseFormat,
+            if (bias != null) 'logit_bias': bias,
+          }, resolvedModel, reasoningEffort)),
+          cancelToken: cancelToken,
           options: Options(
             headers: {
               'Authorization': 'Bearer ${_config.apiToken}',
               'Content-Type': 'application/json',
             },
+            receiveTimeout: _readTimeout,
           ),
         );
       }
@@ -196,17 +661,25 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
         if (!shouldRetry) rethrow;
         response = await postOnce(1024);
       }
+      _captureRawResponse(response.data);
       
       if (response.statusCode == 200) {
-        final chatResponse = ChatResponse.fromJson(response.data);
+        final data = _completionData(response);
+        final chatResponse = ChatResponse.fromJson(data);
         if (chatResponse.choices.isNotEmpty) {
-          return chatResponse.choices.first.message.content;
+          final choice = chatResponse.choices.first;
+          return LLMResponse(
+            content: _withReasoning(_contentOf(choice), data),
+            usage: TokenUsage.fromResponse(data),
+            finishReason: FinishReason.parse(choice.finishReason),
+          );
         }
       }
       
-      throw Exception('Пустой ответ от OpenAI API');
+      throw const EmptyResponseException('OpenAI API');
     } catch (e) {
       if (e is DioException) {
+        _captureRawResponse(e.response?.data);
         final status = e.response?.statusCode;
         final details = _extractDetails(e);
         _error = 'Ошибка при отправке запроса: ${status ?? 'no-status'} $details';
@@ -219,6 +692,99 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
     }
   }
 
+  // ---- Vision (multimodal) implementation ---------------------------------------
+
+  // Семейства моделей, принимающих изображения в content
+  static final List<RegExp> _visionModelPatterns = [
+    RegExp(r'gpt-4o'),
+    RegExp(r'gpt-4\.1'),
+    RegExp(r'gpt-4-turbo'),
+    RegExp(r'gpt-5'),
+    RegExp(r'vision'),
+    RegExp(r'claude-3'),
+    RegExp(r'claude-(sonnet|opus|haiku)-4'),
+    RegExp(r'gemini'),
+    RegExp(r'llava'),
+    RegExp(r'pixtral'),
+    RegExp(r'qwen.*vl'),
+  ];
+
+  @override
+  bool supportsVision(String? model) {
+    final id = _resolveModel(model).toLowerCase();
+    return _visionModelPatterns.any((p) => p.hasMatch(id));
+  }
+
+  @override
+  Future<String> sendRequestWithImage({
+    required String systemPrompt,
+    required String userPrompt,
+    required String imageDataUrl,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+  }) async {
+    _ensureTimeouts();
+    try {
+      _isLoading = true;
+      _error = null;
+
+      final requestMap = {
+        'model': _applyModelPrefix(_resolveModel(model)),
+        'messages': [
+          {'role': 'system', 'content': systemPrompt},
+          {
+            'role': 'user',
+            'content': [
+              {'type': 'text', 'text': userPrompt},
+              {
+                'type': 'image_url',
+                'image_url': {'url': imageDataUrl},
+              },
+            ],
+          },
+        ],
+        'max_tokens': maxTokens ?? 4000,
+        'temperature': temperature ?? 0.7,
+      };
+
+      final response = await _dio.post(
+        _endpoint(_completionsPath),
+        data: _withExtraBodyFields(requestMap),
+        options: Options(
+          headers: {
+            'Authorization': 'Bearer ${_config.apiToken}',
+            'Content-Type': 'application/json',
+          },
+          receiveTimeout: _readTimeout,
+        ),
+      );
+      _captureRawResponse(response.data);
+
+      if (response.statusCode == 200) {
+        final data = _completionData(response);
+        final chatResponse = ChatResponse.fromJson(data);
+        if (chatResponse.choices.isNotEmpty) {
+          return _withReasoning(_contentOf(chatResponse.choices.first), data);
+        }
+      }
+
+      throw const EmptyResponseException('OpenAI API');
+    } catch (e) {
+      if (e is DioException) {
+        _captureRawResponse(e.response?.data);
+        final status = e.response?.statusCode;
+        final details = _extractDetails(e);
+        _error = 'Ошибка при отправке запроса с изображением: ${status ?? 'no-status'} $details';
+        throw Exception('OpenAI vision request failed (${status ?? 'no-status'}): $details');
+      }
+      _error = 'Ошибка при отправке запроса с изображением: $e';
+      rethrow;
+    } finally {
+      _isLoading = false;
+    }
+  }
+
   // ---- Streaming implementation -------------------------------------------------
 
   @override
@@ -230,19 +796,23 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
     double? temperature,
     CancelToken? cancelToken,
   }) async* {
+    _ensureTimeouts();
     // Compose messages like in sendRequest
     final messages = [
       ChatMessage(role: 'system', content: systemPrompt),
       ChatMessage(role: 'user', content: userPrompt),
     ];
 
-    final requestMap = {
-      'model': _resolveModel(model),
+    final resolvedModel = _resolveModel(model);
+    final bias = logitBiasForRequest(_config.logitBias);
+    final requestMap = _withExtraBodyFields(_withReasoningEffort({
+      'model': _applyModelPrefix(resolvedModel),
       'messages': messages.map((m) => m.toJson()).toList(),
       'temperature': temperature ?? 0.7,
       if (maxTokens != null) 'max_tokens': maxTokens,
+      if (bias != null) 'logit_bias': bias,
       'stream': true,
-    };
+    }, resolvedModel));
 
     Response<ResponseBody> response;
     Future<Response<ResponseBody>> doStreamCall(String path) {
@@ -258,12 +828,14 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
             'Cache-Control': 'no-cache',
           },
           responseType: ResponseType.stream,
+          // Для потока это максимальная пауза между чанками
+          receiveTimeout: _readTimeout,
         ),
         cancelToken: cancelToken,
       );
     }
     try {
-      response = await doStreamCall('chat/completions');
+      response = await doStreamCall(_completionsPath);
     } on DioException catch (e) {
       // Retry heuristics for 404 (common with mis-specified base URL or missing /v1)
       final status = e.response?.statusCode;
@@ -273,7 +845,7 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
           final alt = _baseUrl.substring(0, _baseUrl.length - 3); // remove '/v1'
           try {
             response = await _dio.post<ResponseBody>(
-              '$alt/chat/completions',
+              '$alt/$_completionsPath',
               data: jsonEncode(requestMap),
               options: Options(
                 headers: {
@@ -283,6 +855,7 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
                   'Cache-Control': 'no-cache',
                 },
                 responseType: ResponseType.stream,
+                receiveTimeout: _readTimeout,
               ),
               cancelToken: cancelToken,
             );
@@ -294,7 +867,7 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
           // Heuristic 2: If base missing /v1, try adding it
             try {
               response = await _dio.post<ResponseBody>(
-                '$_baseUrl/v1/chat/completions',
+                '$_baseUrl/v1/$_completionsPath',
                 data: jsonEncode(requestMap),
                 options: Options(
                   headers: {
@@ -304,6 +877,7 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
                     'Cache-Control': 'no-cache',
                   },
                   responseType: ResponseType.stream,
+                  receiveTimeout: _readTimeout,
                 ),
                 cancelToken: cancelToken,
               );
@@ -327,39 +901,49 @@ class OpenAIProvider implements LLMProvider, LLMStreamingProvider {
         .transform(const LineSplitter());
 
     final StringBuffer assembled = StringBuffer();
-    await for (final rawLine in stream) {
-      final line = rawLine.trim();
-      if (line.isEmpty) continue; // keep-alive newline
-      if (!line.startsWith('data:')) continue; // ignore any non-data lines
-      final data = line.substring(5).trim();
-      if (data == '[DONE]') {
-        yield LLMStreamChunkFinal(full: assembled.isNotEmpty ? assembled.toString() : null, finishReason: 'stop');
-        break;
-      }
-      try {
-        final jsonObj = jsonDecode(data) as Map<String, dynamic>;
-        final choices = jsonObj['choices'];
-        if (choices is List && choices.isNotEmpty) {
-          final first = choices.first as Map<String, dynamic>;
-          final delta = first['delta'] as Map<String, dynamic>?;
-          final finish = first['finish_reason'];
-          if (delta != null && delta.containsKey('content')) {
-            final piece = delta['content']?.toString() ?? '';
-            if (piece.isNotEmpty) {
-              assembled.write(piece);
-              yield LLMStreamChunkDelta(piece);
+    try {
+      await for (final rawLine in stream) {
+        final line = rawLine.trim();
+        if (line.isEmpty) continue; // keep-alive newline
+        if (!line.startsWith('data:')) continue; // ignore any non-data lines
+        final data = line.substring(5).trim();
+        if (data == '[DONE]') {
+          yield LLMStreamChunkFinal(full: assembled.isNotEmpty ? assembled.toString() : null, finishReason: 'stop');
+          break;
+        }
+        try {
+          final jsonObj = jsonDecode(data) as Map<String, dynamic>;
+          final choices = jsonObj['choices'];
+          if (choices is List && choices.isNotEmpty) {
+            final first = choices.first as Map<String, dynamic>;
+            final delta = first['delta'] as Map<String, dynamic>?;
+            final finish = first['finish_reason'];
+            if (delta != null && delta.containsKey('content')) {
+              final piece = delta['content']?.toString() ?? '';
+              if (piece.isNotEmpty) {
+                assembled.write(piece);
+                yield LLMStreamChunkDelta(piece);
+              }
+            }
+            if (finish != null && finish != 'null') {
+              _lastFinishReason = FinishReason.parse(finish.toString());
+              if (_lastFinishReason == FinishReason.contentFilter) {
+                yield LLMStreamChunkError(const ContentFilteredException().message);
+                break;
+              }
+              // Some APIs send finish_reason early; close.
+              yield LLMStreamChunkFinal(full: assembled.toString(), finishReason: finish.toString());
+              break;
             }
           }
-          if (finish != null && finish != 'null') {
-            // Some APIs send finish_reason early; close.
-            yield LLMStreamChunkFinal(full: assembled.toString(), finishReason: finish.toString());
-            break;
-          }
+        } catch (e) {
+          yield LLMStreamChunkError('Stream parse error: $e');
+          break;
         }
-      } catch (e) {
-        yield LLMStreamChunkError('Stream parse error: $e');
-        break;
       }
+    } finally {
+      // The stream is done or abandoned; stop linking its token to abortAll
+      RequestAbortRegistry().release(cancelToken);
     }
   }
 }
@@ -0,0 +1,96 @@
+import 'dart:convert';
+import 'dart:io';
+import 'package:flutter/foundation.dart';
+import 'package:path_provider/path_provider.dart';
+import '../models/prompt_snippet.dart';
+import '../utils/atomic_file.dart';
+
+/// Библиотека фрагментов промта, независимая от шаблонов ТЗ
+/// (JSON-файл `snippets.json` в каталоге поддержки приложения).
+class PromptSnippetService extends ChangeNotifier {
+  final List<PromptSnippet> _snippets = [];
+  Future<void>? _loadFuture;
+
+  List<PromptSnippet> get snippets => List.unmodifiable(_snippets);
+
+  Future<File> _snippetsFile() async {
+    final dir = await getApplicationSupportDirectory();
+    return File('${dir.path}/snippets.json');
+  }
+
+  /// Загружает фрагменты с диска (однократно)
+  Future<void> init() => _loadFuture ??= _load();
+
+  Future<void> _load() async {
+    try {
+      final f = await _snippetsFile();
+      if (!await f.exists()) return;
+      final content = await f.readAsString();
+      if (content.trim().isEmpty) return;
+      final list = jsonDecode(content) as List<dynamic>;
+      _snippets
+        ..clear()
+        ..addAll(list.whereType<Map<String, dynamic>>().map(PromptSnippet.fromJson));
+      notifyListeners();
+    } catch (e) {
+      print('Ошибка чтения библиотеки фрагментов: $e');
+    }
+  }
+
+  Future<void> _save() async {
+    final f = await _snippetsFile();
+    await writeStringAtomically(f, jsonEncode(_snippets.map((s) => s.toJson()).toList()));
+  }
+
+  Future<List<PromptSnippet>> getSnippets() async {
+    await init();
+    return snippets;
+  }
+
+  PromptSnippet? getSnippet(String id) {
+    for (final s in _snippets) {
+      if (s.id == id) return s;
+    }
+    return null;
+  }
+
+  Future<PromptSnippet> addSnippet(String name, String content) async {
+    await init();
+    if (name.trim().isEmpty) {
+      throw ArgumentError('Название фрагмента не может быть пустым');
+    }
+    if (content.trim().isEmpty) {
+      throw ArgumentError('Текст фрагмента не может быть пустым');
+    }
+    final snippet = PromptSnippet(name: name.trim(), content: content.trim());
+    _snippets.add(snippet);
+    notifyListeners();
+    await _save();
+    return snippet;
+  }
+
+  Future<void> deleteSnippet(String id) async {
+    await init();
+    final before = _snippets.length;
+    _snippets.removeWhere((s) => s.id == id);
+    if (_snippets.length == before) {
+      throw ArgumentError('Snippet with id $id not found');
+    }
+    notifyListeners();
+    await _save();
+  }
+
+  /// Тексты фрагментов по [ids] в переданном порядке
+  Future<List<String>> resolveSnippets(List<String> ids) async {
+    await init();
+    final result = <String>[];
+    for (final id in ids) {
+      final snippet = getSnippet(id);
+      if (snippet == null) {
+        throw ArgumentError('Snippet with id $id not found');
+      }
+      result.add(snippet.content);
+    }
+    return result;
+  }
+}
@@ -0,0 +1,71 @@
+import 'package:dio/dio.dart';
+
+/// Общая точка отмены всех сетевых запросов к LLM (генерации, проверки
+/// соединения, загрузка моделей). Каждый провайдер подключает [interceptor]
+/// к своему Dio; [abortAll] отменяет всё, что выполняется сейчас, после чего
+/// новые запросы работают как обычно.
+class RequestAbortRegistry {
+  static final RequestAbortRegistry _instance = RequestAbortRegistry._internal();
+  factory RequestAbortRegistry() => _instance;
+  RequestAbortRegistry._internal();
+
+  CancelToken _token = CancelToken();
+
+  /// Токен текущего «поколения» запросов
+  CancelToken get token => _token;
+
+  // Собственные токены выполняющихся запросов -> число таких запросов. Связь живёт
+  // только пока запрос выполняется, чтобы завершённые запросы не удерживались в памяти
+  final Map<CancelToken, int> _linked = {};
+
+  /// Привязывает запросы без собственного токена к [token]. Запросы со своим
+  /// токеном (например, потоковая генерация) отменяются в [abortAll], пока выполняются.
+  late final Interceptor interceptor = InterceptorsWrapper(
+    onRequest: (options, handler) {
+      final own = options.cancelToken;
+      if (own == null) {
+        options.cancelToken = _token;
+      } else if (!identical(own, _token)) {
+        _linked[own] = (_linked[own] ?? 0) + 1;
+      }
+      handler.next(options);
+    },
+    onResponse: (response, handler) {
+      // Поток читается уже после ответа — его связь снимает [release]
+      if (response.requestOptions.responseType != ResponseType.stream) {
+        _unlink(response.requestOptions.cancelToken);
+      }
+      handler.next(response);
+    },
+    onError: (error, handler) {
+      _unlink(error.requestOptions.cancelToken);
+      handler.next(error);
+    },
+  );
+
+  /// Снимает связь запроса с потоковым ответом ([ResponseType.stream]), когда поток дочитан
+  void release(CancelToken? token) => _unlink(token);
+
+  void _unlink(CancelToken? token) {
+    if (token == null) return;
+    final count = _linked[token];
+    if (count == null) return;
+    if (count > 1) {
+      _linked[token] = count - 1;
+    } else {
+      _linked.remove(token);
+    }
+  }
+
+  /// Отменяет все выполняющиеся запросы и начинает новое поколение
+  void abortAll() {
+    final previous = _token;
+    _token = CancelToken();
+    final linked = _linked.keys.toList();
+    _linked.clear();
+    previous.cancel('abort_all');
+    for (final own in linked) {
+      if (!own.isCancelled) own.cancel('abort_all');
+    }
+  }
+}
@@ -0,0 +1,54 @@
+import 'dart:async';
+import 'package:flutter/foundation.dart';
+import 'package:hive/hive.dart';
+import '../utils/atomic_file.dart';
+import 'error_log_service.dart';
+import 'request_abort_registry.dart';
+
+/// Корректное завершение приложения: отменяет выполняющиеся генерации,
+/// сбрасывает на диск отложенные сохранения и закрывает Hive.
+/// Вызывается при запросе закрытия окна (см. `AppLifecycleListener` в main.dart).
+class ShutdownService {
+  static final ShutdownService _instance = ShutdownService._internal();
+  factory ShutdownService() => _instance;
+  ShutdownService._internal();
+
+  /// Сколько ждём завершения записей, прежде чем закрыть приложение
+  static const Duration defaultTimeout = Duration(seconds: 3);
+
+  final Map<String, Future<void> Function()> _flushHandlers = {};
+  Future<void>? _shutdown;
+
+  /// Регистрирует сброс отложенных сохранений сервиса [name]
+  void addFlushHandler(String name, Future<void> Function() handler) {
+    _flushHandlers[name] = handler;
+  }
+
+  void removeFlushHandler(String name) => _flushHandlers.remove(name);
+
+  /// Выполняет завершение один раз; повторные вызовы ждут первый.
+  /// Не дольше [timeout]: зависшая запись не должна блокировать закрытие окна.
+  Future<void> shutdown({Duration timeout = defaultTimeout}) {
+    return _shutdown ??= _run().timeout(timeout, onTimeout: () {
+      debugPrint('[ShutdownService] timeout after ${timeout.inSeconds}s — closing anyway');
+    });
+  }
+
+  Future<void> _run() async {
+    // Прерванные генерации ничего не пишут, поэтому отменяем их первыми
+    RequestAbortRegistry().abortAll();
+    for (final entry in _flushHandlers.entries.toList()) {
+      try {
+        await entry.value();
+      } catch (e) {
+        ErrorLogService().record('shutdown:${entry.key}', e);
+      }
+    }
+    await flushPendingWrites();
+    try {
+      await Hive.close();
+    } catch (e) {
+      ErrorLogService().record('shutdown:hive', e);
+    }
+  }
+}
@@ -0,0 +1,52 @@
+import 'dart:async';
+import 'dart:io';
+import 'error_log_service.dart';
+
+/// Ошибка одного из этапов запуска приложения
+class StartupErrorEvent {
+  final String stage; // 'config', 'theme', 'templates'
+  final String message;
+  final DateTime timestamp;
+
+  const StartupErrorEvent({
+    required this.stage,
+    required this.message,
+    required this.timestamp,
+  });
+
+  /// Человекочитаемое название этапа для уведомлений
+  String get stageLabel {
+    switch (stage) {
+      case 'config':
+        return 'Загрузка конфигурации';
+      case 'theme':
+        return 'Применение темы';
+      case 'templates':
+        return 'Загрузка шаблонов';
+      default:
+        return stage;
+    }
+  }
+}
+
+/// Шина событий запуска: ошибки инициализации публикуются сюда, а UI
+/// показывает их уведомлениями вместо молчаливого вывода в консоль.
+class StartupEvents {
+  static final StreamController<StartupErrorEvent> _errors =
+      StreamController<StartupErrorEvent>.broadcast();
+
+  /// Поток ошибок этапов запуска (событие `startup:error`)
+  static Stream<StartupErrorEvent> get errors => _errors.stream;
+
+  /// Публикует ошибку этапа [stage]. Дублирует её в stderr на случай,
+  /// если UI ещё не подписан на события.
+  static void reportError(String stage, Object error) {
+    final raw = error.toString();
+    final message = raw.startsWith('Exception: ') ? raw.substring('Exception: '.length) : raw;
+    try {
+      stderr.writeln('[startup:error] $stage: $message');
+    } catch (_) {}
+    ErrorLogService().record('startup:$stage', message);
+    _errors.add(StartupErrorEvent(stage: stage, message: message, timestamp: DateTime.now()));
+  }
+}
@@ -1,9 +1,11 @@
 import 'dart:async';
 import 'dart:convert';
+import 'dart:io';
 import '../models/output_format.dart';
 import '../models/llm_stream_chunk.dart';
 import 'llm_service.dart';
 import 'llm_streaming_provider.dart';
+import 'error_log_service.dart';
 import 'package:dio/dio.dart';
 
 /// Service that produces an NDJSON streaming simulation (status / content / final)
@@ -24,8 +26,11 @@ class StreamingLLMService {
     String? changes,
     String? templateContent,
     required OutputFormat format,
+    List<String> promptSnippets = const [],
+    String? stopMarker, // поток прерывается, как только в ответе появится этот маркер
   }) {
   final controller = StreamController<String>();
+    final marker = (stopMarker != null && stopMarker.isNotEmpty) ? stopMarker : null;
     final startTs = DateTime.now().toUtc();
 
     String isoNow() => DateTime.now().toUtc().toIso8601String();
@@ -71,7 +76,9 @@ class StreamingLLMService {
             templateContent: templateContent,
             format: format,
             forStreaming: false,
+            promptSnippets: promptSnippets,
           );
+          _llmService.checkRequestSize(systemPrompt: prompts['system']!, userPrompt: prompts['user']!);
           addJson({
             'stream_type': 'status',
             'phase': 'structure',
@@ -85,22 +92,63 @@ class StreamingLLMService {
           _activeCancelToken = CancelToken();
 
           bool gotFinal = false;
+          final received = StringBuffer(); // весь ответ — маркер может прийти по частям
+          var emitted = 0;
 
-          await for (final chunk in streamingProvider.streamChat(
-            systemPrompt: prompts['system']!,
-            userPrompt: prompts['user']!,
-            model: null,
-            cancelToken: _activeCancelToken,
+          await for (final chunk in _withIdleTimeout(
+            streamingProvider.streamChat(
+              systemPrompt: prompts['system']!,
+              userPrompt: prompts['user']!,
+              model: null,
+              cancelToken: _activeCancelToken,
+            ),
+            _activeCancelToken!,
           )) {
             if (chunk is LLMStreamChunkDelta) {
               final delta = chunk.delta;
-              if (delta.isNotEmpty) {
+              if (delta.isEmpty) continue;
+              received.write(delta);
+              final text = received.toString();
+              final markerAt = marker != null ? text.indexOf(marker) : -1;
+              if (markerAt < 0) {
                 addJson({
                   'stream_type': 'content',
                   'append': delta,
                 });
+                emitted = text.length;
+                continue;
               }
+              // Маркер найден: отдаём текст до него включительно и закрываем соединение,
+              // чтобы модель не продолжала писать после окончания документа
+              final end = markerAt + marker!.length;
+              if (end > emitted) {
+                addJson({
+                  'stream_type': 'content',
+                  'append': text.substring(emitted, end),
+                });
+              }
+              _activeCancelToken?.cancel('stop_marker');
+              addJson({
+                'stream_type': 'content',
+                'full': _llmService.postProcessOutput(text.substring(0, end)),
+              });
+              addJson({
+                'stream_type': 'status',
+                'phase': 'finalize',
+                'progress': 99,
+                'message': 'Финализация',
+                'ts': isoNow(),
+              });
+              addJson({
+                'stream_type': 'final',
+                'progress': 100,
+                'message': 'Готово',
+                'summary': 'Стрим остановлен по маркеру за ${DateTime.now().difference(started).inSeconds}s'
+              });
+              gotFinal = true;
+              break;
             } else if (chunk is LLMStreamChunkError) {
+              ErrorLogService().record('streaming', chunk.message);
               addJson({
                 'stream_type': 'status',
                 'phase': 'finalize',
@@ -121,7 +169,7 @@ class StreamingLLMService {
               if (full != null && full.isNotEmpty) {
                 addJson({
                   'stream_type': 'content',
-                  'full': full,
+                  'full': _llmService.postProcessOutput(full),
                 });
               }
               if (!gotFinal) {
@@ -143,6 +191,7 @@ class StreamingLLMService {
             }
           }
         } catch (e) {
+          ErrorLogService().record('streaming', e);
           addJson({
             'stream_type': 'status',
             'phase': 'finalize',
@@ -193,11 +242,13 @@ class StreamingLLMService {
           changes: changes,
           templateContent: activeTemplate.isEmpty ? null : activeTemplate,
           format: format,
+          promptSnippets: promptSnippets,
         );
 
         // Extract actual content markers if present (reuse llm_service processors indirectly handled by caller)
         // We split by double newline to keep paragraphs small.
-        final cleaned = generated;
+        final markerAt = marker != null ? generated.indexOf(marker) : -1;
+        final cleaned = markerAt >= 0 ? generated.substring(0, markerAt + marker!.length) : generated;
         final paragraphs = _splitIntoChunks(cleaned);
         if (paragraphs.isEmpty) {
           addJson({
@@ -265,6 +316,113 @@ class StreamingLLMService {
     return controller.stream;
   }
 
+  /// Генерирует ТЗ с записью в файл [destPath] по мере поступления чанков, чтобы
+  /// при сбое или отмене ([abortCurrent]) не терять уже полученный текст.
+  /// Частичный файл сохраняется. Возвращает true при полном завершении и false при отмене.
+  Future<bool> generateToFile({
+    required String rawRequirements,
+    String? changes,
+    String? templateContent,
+    required OutputFormat format,
+    required String destPath,
+    List<String> promptSnippets = const [],
+  }) async {
+    final provider = _llmService.provider;
+    final file = File(destPath);
+
+    if (provider is! LLMStreamingProvider || !(provider as LLMStreamingProvider).supportsStreaming) {
+      // Без потоковой генерации пишем документ целиком по готовности
+      final cancelToken = CancelToken();
+      _activeCancelToken = cancelToken;
+      final String generated;
+      try {
+        generated = await _llmService.generateTZ(
+          rawRequirements: rawRequirements,
+          changes: changes,
+          templateContent: templateContent,
+          format: format,
+          promptSnippets: promptSnippets,
+          cancelToken: cancelToken,
+        );
+      } catch (_) {
+        // Провайдер может обернуть отмену в своё исключение — смотрим на сам токен
+        if (cancelToken.isCancelled) return false;
+        rethrow;
+      } finally {
+        if (identical(_activeCancelToken, cancelToken)) _activeCancelToken = null;
+      }
+      if (cancelToken.isCancelled) return false;
+      await file.writeAsString(generated, flush: true);
+      return true;
+    }
+
+    final prompts = _llmService.buildGenerationPrompts(
+      rawRequirements: rawRequirements,
+      changes: changes,
+      templateContent: templateContent,
+      format: format,
+      promptSnippets: promptSnippets,
+    );
+    _llmService.checkRequestSize(systemPrompt: prompts['system']!, userPrompt: prompts['user']!);
+
+    final sink = file.openWrite();
+    final cancelToken = CancelToken();
+    _activeCancelToken = cancelToken;
+    String? finalText;
+    try {
+      await for (final chunk in _withIdleTimeout(
+        (provider as LLMStreamingProvider).streamChat(
+          systemPrompt: prompts['system']!,
+          userPrompt: prompts['user']!,
+          cancelToken: cancelToken,
+        ),
+        cancelToken,
+      )) {
+        if (chunk is LLMStreamChunkDelta) {
+          if (chunk.delta.isEmpty) continue;
+          sink.write(chunk.delta);
+          await sink.flush();
+        } else if (chunk is LLMStreamChunkError) {
+          // Отмена по простою — ошибка, а не действие пользователя; частичный файл остаётся
+          if (cancelToken.isCancelled && chunk is! LLMStreamChunkIdleTimeout) return false;
+          ErrorLogService().record('streaming', chunk.message);
+          throw Exception(chunk.message);
+        } else if (chunk is LLMStreamChunkFinal) {
+          final full = chunk.full;
+          if (full != null && full.isNotEmpty) finalText = _llmService.postProcessOutput(full);
+          break;
+        }
+      }
+    } on DioException catch (e) {
+      if (CancelToken.isCancel(e)) return false;
+      ErrorLogService().record('streaming', e);
+      rethrow;
+    } finally {
+      await sink.close();
+      if (identical(_activeCancelToken, cancelToken)) _activeCancelToken = null;
+    }
+
+    if (cancelToken.isCancelled) return false;
+    // Итоговый текст после фильтров заменяет сырой поток
+    if (finalText != null) await file.writeAsString(finalText, flush: true);
+    return true;
+  }
+
+  /// Если провайдер молчит дольше [LLMService.streamIdleTimeout], запрос
+  /// отменяется, а поток завершается чанком [LLMStreamChunkIdleTimeout].
+  /// Таймер сбрасывается на каждом полученном чанке.
+  Stream<LLMStreamChunk> _withIdleTimeout(Stream<LLMStreamChunk> source, CancelToken cancelToken) {
+    final idle = _llmService.streamIdleTimeout;
+    if (idle == null) return source;
+    return source.timeout(idle, onTimeout: (sink) {
+      final message = 'Нет данных от провайдера ${idle.inSeconds} с — генерация прервана, '
+          'полученная часть сохранена';
+      sink.add(LLMStreamChunkIdleTimeout(message, idle));
+      sink.close();
+      if (!cancelToken.isCancelled) cancelToken.cancel('idle_timeout');
+    });
+  }
+
   /// Aborts active real streaming HTTP request (if any). No-op for simulation.
   void abortCurrent() {
     if (_activeCancelToken != null && !_activeCancelToken!.isCancelled) {
@@ -83,6 +83,8 @@ class StreamingSessionController extends ChangeNotifier {
     String? changes,
     String? templateContent,
     required OutputFormat format,
+    List<String> promptSnippets = const [],
+    String? stopMarker,
   }) async {
     await abort();
   _state = StreamingState.initial().copyWith(active: true, aborted: false);
@@ -93,6 +95,8 @@ class StreamingSessionController extends ChangeNotifier {
       changes: changes,
       templateContent: templateContent,
       format: format,
+      promptSnippets: promptSnippets,
+      stopMarker: stopMarker,
     );
 
     _subscription = stream.listen(_handleLine, onError: (e) {
@@ -0,0 +1,128 @@
+import 'dart:convert';
+import 'dart:developer';
+import 'dart:io';
+import '../models/template.dart';
+import '../utils/atomic_file.dart';
+import '../utils/text_normalization.dart';
+
+/// Хранение шаблонов отдельными `.md` файлами с небольшим индексом
+/// (`index.json`) — удобно держать шаблоны команды в общем репозитории:
+/// изменения видны в диффах и не конфликтуют в одном большом файле.
+class TemplateFileStore {
+  final Directory directory;
+
+  TemplateFileStore(String path) : directory = Directory(path);
+
+  static const String indexFileName = 'index.json';
+
+  File get _indexFile => File('${directory.path}${Platform.pathSeparator}$indexFileName');
+
+  File _contentFile(String fileName) => File('${directory.path}${Platform.pathSeparator}$fileName');
+
+  /// true, если каталог уже содержит индекс шаблонов
+  Future<bool> exists() => _indexFile.exists();
+
+  /// Читает все шаблоны каталога. Записи индекса без файла пропускаются.
+  Future<List<Template>> loadAll() async {
+    final index = await _readIndex();
+    final templates = <Template>[];
+    for (final entry in index) {
+      final file = _contentFile(entry['file'] as String);
+      if (!await file.exists()) {
+        log('TemplateFileStore: missing file ${file.path} for template ${entry['id']}');
+        continue;
+      }
+      templates.add(Template(
+        id: entry['id'] as String,
+        name: entry['name'] as String? ?? entry['id'] as String,
+        content: normalizeTextFileContent(await file.readAsString()),
+        isDefault: entry['isDefault'] as bool? ?? false,
+        createdAt: DateTime.tryParse(entry['createdAt'] as String? ?? '') ?? DateTime.now(),
+        updatedAt: DateTime.tryParse(entry['updatedAt'] as String? ?? ''),
+        format: TemplateFormat.markdown,
+        preferredModel: entry['preferredModel'] as String?,
+        category: entry['category'] as String?,
+        locked: entry['locked'] as bool? ?? false,
+        sectionOrder: (entry['sectionOrder'] as List<dynamic>?)?.whereType<String>().toList(),
+        temperature: (entry['temperature'] as num?)?.toDouble(),
+      ));
+    }
+    return templates;
+  }
+
+  /// Сохраняет (или обновляет) один шаблон и его запись в индексе
+  Future<void> save(Template template) async {
+    await directory.create(recursive: true);
+    final index = await _readIndex();
+    final fileName = _fileNameFor(template.id);
+    await writeStringAtomically(_contentFile(fileName), template.content);
+    index.removeWhere((e) => e['id'] == template.id);
+    index.add(_indexEntry(template, fileName));
+    await _writeIndex(index);
+  }
+
+  /// Обновляет записи индекса [templates] одной записью (содержимое файлов не меняется)
+  Future<void> updateIndexEntries(List<Template> templates) async {
+    if (templates.isEmpty) return;
+    final index = await _readIndex();
+    for (final t in templates) {
+      index.removeWhere((e) => e['id'] == t.id);
+      index.add(_indexEntry(t, _fileNameFor(t.id)));
+    }
+    await _writeIndex(index);
+  }
+
+  Future<void> delete(String id) async {
+    final index = await _readIndex();
+    final fileName = _fileNameFor(id);
+    index.removeWhere((e) => e['id'] == id);
+    await _writeIndex(index);
+    final file = _contentFile(fileName);
+    if (await file.exists()) await file.delete();
+  }
+
+  /// Полностью перезаписывает каталог набором [templates] (миграция из Hive)
+  Future<void> writeAll(List<Template> templates) async {
+    await directory.create(recursive: true);
+    final index = <Map<String, dynamic>>[];
+    for (final t in templates) {
+      final fileName = _fileNameFor(t.id);
+      await writeStringAtomically(_contentFile(fileName), t.content);
+      index.add(_indexEntry(t, fileName));
+    }
+    await _writeIndex(index);
+  }
+
+  Map<String, dynamic> _indexEntry(Template t, String fileName) => {
+        'id': t.id,
+        'name': t.name,
+        'file': fileName,
+        'isDefault': t.isDefault,
+        'createdAt': t.createdAt.toIso8601String(),
+        if (t.updatedAt != null) 'updatedAt': t.updatedAt!.toIso8601String(),
+        if (t.preferredModel != null) 'preferredModel': t.preferredModel,
+        if (t.category != null && t.category!.isNotEmpty) 'category': t.category,
+        if (t.locked) 'locked': true,
+        if (t.sectionOrder != null && t.sectionOrder!.isNotEmpty) 'sectionOrder': t.sectionOrder,
+        if (t.temperature != null) 'temperature': t.temperature,
+      };
+
+  // Имя файла выводится из id, чтобы переименование шаблона не создавало новый файл
+  String _fileNameFor(String id) => '${id.replaceAll(RegExp(r'[^A-Za-z0-9_.-]'), '_')}.md';
+
+  Future<List<Map<String, dynamic>>> _readIndex() async {
+    if (!await _indexFile.exists()) return [];
+    final content = await _indexFile.readAsString();
+    if (content.trim().isEmpty) return [];
+    final decoded = jsonDecode(content) as Map<String, dynamic>;
+    return (decoded['templates'] as List<dynamic>? ?? const [])
+        .whereType<Map<String, dynamic>>()
+        .toList();
+  }
+
+  Future<void> _writeIndex(List<Map<String, dynamic>> index) async {
+    index.sort((a, b) => (a['id'] as String).compareTo(b['id'] as String));
+    const encoder = JsonEncoder.withIndent('  ');
+    await writeStringAtomically(_indexFile, '${encoder.convert({'version': 1, 'templates': index})}\n');
+  }
+}
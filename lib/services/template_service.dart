@@ -1,21 +1,74 @@
+import 'dart:async';
 import 'dart:developer';
+import 'dart:io';
 import 'package:flutter/material.dart';
 import 'package:flutter/services.dart';
 import 'package:hive/hive.dart';
 import 'package:provider/provider.dart';
+import 'package:uuid/uuid.dart';
 import '../models/template.dart';
+import '../models/template_stats.dart';
+import '../models/template_update_status.dart';
 import '../models/app_config.dart';
 import '../models/output_format.dart';
+import '../utils/document_headings.dart';
+import '../utils/line_diff.dart';
+import '../utils/text_normalization.dart';
+import '../utils/text_similarity.dart';
+import '../utils/token_estimator.dart';
+import '../utils/template_renderer.dart';
+import 'config_service.dart';
 import 'llm_service.dart';
+import 'shutdown_service.dart';
+import 'template_file_store.dart';
 
 class TemplateService extends ChangeNotifier {
   late Box<Template> _templatesBox;
+  late Box<Template> _globalBox; // общий набор шаблонов, доступный во всех профилях
   late Box<String> _settingsBox;
+  String _profile = defaultProfile;
   bool _initialized = false;
+  Future<void>? _initFuture; // текущая загрузка; параллельные вызовы init() ждут её
+  TemplateFileStore? _fileStore; // режим 'files': каталог .md файлов — источник истины, Hive — кеш
+
+  /// Задержка отложенного сохранения после последней правки
+  static const Duration autoSaveDelay = Duration(seconds: 1);
+  // Правки, ещё не записанные на диск: id -> (шаблон, сохранять в общий набор)
+  final Map<String, (Template, bool)> _pendingSaves = {};
+  Timer? _autoSaveTimer;
+
+  TemplateService() {
+    ShutdownService().addFlushHandler('templates', flush);
+  }
+
+  @override
+  void dispose() {
+    _configSource?.removeListener(_onConfigChanged);
+    ShutdownService().removeFlushHandler('templates');
+    unawaited(flush().catchError((Object e) => log('Template flush on dispose failed: $e')));
+    super.dispose();
+  }
 
   // Unified keys (legacy keys will be migrated)
   static const String _defaultKey = 'default_markdown';
   static const String _activeKey = 'active_template';
+  static const String _briefKey = 'bundled_brief';
+
+  // Короткий встроенный шаблон для быстрого старта (только чтение, можно дублировать)
+  static const String _briefTemplateContent = '''# Техническое задание
+
+## 1. Цель
+Какую задачу пользователя или бизнеса решаем.
+
+## 2. Описание решения
+Что нужно сделать: основные сценарии и изменения в системе.
+
+## 3. Ограничения и зависимости
+Затрагиваемые системы, интеграции, нефункциональные требования.
+
+## 4. Критерии приемки
+Проверяемые условия, при которых задача считается выполненной.
+''';
 
   // Legacy keys kept for migration only
   static const String _legacyDefaultConfluenceKey = 'default_confluence';
@@ -23,18 +76,129 @@ class TemplateService extends ChangeNotifier {
   static const String _legacyActiveConfluenceKey = 'active_template_confluence';
 
   bool get isInitialized => _initialized;
-  
-  Future<void> init() async {
+
+  static const String defaultProfile = 'default';
+  static const String _globalBoxName = 'templates_global';
+
+  /// Профиль, чей набор шаблонов сейчас загружен
+  String get activeProfile => _profile;
+
+  // Набор профиля по умолчанию — прежний бокс 'templates', поэтому существующие
+  // шаблоны без миграции данных становятся шаблонами профиля по умолчанию
+  static String _boxNameFor(String profile) =>
+      profile == defaultProfile ? 'templates' : 'templates_$profile';
+
+  static String _normalizeProfile(String? profile) {
+    final p = profile?.trim().toLowerCase() ?? '';
+    return p.isEmpty ? defaultProfile : p.replaceAll(RegExp(r'[^a-z0-9_-]'), '_');
+  }
+
+  /// Задаёт профиль до загрузки шаблонов (из [AppConfig.templateProfile])
+  void configureProfile(String? profile) {
+    if (_initialized) return; // после загрузки используйте switchProfile
+    _profile = _normalizeProfile(profile);
+  }
+
+  ConfigService? _configSource;
+
+  /// Следит за [AppConfig.templateProfile]: после сохранения настроек с другим
+  /// профилем набор шаблонов переключается без перезапуска приложения
+  void followConfig(ConfigService configService) {
+    if (identical(_configSource, configService)) return;
+    _configSource?.removeListener(_onConfigChanged);
+    _configSource = configService..addListener(_onConfigChanged);
+  }
+
+  void _onConfigChanged() {
+    final profile = _configSource?.config?.templateProfile;
+    if (_initFuture == null) {
+      configureProfile(profile); // загрузка ещё не началась — достаточно запомнить профиль
+      return;
+    }
+    if (_initialized && _normalizeProfile(profile) == _profile) return;
+    // Идущая загрузка открывает набор прежнего профиля — переключаемся после неё
+    unawaited(init()
+        .then((_) => switchProfile(profile))
+        .catchError((Object e) => log('Template profile switch failed: $e')));
+  }
+
+  /// Переключает набор шаблонов на [profile] и перезагружает список.
+  /// Активным становится шаблон по умолчанию нового профиля.
+  Future<void> switchProfile(String? profile) async {
+    if (!_initialized) await init();
+    final next = _normalizeProfile(profile);
+    if (next == _profile) return;
+    await flush(); // правки относятся к набору прежнего профиля
+    final previous = _templatesBox;
+    _templatesBox = await Hive.openBox<Template>(_boxNameFor(next));
+    _profile = next;
+    await previous.close();
+    await _ensureUnifiedDefaultTemplate();
+    await _ensureBundledTemplates();
+    await _settingsBox.put(_activeKey, _defaultKey);
+    notifyListeners();
+    log('Template profile switched to $next');
+  }
+
+  static const String storageModeHive = 'hive';
+  static const String storageModeFiles = 'files';
+
+  // Каталог .md файлов хранит только набор профиля по умолчанию
+  TemplateFileStore? get _activeFileStore => _profile == defaultProfile ? _fileStore : null;
+
+  /// Текущий режим хранения шаблонов
+  String get storageMode => _fileStore != null ? storageModeFiles : storageModeHive;
+
+  /// Задаёт режим хранения до загрузки шаблонов (из [AppConfig.templateStorageMode]).
+  void configureStorage({String? mode, String? directory}) {
+    _fileStore = mode == storageModeFiles && directory != null && directory.trim().isNotEmpty
+        ? TemplateFileStore(directory.trim())
+        : null;
+  }
+
+  /// Переключает режим хранения с переносом шаблонов. При переходе в режим
+  /// 'files' все шаблоны записываются в [directory]; при возврате в 'hive'
+  /// шаблоны уже находятся в Hive и дополнительный перенос не нужен.
+  Future<void> migrateStorage({required String mode, String? directory}) async {
+    if (!_initialized) await init();
+    configureStorage(mode: mode, directory: directory);
+    final store = _fileStore;
+    if (store != null) {
+      await store.writeAll(_templatesBox.values.toList());
+      log('Templates migrated to files in ${store.directory.path}');
+    }
+    notifyListeners();
+  }
+
+  /// Шаблоны загружаются в фоне; true, пока загрузка не завершена
+  bool get isLoading => _initFuture != null && !_initialized;
+
+  /// Однократная загрузка шаблонов. Повторные и параллельные вызовы не открывают
+  /// боксы заново, а ждут уже идущую загрузку. После ошибки загрузку можно повторить.
+  Future<void> init() {
+    if (_initialized) return Future.value();
+    return _initFuture ??= _load().catchError((Object e, StackTrace st) {
+      _initFuture = null;
+      Error.throwWithStackTrace(e, st);
+    });
+  }
+
+  Future<void> _load() async {
     try {
-  _templatesBox = await Hive.openBox<Template>('templates');
+  _lastLoadFixes = const [];
+  _templatesBox = await Hive.openBox<Template>(_boxNameFor(_profile));
+  _globalBox = await Hive.openBox<Template>(_globalBoxName);
   _settingsBox = await Hive.openBox<String>('template_settings');
       
   // Ensure unified default template exists
   await _ensureUnifiedDefaultTemplate();
+  await _ensureBundledTemplates();
 
   // Migrate legacy templates/keys (format split) -> unified
   await _migrateLegacyTemplates();
   await _migrateLegacyKeys();
+  await _syncWithFileStore();
+  await _validateStoredTemplates();
       
       _initialized = true;
       notifyListeners();
@@ -58,23 +222,42 @@ class TemplateService extends ChangeNotifier {
 
   Future<bool> _attemptRecoveryFromCorruption() async {
     try {
-      log('Attempting templates box recovery: closing & deleting corrupted box');
-      const boxName = 'templates';
-      if (Hive.isBoxOpen(boxName)) {
-        await Hive.box(boxName).close();
+      // Удаляется только бокс активного профиля: наборы других профилей исправны
+      final boxName = _boxNameFor(_profile);
+      // Бокс профиля открылся, а общий — нет: повреждён общий бокс, набор профиля не трогаем
+      final globalBoxFailed = Hive.isBoxOpen(boxName) && !Hive.isBoxOpen(_globalBoxName);
+      if (!globalBoxFailed) {
+        log('Attempting templates box recovery: closing & deleting corrupted box $boxName');
+        await _deleteBox(boxName);
       }
-      try { await Hive.deleteBoxFromDisk(boxName); } catch (_) {}
       _templatesBox = await Hive.openBox<Template>(boxName);
+      try {
+        _globalBox = await Hive.openBox<Template>(_globalBoxName);
+      } catch (e) {
+        log('Global templates box is corrupted, recreating: $e');
+        await _deleteBox(_globalBoxName);
+        _globalBox = await Hive.openBox<Template>(_globalBoxName);
+      }
       _settingsBox = await Hive.openBox<String>('template_settings');
       await _ensureUnifiedDefaultTemplate();
+      await _ensureBundledTemplates();
       await _migrateLegacyTemplates();
       await _migrateLegacyKeys();
+      await _syncWithFileStore();
+      await _validateStoredTemplates();
       return true;
     } catch (e) {
       log('Recovery attempt failed: $e');
       return false;
     }
   }
+
+  static Future<void> _deleteBox(String name) async {
+    if (Hive.isBoxOpen(name)) {
+      await Hive.box(name).close();
+    }
+    try { await Hive.deleteBoxFromDisk(name); } catch (_) {}
+  }
   
   
   Future<void> _ensureUnifiedDefaultTemplate() async {
@@ -157,12 +340,122 @@ class TemplateService extends ChangeNotifier {
     }
   }
   
+  /// Добавляет встроенные шаблоны, которых ещё нет в хранилище.
+  /// Повторные загрузки их не дублируют; правки пользователя делаются в копии.
+  Future<void> _ensureBundledTemplates() async {
+    if (_templatesBox.containsKey(_briefKey)) return;
+    await _templatesBox.put(_briefKey, Template(
+      id: _briefKey,
+      name: 'Краткое ТЗ',
+      content: _briefTemplateContent,
+      isDefault: true, // встроенный: защищён от редактирования и удаления
+      createdAt: DateTime.now(),
+      format: TemplateFormat.markdown,
+    ));
+    log('Bundled brief template added');
+  }
+
+  /// В режиме 'files' приводит Hive в соответствие с каталогом шаблонов.
+  /// Пустой каталог заполняется текущими шаблонами (первичная миграция).
+  Future<void> _syncWithFileStore() async {
+    final store = _activeFileStore;
+    if (store == null) return;
+    if (!await store.exists()) {
+      await store.writeAll(_templatesBox.values.toList());
+      log('Template directory initialized from Hive: ${store.directory.path}');
+      return;
+    }
+
+    final loaded = validateTemplateSet(await store.loadAll());
+    final fromFiles = loaded.templates;
+    if (loaded.fixes.isNotEmpty) {
+      for (final fix in loaded.fixes) {
+        log('Template index fixed: $fix');
+      }
+      await store.writeAll(fromFiles);
+      _lastLoadFixes = [..._lastLoadFixes, ...loaded.fixes];
+    }
+    final ids = fromFiles.map((t) => t.id).toSet();
+    for (final key in List.of(_templatesBox.keys)) {
+      final t = _templatesBox.get(key);
+      // Встроенные шаблоны остаются всегда; пользовательские удалены из каталога (например, через git)
+      if (!ids.contains(key) && !(t?.isDefault ?? false)) await _templatesBox.delete(key);
+    }
+    for (final t in fromFiles) {
+      await _templatesBox.put(t.id, t);
+    }
+    for (final t in _templatesBox.values.where((t) => t.isDefault && !ids.contains(t.id)).toList()) {
+      await store.save(t);
+    }
+    log('Templates synced from ${store.directory.path}: ${fromFiles.length} files');
+  }
+
+  List<String> _lastLoadFixes = const [];
+
+  /// Исправления, сделанные проверкой набора шаблонов при последней загрузке
+  List<String> get lastLoadFixes => _lastLoadFixes;
+
+  /// Проверяет набор шаблонов: пустые и повторяющиеся id заменяются новыми
+  /// (первый шаблон с id сохраняет его). Пользовательский шаблон без содержимого
+  /// отбрасывается, только если у него нет и id — созданный, но ещё не заполненный
+  /// шаблон ([createNewTemplate]) сохраняется.
+  /// Возвращает исправленный набор и описания исправлений.
+  static ({List<Template> templates, List<String> fixes}) validateTemplateSet(List<Template> templates) {
+    final fixes = <String>[];
+    final seen = <String>{};
+    final result = <Template>[];
+    for (final t in templates) {
+      if (t.content.trim().isEmpty && t.id.trim().isEmpty && !t.isDefault) {
+        fixes.add('Dropped template "${t.name}" (empty id): empty content');
+        continue;
+      }
+      var template = t;
+      if (t.id.trim().isEmpty || seen.contains(t.id)) {
+        final newId = 'user_${const Uuid().v4()}';
+        fixes.add(t.id.trim().isEmpty
+            ? 'Assigned id $newId to template "${t.name}" with empty id'
+            : 'Reassigned duplicate id ${t.id} of template "${t.name}" to $newId');
+        template = t.copyWith(id: newId);
+      }
+      seen.add(template.id);
+      result.add(template);
+    }
+    return (templates: result, fixes: fixes);
+  }
+
+  // Проверка шаблонов профиля в Hive: ключ записи и id шаблона могли разойтись
+  // (ручная правка, сбой миграции) — такие записи тоже считаются дубликатами
+  Future<void> _validateStoredTemplates() async {
+    final entries = _templatesBox.toMap().entries.toList();
+    final checked = validateTemplateSet(entries.map((e) => e.value).toList());
+    final mismatched = entries.where((e) => e.key != e.value.id).length;
+    if (checked.fixes.isEmpty && mismatched == 0) return;
+    for (final fix in checked.fixes) {
+      log('Template set fixed: $fix');
+    }
+    if (mismatched > 0) log('Template set fixed: $mismatched entries re-keyed by template id');
+    // Сначала пишем исправленные записи, затем удаляем только устаревшие ключи:
+    // сбой между шагами оставит дубликаты, но не потеряет шаблоны профиля
+    final fixed = {for (final t in checked.templates) t.id: t};
+    await _templatesBox.putAll(fixed);
+    await _templatesBox.deleteAll(entries.map((e) => e.key).where((key) => !fixed.containsKey(key)).toList());
+    await _activeFileStore?.writeAll(checked.templates);
+    _lastLoadFixes = [..._lastLoadFixes, ...checked.fixes];
+  }
+
   Future<List<Template>> getAllTemplates() async {
     try {
       if (!_initialized) await init();
-  final templates = _templatesBox.values.toList();
-      // Сортируем: дефолтный шаблон первый, остальные по дате создания
+  final ids = _templatesBox.keys.toSet();
+      final templates = [
+        ..._templatesBox.values,
+        // Общие шаблоны; при совпадении id приоритет у шаблона профиля
+        ..._globalBox.values.where((t) => !ids.contains(t.id)),
+      ].map((t) => _pendingSaves[t.id]?.$1 ?? t).toList();
+      // Сортируем: дефолтный шаблон первый, затем встроенные, остальные по дате создания
       templates.sort((a, b) {
+        if (a.id == _defaultKey) return -1;
+        if (b.id == _defaultKey) return 1;
         if (a.isDefault && !b.isDefault) return -1;
         if (!a.isDefault && b.isDefault) return 1;
         return b.createdAt.compareTo(a.createdAt);
@@ -175,16 +468,28 @@ class TemplateService extends ChangeNotifier {
     }
   }
   
+  /// Шаблоны, закреплённые за моделью [modelId] (например, после её отключения
+  /// у провайдера). Пустой список, если таких нет.
+  Future<List<Template>> findTemplatesUsingModel(String modelId) async {
+    final id = modelId.trim();
+    if (id.isEmpty) return [];
+    final templates = await getAllTemplates();
+    return templates.where((t) => t.preferredModel?.trim() == id).toList();
+  }
+
   Future<Template?> getTemplate(String id) async {
     if (!_initialized) await init();
-    return _templatesBox.get(id);
+    return _pendingSaves[id]?.$1 ?? _templatesBox.get(id) ?? _globalBox.get(id);
   }
+
+  /// true, если шаблон принадлежит общему набору (виден во всех профилях)
+  bool isGlobalTemplate(String id) => !_templatesBox.containsKey(id) && _globalBox.containsKey(id);
   
   Future<Template?> getActiveTemplate(OutputFormat format) async { // format ignored (kept for compatibility)
     try {
       if (!_initialized) await init();
       final activeId = _settingsBox.get(_activeKey) ?? _defaultKey;
-      return _templatesBox.get(activeId) ?? _templatesBox.get(_defaultKey);
+      return _templatesBox.get(activeId) ?? _globalBox.get(activeId) ?? _templatesBox.get(_defaultKey);
     } catch (e) {
       log('Error getting active template: $e');
       return null;
@@ -198,23 +503,204 @@ class TemplateService extends ChangeNotifier {
     return _settingsBox.get(_activeKey) ?? _defaultKey;
   }
   
-  Future<void> saveTemplate(Template template) async {
+  /// Порог размера шаблона по умолчанию: шаблон больше ~6K токенов вместе с вводом
+  /// и ответом не помещается в контекст распространённых моделей на 8K
+  static const int defaultTemplateTokenWarningThreshold = 6000;
+  int _templateTokenWarningThreshold = defaultTemplateTokenWarningThreshold;
+  List<String> _lastSaveWarnings = const [];
+
+  /// Задаёт порог предупреждения о размере шаблона (null или <= 0 — по умолчанию)
+  void configureTemplateSizeWarning(int? threshold) {
+    _templateTokenWarningThreshold =
+        (threshold != null && threshold > 0) ? threshold : defaultTemplateTokenWarningThreshold;
+  }
+
+  /// Некритичные предупреждения последнего сохранения шаблона (сохранение они не блокируют)
+  List<String> get lastSaveWarnings => _lastSaveWarnings;
+
+  /// Предупреждение, если шаблон, вероятно, слишком велик для распространённых моделей
+  String? checkTemplateSize(String content) {
+    final tokens = const HeuristicTokenEstimator().estimate(content);
+    if (tokens <= _templateTokenWarningThreshold) return null;
+    return 'Шаблон занимает около $tokens токенов (порог $_templateTokenWarningThreshold): '
+        'генерация с ним может не поместиться в контекст модели';
+  }
+
+  /// Сохраняет шаблон в набор текущего профиля. [global] — в общий набор;
+  /// уже существующий общий шаблон обновляется в общем наборе.
+  Future<void> saveTemplate(Template template, {bool global = false}) async {
     if (!_initialized) await init();
-    
+    _ensureNotLocked(template.id);
+    _pendingSaves.remove(template.id); // явное сохранение заменяет отложенную правку
+    final sizeWarning = checkTemplateSize(template.content);
+    _lastSaveWarnings = sizeWarning == null ? const [] : [sizeWarning];
+    await _persistTemplate(template, global: global);
+  }
+
+  /// Отложенное сохранение для правок в редакторе: шаблон записывается через
+  /// [autoSaveDelay] после последнего вызова, а до этого виден через [getTemplate].
+  /// Новые шаблоны и удаление по-прежнему сохраняются сразу.
+  void scheduleTemplateSave(Template template, {bool global = false}) {
+    if (_initialized) _ensureNotLocked(template.id);
+    _pendingSaves[template.id] = (template.copyWith(updatedAt: DateTime.now()), global);
+    _autoSaveTimer?.cancel();
+    _autoSaveTimer = Timer(autoSaveDelay, () {
+      unawaited(flush().catchError((Object e) => log('Template auto-save failed: $e')));
+    });
+    notifyListeners();
+  }
+
+  /// true, если есть правки, ещё не записанные на диск
+  bool get hasPendingSaves => _pendingSaves.isNotEmpty;
+
+  /// Немедленно записывает отложенные правки (вызывается и при завершении приложения)
+  Future<void> flush() async {
+    _autoSaveTimer?.cancel();
+    _autoSaveTimer = null;
+    if (_pendingSaves.isEmpty) return;
+    if (!_initialized) await init();
+    final pending = Map.of(_pendingSaves);
+    _pendingSaves.clear();
+    for (final entry in pending.values) {
+      await _persistTemplate(entry.$1, global: entry.$2);
+    }
+  }
+
+  Future<void> _persistTemplate(Template template, {required bool global}) async {
     final updatedTemplate = template.copyWith(
+      content: normalizeTextFileContent(template.content),
       updatedAt: DateTime.now(),
     );
     
+    if (global || isGlobalTemplate(template.id)) {
+      await _globalBox.put(template.id, updatedTemplate);
+      notifyListeners();
+      log('Global template saved: ${template.name}');
+      return;
+    }
     await _templatesBox.put(template.id, updatedTemplate);
+    await _activeFileStore?.save(updatedTemplate);
     
     notifyListeners();
     log('Template saved: ${template.name}');
   }
   
+  /// Импортирует шаблон из Markdown-файла. BOM и переводы строк Windows
+  /// удаляются, чтобы не попасть в промт. Имя по умолчанию — имя файла.
+  Future<Template> importTemplateFromFile(String path, {String? name}) async {
+    if (!_initialized) await init();
+    final file = File(path);
+    if (!await file.exists()) {
+      throw ArgumentError('Template file not found: $path');
+    }
+    final content = normalizeTextFileContent(await file.readAsString());
+    final fileName = file.uri.pathSegments.isNotEmpty ? file.uri.pathSegments.last : path;
+    final template = Template(
+      id: const Uuid().v4(),
+      name: name ?? fileName.replaceFirst(RegExp(r'\.(md|markdown|txt)$', caseSensitive: false), ''),
+      content: content,
+      createdAt: DateTime.now(),
+      format: TemplateFormat.markdown,
+    );
+    await saveTemplate(template);
+    return template;
+  }
+
+  /// Назначает [category] шаблонам [ids] (пустая строка снимает категорию).
+  /// Встроенные и заблокированные шаблоны пропускаются. Изменения сохраняются одной записью в конце.
+  Future<Map<String, TemplateUpdateStatus>> setTemplatesCategory(List<String> ids, String category) async {
+    if (!_initialized) await init();
+    await flush();
+    final value = category.trim();
+    final results = <String, TemplateUpdateStatus>{};
+    final local = <String, Template>{};
+    final global = <String, Template>{};
+    final now = DateTime.now();
+    for (final id in ids) {
+      final isGlobal = isGlobalTemplate(id);
+      final template = isGlobal ? _globalBox.get(id) : _templatesBox.get(id);
+      if (template == null) {
+        results[id] = TemplateUpdateStatus.notFound;
+      } else if (template.isDefault || template.locked) {
+        results[id] = TemplateUpdateStatus.skipped;
+      } else if ((template.category ?? '') == value) {
+        results[id] = TemplateUpdateStatus.unchanged;
+      } else {
+        final updated = template.copyWith(updatedAt: now, category: value.isEmpty ? null : value);
+        (isGlobal ? global : local)[id] = updated;
+        results[id] = TemplateUpdateStatus.changed;
+      }
+    }
+    if (local.isNotEmpty) {
+      await _templatesBox.putAll(local);
+      await _activeFileStore?.updateIndexEntries(local.values.toList());
+    }
+    if (global.isNotEmpty) await _globalBox.putAll(global);
+    if (local.isNotEmpty || global.isNotEmpty) {
+      notifyListeners();
+      log('Template category "$value" set for ${local.length + global.length} templates');
+    }
+    return results;
+  }
+
+  /// Блокирует или разблокирует шаблон. Заблокированный шаблон нельзя изменить,
+  /// переименовать или удалить — только снять блокировку этим методом.
+  Future<void> setTemplateLocked(String id, bool locked) async {
+    if (!_initialized) await init();
+    final template = _templatesBox.get(id) ?? _globalBox.get(id);
+    if (template == null) {
+      throw ArgumentError('Template with id $id not found');
+    }
+    if (template.locked == locked) return;
+    final updated = template.copyWith(locked: locked);
+    if (isGlobalTemplate(id)) {
+      await _globalBox.put(id, updated);
+    } else {
+      await _templatesBox.put(id, updated);
+      await _activeFileStore?.updateIndexEntries([updated]);
+    }
+    notifyListeners();
+    log('Template ${locked ? 'locked' : 'unlocked'}: ${template.name}');
+  }
+
+  /// Задаёт температуру генерации шаблона (0–2); null возвращает значение провайдера по умолчанию.
+  /// Используется, когда температура не передана в запросе явно.
+  Future<void> setTemplateTemperature(String id, double? temperature) async {
+    if (!_initialized) await init();
+    if (temperature != null && (temperature.isNaN || temperature < 0 || temperature > 2)) {
+      throw ArgumentError('Temperature must be between 0 and 2: $temperature');
+    }
+    await flush();
+    final template = _templatesBox.get(id) ?? _globalBox.get(id);
+    if (template == null) {
+      throw ArgumentError('Template with id $id not found');
+    }
+    _ensureNotLocked(id);
+    final updated = template.copyWith(updatedAt: DateTime.now(), temperature: temperature);
+    if (isGlobalTemplate(id)) {
+      await _globalBox.put(id, updated);
+    } else {
+      await _templatesBox.put(id, updated);
+      await _activeFileStore?.updateIndexEntries([updated]);
+    }
+    notifyListeners();
+    log('Template temperature set to ${temperature ?? 'default'}: ${template.name}');
+  }
+
+  // Сохранённый шаблон с флагом locked защищён от изменений
+  void _ensureNotLocked(String id) {
+    final stored = _templatesBox.get(id) ?? _globalBox.get(id);
+    if (stored != null && stored.locked) {
+      throw StateError('Template "${stored.name}" is locked and cannot be modified');
+    }
+  }
+
   Future<void> deleteTemplate(String id) async {
     if (!_initialized) await init();
+    _pendingSaves.remove(id); // отложенная правка не должна восстановить удалённый шаблон
     
-    final template = _templatesBox.get(id);
+    final global = isGlobalTemplate(id);
+    final template = _templatesBox.get(id) ?? _globalBox.get(id);
     if (template == null) {
       throw ArgumentError('Template with id $id not found');
     }
@@ -223,20 +709,26 @@ class TemplateService extends ChangeNotifier {
     if (template.isDefault) {
       throw ArgumentError('Cannot delete default template');
     }
+    _ensureNotLocked(id);
     
     // Если удаляемый шаблон активный, переключаемся на дефолтный
     if (_settingsBox.get(_activeKey) == id) {
       await _settingsBox.put(_activeKey, _defaultKey);
     }
     
-    await _templatesBox.delete(id);
+    if (global) {
+      await _globalBox.delete(id);
+    } else {
+      await _templatesBox.delete(id);
+      await _activeFileStore?.delete(id);
+    }
     notifyListeners();
     log('Template deleted: ${template.name}');
   }
   
   Future<void> setActiveTemplate(String id, OutputFormat format) async { // format ignored
     if (!_initialized) await init();
-    final template = _templatesBox.get(id);
+    final template = _templatesBox.get(id) ?? _globalBox.get(id);
     if (template == null) {
       throw ArgumentError('Template with id $id not found');
     }
@@ -260,7 +752,7 @@ class TemplateService extends ChangeNotifier {
   Future<Template> duplicateTemplate(String sourceId, String newName) async {
     if (!_initialized) await init();
     
-    final sourceTemplate = _templatesBox.get(sourceId);
+    final sourceTemplate = await getTemplate(sourceId);
     if (sourceTemplate == null) {
       throw ArgumentError('Source template with id $sourceId not found');
     }
@@ -292,6 +784,169 @@ class TemplateService extends ChangeNotifier {
     // Можно добавить дополнительные проверки
     return true;
   }
+
+  /// Пробный рендер шаблона с тестовыми значениями переменных — позволяет автору
+  /// проверить форматирование без запуска генерации.
+  /// Встроенные переменные (`{{today}}` и др.) заполняются автоматически.
+  Future<TemplateRenderResult> testRenderTemplate(String id, Map<String, String> vars, {String? dateFormat}) async {
+    final template = await getTemplate(id);
+    if (template == null) {
+      throw ArgumentError('Template with id $id not found');
+    }
+    return renderTemplate(template.content, {...resolveBuiltInVariables(dateFormat: dateFormat), ...vars});
+  }
+
+  // Директива включения общего фрагмента: {{include:templateId}}
+  static final RegExp _includePattern = RegExp(r'\{\{\s*include:\s*([^}\s]+)\s*\}\}');
+
+  /// Возвращает содержимое шаблона с раскрытыми директивами `{{include:id}}`
+  /// (общие шапка, подвал и т.п.). Используется при генерации и для предпросмотра.
+  Future<String> resolveTemplate(String id) async {
+    return _resolveIncludes(id, const []);
+  }
+
+  Future<String> _resolveIncludes(String id, List<String> chain) async {
+    if (chain.contains(id)) {
+      throw ArgumentError('Circular template include: ${[...chain, id].join(' -> ')}');
+    }
+    final template = await getTemplate(id);
+    if (template == null) {
+      throw ArgumentError(chain.isEmpty
+          ? 'Template with id $id not found'
+          : 'Included template with id $id not found (included from ${chain.last})');
+    }
+
+    final content = template.content;
+    final matches = _includePattern.allMatches(content).toList();
+    if (matches.isEmpty) return content;
+
+    final nextChain = [...chain, id];
+    final buffer = StringBuffer();
+    var last = 0;
+    for (final m in matches) {
+      buffer.write(content.substring(last, m.start));
+      buffer.write((await _resolveIncludes(m.group(1)!, nextChain)).trim());
+      last = m.end;
+    }
+    buffer.write(content.substring(last));
+    return buffer.toString();
+  }
+
+  /// Построчное сравнение двух шаблонов — помогает свести почти одинаковые
+  /// шаблоны команды перед удалением одного из них
+  Future<List<DiffSegment>> diffTemplates(String idA, String idB) async {
+    final a = await getTemplate(idA);
+    if (a == null) {
+      throw ArgumentError('Template with id $idA not found');
+    }
+    final b = await getTemplate(idB);
+    if (b == null) {
+      throw ArgumentError('Template with id $idB not found');
+    }
+    return computeLineDiff(a.content, b.content);
+  }
+
+  /// Группы id шаблонов с одинаковым или почти одинаковым содержимым
+  /// (после нормализации пробелов и регистра) — UI предлагает объединить или удалить лишние.
+  /// [threshold] — минимальная похожесть (0..1), 1.0 — только точные совпадения.
+  Future<List<List<String>>> findDuplicateTemplates({double threshold = 0.9}) async {
+    final templates = await getAllTemplates();
+    return findSimilarGroups(
+      {for (final t in templates) t.id: t.content},
+      threshold: threshold.clamp(0.0, 1.0).toDouble(),
+    );
+  }
+
+  /// Оглавление шаблона (дерево заголовков с номерами строк) для навигации по разделам
+  Future<List<OutlineNode>> getTemplateOutline(String id) async {
+    final template = await getTemplate(id);
+    if (template == null) {
+      throw ArgumentError('Template with id $id not found');
+    }
+    return documentOutline(template.content);
+  }
+
+  /// Флаги условных блоков `{{#if flag}}` шаблона (для выбора перед генерацией)
+  Future<List<String>> getTemplateFlags(String id) async {
+    final template = await getTemplate(id);
+    if (template == null) {
+      throw ArgumentError('Template with id $id not found');
+    }
+    return findTemplateFlags(template.content);
+  }
+
+  // Фразы, которыми модель заполняет раздел, не имея данных
+  static final List<RegExp> _placeholderPatterns = [
+    RegExp(r'^не\s+применимо\.?$', caseSensitive: false),
+    RegExp(r'^определяется\s+на\s+этапе\s+проектирования\.?$', caseSensitive: false),
+  ];
+
+  /// Проверяет, что сгенерированный документ заполнил все разделы шаблона.
+  /// Возвращает заголовки разделов шаблона, которые отсутствуют в [output]
+  /// или заполнены только заглушками ("Не применимо" и т.п.).
+  Future<List<String>> checkOutputCompleteness(String templateId, String output) async {
+    final template = await getTemplate(templateId);
+    if (template == null) {
+      throw ArgumentError('Template with id $templateId not found');
+    }
+
+    final expected = _sectionHeadings(extractHeadings(template.content));
+    if (expected.isEmpty) return [];
+
+    final outputHeadings = extractHeadings(output);
+    final issues = <String>[];
+    for (final section in expected) {
+      final key = normalizeHeadingTitle(section.title);
+      final index = outputHeadings.indexWhere((h) => normalizeHeadingTitle(h.title) == key);
+      if (index < 0) {
+        issues.add(section.title);
+        continue;
+      }
+      if (_isPlaceholderBody(_sectionBody(output, outputHeadings, index))) {
+        issues.add(section.title);
+      }
+    }
+    return issues;
+  }
+
+  // Уровень "разделов" — минимальный уровень заголовка, встречающийся хотя бы дважды.
+  // Так обёртки вида "## Шаблон и правила описания" не считаются обязательными разделами.
+  List<DocumentHeading> _sectionHeadings(List<DocumentHeading> headings) {
+    final counts = <int, int>{};
+    for (final h in headings) {
+      counts[h.level] = (counts[h.level] ?? 0) + 1;
+    }
+    final repeated = counts.entries.where((e) => e.value > 1).map((e) => e.key).toList()..sort();
+    final minLevel = repeated.isNotEmpty ? repeated.first : 1;
+    final seen = <String>{};
+    return headings
+        .where((h) => h.level >= minLevel)
+        .where((h) => seen.add(normalizeHeadingTitle(h.title)))
+        .toList();
+  }
+
+  String _sectionBody(String text, List<DocumentHeading> headings, int index) {
+    final current = headings[index];
+    var end = text.length;
+    for (var i = index + 1; i < headings.length; i++) {
+      if (headings[i].level <= current.level) {
+        end = headings[i].offset;
+        break;
+      }
+    }
+    return text.substring(current.end.clamp(0, end), end);
+  }
+
+  bool _isPlaceholderBody(String body) {
+    final lines = body
+        .replaceAll(RegExp(r'<[^>]+>'), '\n')
+        .split('\n')
+        .map((l) => l.replaceAll(RegExp(r'^\s*(#{1,6}|[-*+]|\d+[.)])\s*'), '').replaceAll(RegExp(r'[*_`]'), '').trim())
+        .where((l) => l.isNotEmpty)
+        .toList();
+    if (lines.isEmpty) return true;
+    return lines.every((l) => _placeholderPatterns.any((p) => p.hasMatch(l)));
+  }
   
   Future<void> _migrateLegacyTemplates() async {
     for (String key in List.from(_templatesBox.keys)) {
@@ -338,6 +993,91 @@ class TemplateService extends ChangeNotifier {
     }
   }
   
+  /// Количество шаблонов и размер их хранилища на диске
+  Future<TemplateStats> getTemplateStats() async {
+    if (!_initialized) await init();
+    final templates = _templatesBox.values.toList();
+    final defaults = templates.where((t) => t.isDefault).length;
+    return TemplateStats(
+      total: templates.length,
+      user: templates.length - defaults,
+      defaults: defaults,
+      storageBytes: await _fileSize(_templatesBox.path),
+    );
+  }
+
+  static Future<int> _fileSize(String? path) async {
+    if (path == null) return 0;
+    try {
+      final f = File(path);
+      return await f.exists() ? await f.length() : 0;
+    } catch (_) {
+      return 0;
+    }
+  }
+
+  /// Сверяет хранилище шаблонов: записи, чей ключ не совпадает с id шаблона
+  /// (остаются после миграций и синхронизации), и настройки, ссылающиеся на
+  /// несуществующие шаблоны. Возвращает описания найденных расхождений.
+  Future<List<String>> reconcileTemplates() async {
+    if (!_initialized) await init();
+    final issues = <String>[];
+    for (final key in _templatesBox.keys) {
+      final t = _templatesBox.get(key);
+      if (t == null) {
+        issues.add('Пустая запись шаблона "$key"');
+      } else if (t.id != key) {
+        issues.add('Шаблон "${t.name}" хранится под ключом "$key", а его id — "${t.id}"');
+      }
+    }
+    for (final key in [_activeKey, _legacyActiveMarkdownKey, _legacyActiveConfluenceKey]) {
+      final ref = _settingsBox.get(key);
+      if (ref != null && !_templatesBox.containsKey(ref) && !_globalBox.containsKey(ref)) {
+        issues.add('Настройка "$key" ссылается на несуществующий шаблон "$ref"');
+      }
+    }
+    return issues;
+  }
+
+  /// Устраняет расхождения, найденные [reconcileTemplates]: дубликаты под
+  /// устаревшими ключами удаляются, прочие записи переносятся под свой id,
+  /// висячие ссылки сбрасываются на шаблон по умолчанию. Шаблон по умолчанию
+  /// не удаляется никогда. Возвращает число исправленных записей.
+  Future<int> cleanupOrphanedTemplates() async {
+    if (!_initialized) await init();
+    var fixed = 0;
+    for (final key in List.of(_templatesBox.keys)) {
+      if (key == _defaultKey) continue;
+      final t = _templatesBox.get(key);
+      if (t == null) {
+        await _templatesBox.delete(key);
+        fixed++;
+      } else if (t.id != key && !t.isDefault) {
+        if (!_templatesBox.containsKey(t.id)) {
+          await _templatesBox.put(t.id, t); // не теряем пользовательский шаблон
+        }
+        await _templatesBox.delete(key);
+        fixed++;
+      }
+    }
+    for (final key in [_activeKey, _legacyActiveMarkdownKey, _legacyActiveConfluenceKey]) {
+      final ref = _settingsBox.get(key);
+      if (ref != null && !_templatesBox.containsKey(ref) && !_globalBox.containsKey(ref)) {
+        if (key == _activeKey) {
+          await _settingsBox.put(key, _defaultKey);
+        } else {
+          await _settingsBox.delete(key);
+        }
+        fixed++;
+      }
+    }
+    if (fixed > 0) {
+      notifyListeners();
+      log('Template storage cleanup: fixed $fixed entries');
+    }
+    return fixed;
+  }
+
   Future<List<Template>> getTemplatesForFormat(OutputFormat format) async { // format ignored
     if (!_initialized) await init();
     return getAllTemplates();
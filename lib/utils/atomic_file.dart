@@ -0,0 +1,54 @@
+import 'dart:async';
+import 'dart:io';
+
+// Записи, которые выполняются прямо сейчас (ожидаются при завершении приложения)
+final Set<Future<void>> _pendingWrites = {};
+
+// Последняя начатая запись по каждому пути: записи одного файла идут по очереди,
+// чтобы итоговым содержимым всегда оказывалась последняя из них
+final Map<String, Future<void>> _lastWriteByPath = {};
+
+// Счётчик для уникальных имён временных файлов внутри процесса
+int _tempCounter = 0;
+
+/// Атомарная запись файла: содержимое пишется во временный файл в том же
+/// каталоге, сбрасывается на диск и переименовывается поверх целевого.
+/// При падении процесса посреди записи целевой файл остаётся прежним.
+/// Перекрывающиеся записи одного файла выполняются в порядке вызова.
+Future<void> writeStringAtomically(File target, String content) {
+  final key = target.absolute.path;
+  final previous = _lastWriteByPath[key];
+  final write = previous == null
+      ? _writeAtomically(target, content)
+      : previous.catchError((Object _) {}).then((_) => _writeAtomically(target, content));
+  _lastWriteByPath[key] = write;
+  _pendingWrites.add(write);
+  return write.whenComplete(() {
+    _pendingWrites.remove(write);
+    if (identical(_lastWriteByPath[key], write)) _lastWriteByPath.remove(key);
+  });
+}
+
+/// Дожидается завершения всех начатых атомарных записей (ошибки игнорируются —
+/// их уже получил вызвавший код)
+Future<void> flushPendingWrites() async {
+  while (_pendingWrites.isNotEmpty) {
+    await Future.wait(
+      _pendingWrites.toList().map((w) => w.catchError((Object _) {})),
+    );
+  }
+}
+
+Future<void> _writeAtomically(File target, String content) async {
+  // Уникальное имя: запись из другого экземпляра приложения не затрёт наш временный файл
+  final temp = File('${target.path}.${pid}_${_tempCounter++}.tmp');
+  try {
+    await temp.writeAsString(content, flush: true);
+    await temp.rename(target.path);
+  } catch (e) {
+    try {
+      if (await temp.exists()) await temp.delete();
+    } catch (_) {}
+    rethrow;
+  }
+}
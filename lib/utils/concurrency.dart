@@ -0,0 +1,20 @@
+/// Выполняет [task] для каждого элемента [items], не более [limit] одновременно.
+/// Результаты возвращаются в порядке [items].
+Future<List<R>> mapWithConcurrency<T, R>(
+  List<T> items,
+  int limit,
+  Future<R> Function(T item) task,
+) async {
+  final results = List<R?>.filled(items.length, null);
+  var next = 0;
+  Future<void> worker() async {
+    while (next < items.length) {
+      final index = next++;
+      results[index] = await task(items[index]);
+    }
+  }
+
+  final workers = limit.clamp(1, items.isEmpty ? 1 : items.length);
+  await Future.wait(List.generate(workers, (_) => worker()));
+  return results.cast<R>();
+}
@@ -0,0 +1,26 @@
+/// Классификация ошибок подключения к LLM провайдеру по тексту ошибки.
+///
+/// Провайдеры возвращают ошибку строкой (`provider.error`), поэтому
+/// классифицируем по статусу HTTP и типичным сообщениям Dio / dart:io.
+enum ConnectionFailureKind {
+  auth, // неверный или отсутствующий ключ — повтор не поможет
+  transient, // сеть, таймаут, 429, 5xx — стоит повторить
+  other,
+}
+
+final RegExp _authPattern = RegExp(
+  r'\b(401|403)\b|unauthori[sz]ed|forbidden|invalid[ _-]?api[ _-]?key|incorrect api key|token is not configured|authentication',
+  caseSensitive: false,
+);
+
+final RegExp _transientPattern = RegExp(
+  r'\b(408|425|429|500|502|503|504)\b|timeout|timed out|socketexception|connection (refused|reset|closed|error)|failed host lookup|network is unreachable|temporarily|overloaded',
+  caseSensitive: false,
+);
+
+ConnectionFailureKind classifyConnectionError(String? message) {
+  if (message == null || message.isEmpty) return ConnectionFailureKind.other;
+  if (_authPattern.hasMatch(message)) return ConnectionFailureKind.auth;
+  if (_transientPattern.hasMatch(message)) return ConnectionFailureKind.transient;
+  return ConnectionFailureKind.other;
+}
@@ -0,0 +1,86 @@
+import 'dart:convert';
+import 'dart:io';
+import 'text_normalization.dart';
+
+/// Текстовые файлы (PRD, заметки), добавляемые к запросу как дополнительный контекст
+
+/// Расширения файлов, которые можно приложить к запросу
+const List<String> contextFileExtensions = ['.txt', '.md', '.markdown'];
+
+/// Общий лимит текста приложенных файлов (символы) — контекст не должен вытеснить ответ
+const int defaultContextFilesMaxChars = 60000;
+
+class ContextFilesResult {
+  final String text; // файлы с заголовками, готовые для промта (пусто — ничего не добавлено)
+  final List<String> included; // пути файлов, попавших в контекст
+  final Map<String, String> rejected; // путь -> причина
+  final bool truncated; // последний файл обрезан по общему лимиту
+
+  const ContextFilesResult({
+    required this.text,
+    required this.included,
+    required this.rejected,
+    this.truncated = false,
+  });
+}
+
+/// Читает [paths] и склеивает их с заголовками `=== Файл: name ===`.
+/// Неподдерживаемые, двоичные и нечитаемые файлы пропускаются с причиной в [ContextFilesResult.rejected];
+/// после исчерпания [maxChars] оставшиеся файлы тоже пропускаются.
+Future<ContextFilesResult> readContextFiles(List<String> paths, {int maxChars = defaultContextFilesMaxChars}) async {
+  final buffer = StringBuffer();
+  final included = <String>[];
+  final rejected = <String, String>{};
+  var remaining = maxChars;
+  var truncated = false;
+
+  for (final path in paths) {
+    final file = File(path);
+    final name = file.uri.pathSegments.isNotEmpty ? file.uri.pathSegments.last : path;
+    final lower = name.toLowerCase();
+    if (!contextFileExtensions.any(lower.endsWith)) {
+      rejected[path] = 'unsupported file type (allowed: ${contextFileExtensions.join(', ')})';
+      continue;
+    }
+    if (remaining <= 0) {
+      rejected[path] = 'total size limit of $maxChars characters reached';
+      continue;
+    }
+    String content;
+    try {
+      final bytes = await file.readAsBytes();
+      if (bytes.contains(0)) {
+        rejected[path] = 'binary content';
+        continue;
+      }
+      content = normalizeTextFileContent(utf8.decode(bytes)).trim();
+    } on FormatException {
+      rejected[path] = 'not a UTF-8 text file';
+      continue;
+    } on FileSystemException catch (e) {
+      rejected[path] = e.osError?.message ?? e.message;
+      continue;
+    }
+    if (content.isEmpty) {
+      rejected[path] = 'empty file';
+      continue;
+    }
+    if (content.length > remaining) {
+      content = '${content.substring(0, remaining)}\n[...файл обрезан по лимиту размера...]';
+      truncated = true;
+    }
+    remaining -= content.length;
+    if (buffer.isNotEmpty) buffer.write('\n\n');
+    buffer
+      ..writeln('=== Файл: $name ===')
+      ..write(content);
+    included.add(path);
+  }
+
+  return ContextFilesResult(
+    text: buffer.toString(),
+    included: included,
+    rejected: rejected,
+    truncated: truncated,
+  );
+}
@@ -0,0 +1,43 @@
+/// Склейка обрезанного ответа модели с его продолжением.
+///
+/// Модели при продолжении часто повторяют хвост предыдущего ответа
+/// (последнюю фразу или незаконченную строку) и заново открывают маркер
+/// @@@START@@@. Здесь повторы на стыке удаляются.
+
+const String _startMarker = '@@@START@@@';
+
+// Максимальная длина перекрытия, которую ищем на стыке
+const int _maxOverlap = 2000;
+// Более короткие совпадения считаем случайными (например, общий пробел или буква)
+const int _minOverlap = 8;
+
+/// Возвращает [previous] + [continuation] без дублирования на стыке
+String mergeContinuation(String previous, String continuation) {
+  var cont = continuation;
+  final trimmed = cont.trimLeft();
+  if (trimmed.startsWith(_startMarker)) {
+    cont = trimmed.substring(_startMarker.length).replaceFirst(RegExp(r'^[ \t]*\n'), '');
+  }
+  if (previous.isEmpty) return cont;
+  if (cont.trim().isEmpty) return previous;
+
+  // 1. Продолжение начинается с хвоста предыдущего текста
+  final limit = [previous.length, cont.length, _maxOverlap].reduce((a, b) => a < b ? a : b);
+  for (var k = limit; k >= _minOverlap; k--) {
+    if (previous.endsWith(cont.substring(0, k))) {
+      return previous + cont.substring(k);
+    }
+  }
+
+  // 2. Модель переписала незаконченную последнюю строку целиком
+  final lastBreak = previous.lastIndexOf('\n');
+  final lastLine = previous.substring(lastBreak + 1);
+  final contStripped = cont.trimLeft();
+  if (lastLine.trim().length >= _minOverlap && contStripped.startsWith(lastLine.trimLeft())) {
+    return previous.substring(0, lastBreak + 1) + contStripped;
+  }
+
+  // 3. Без перекрытия: продолжаем с новой строки, если обрезка пришлась на конец строки
+  final needsSpace = !previous.endsWith('\n') && !previous.endsWith(' ') && !cont.startsWith(RegExp(r'[\s.,;:!?)]'));
+  return needsSpace ? '$previous $cont' : previous + cont;
+}
@@ -0,0 +1,52 @@
+/// Блок документа для экспорта в форматы без Markdown (DOCX, PDF)
+class DocumentBlock {
+  /// 1–6 — заголовок соответствующего уровня, 0 — абзац
+  final int headingLevel;
+  final bool isListItem;
+  final String text;
+
+  const DocumentBlock.heading(this.headingLevel, this.text) : isListItem = false;
+  const DocumentBlock.paragraph(this.text)
+      : headingLevel = 0,
+        isListItem = false;
+  const DocumentBlock.listItem(this.text)
+      : headingLevel = 0,
+        isListItem = true;
+
+  bool get isHeading => headingLevel > 0;
+}
+
+/// Разбивает Markdown на заголовки, пункты списков и абзацы.
+/// Инлайновая разметка (`**`, `__`, `` ` ``) убирается: целевые форматы
+/// получают только структуру документа.
+List<DocumentBlock> parseMarkdownBlocks(String markdown) {
+  String plain(String s) => s.replaceAll(RegExp(r'\*\*|__|`'), '').trim();
+
+  final blocks = <DocumentBlock>[];
+  final paragraph = <String>[];
+  void flushParagraph() {
+    if (paragraph.isNotEmpty) {
+      blocks.add(DocumentBlock.paragraph(paragraph.join(' ')));
+      paragraph.clear();
+    }
+  }
+
+  for (final line in markdown.split('\n')) {
+    final trimmed = line.trim();
+    final heading = RegExp(r'^(#{1,6})\s+(.*)$').firstMatch(trimmed);
+    final item = RegExp(r'^(?:[-*+]|\d+[.)])\s+(.*)$').firstMatch(trimmed);
+    if (trimmed.isEmpty) {
+      flushParagraph();
+    } else if (heading != null) {
+      flushParagraph();
+      blocks.add(DocumentBlock.heading(heading.group(1)!.length, plain(heading.group(2)!)));
+    } else if (item != null) {
+      flushParagraph();
+      blocks.add(DocumentBlock.listItem(plain(item.group(1)!)));
+    } else {
+      paragraph.add(plain(trimmed));
+    }
+  }
+  flushParagraph();
+  return blocks;
+}
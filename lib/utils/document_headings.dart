@@ -0,0 +1,196 @@
+/// Извлечение заголовков из документов (шаблоны и сгенерированные ТЗ).
+/// Поддерживает Markdown (`# ...`) и HTML/Confluence (`<h1>...</h1>`).
+class DocumentHeading {
+  final int level; // 1..6
+  final String title; // текст заголовка без разметки
+  final int line; // номер строки (с 1)
+  final int offset; // смещение начала заголовка в тексте
+  final int end; // смещение конца строки/тега заголовка
+
+  const DocumentHeading({
+    required this.level,
+    required this.title,
+    required this.line,
+    required this.offset,
+    required this.end,
+  });
+
+  @override
+  String toString() => 'DocumentHeading{level: $level, title: $title, line: $line}';
+}
+
+final RegExp _markdownHeading = RegExp(r'^(#{1,6})\s+(.+?)\s*#*\s*$');
+final RegExp _htmlHeading = RegExp(r'<h([1-6])[^>]*>(.*?)</h\1>', caseSensitive: false, dotAll: true);
+final RegExp _fence = RegExp(r'^\s*(```|~~~)');
+
+/// Возвращает заголовки документа в порядке появления.
+/// Заголовки внутри блоков кода (```) игнорируются.
+List<DocumentHeading> extractHeadings(String text) {
+  if (text.isEmpty) return const [];
+  final headings = <DocumentHeading>[];
+
+  int offset = 0;
+  int lineNo = 0;
+  bool inFence = false;
+  for (final rawLine in text.split('\n')) {
+    lineNo++;
+    final line = rawLine.endsWith('\r') ? rawLine.substring(0, rawLine.length - 1) : rawLine;
+    if (_fence.hasMatch(line)) {
+      inFence = !inFence;
+    } else if (!inFence) {
+      final m = _markdownHeading.firstMatch(line);
+      if (m != null) {
+        final title = _stripInlineMarkup(m.group(2)!);
+        if (title.isNotEmpty) {
+          headings.add(DocumentHeading(
+            level: m.group(1)!.length,
+            title: title,
+            line: lineNo,
+            offset: offset,
+            end: offset + rawLine.length,
+          ));
+        }
+      }
+    }
+    offset += rawLine.length + 1;
+  }
+
+  if (headings.isNotEmpty || !text.contains('<')) return headings;
+
+  // HTML (Confluence Storage Format)
+  for (final m in _htmlHeading.allMatches(text)) {
+    final title = _stripInlineMarkup(m.group(2)!);
+    if (title.isEmpty) continue;
+    headings.add(DocumentHeading(
+      level: int.parse(m.group(1)!),
+      title: title,
+      line: '\n'.allMatches(text.substring(0, m.start)).length + 1,
+      offset: m.start,
+      end: m.end,
+    ));
+  }
+  return headings;
+}
+
+/// Узел оглавления документа
+class OutlineNode {
+  final int level;
+  final String title;
+  final int line;
+  final List<OutlineNode> children;
+
+  OutlineNode({
+    required this.level,
+    required this.title,
+    required this.line,
+    List<OutlineNode>? children,
+  }) : children = children ?? [];
+
+  @override
+  String toString() => 'OutlineNode{level: $level, title: $title, line: $line, children: ${children.length}}';
+}
+
+/// Строит дерево оглавления из плоского списка заголовков.
+/// Пропуски уровней (# → ###) и документ, начинающийся не с H1, допустимы:
+/// заголовок вкладывается в ближайший предыдущий заголовок более высокого уровня,
+/// а при его отсутствии становится корневым.
+List<OutlineNode> buildOutline(List<DocumentHeading> headings) {
+  final roots = <OutlineNode>[];
+  final stack = <OutlineNode>[];
+  for (final h in headings) {
+    final node = OutlineNode(level: h.level, title: h.title, line: h.line);
+    while (stack.isNotEmpty && stack.last.level >= h.level) {
+      stack.removeLast();
+    }
+    if (stack.isEmpty) {
+      roots.add(node);
+    } else {
+      stack.last.children.add(node);
+    }
+    stack.add(node);
+  }
+  return roots;
+}
+
+/// Оглавление документа (шаблона или сгенерированного ТЗ)
+List<OutlineNode> documentOutline(String text) => buildOutline(extractHeadings(text));
+
+/// Нормализует заголовок для сравнения: без нумерации, разметки и регистра.
+/// "### 4. Критерии **приемки**" → "критерии приемки"
+String normalizeHeadingTitle(String title) {
+  var t = _stripInlineMarkup(title).toLowerCase();
+  t = t.replaceFirst(RegExp(r'^(\d+[.)]?)+(\.\d+)*\s*'), '');
+  t = t.replaceAll('ё', 'е');
+  t = t.replaceAll(RegExp(r'[\\/|:;,.!?()\[\]«»"]'), ' ');
+  return t.replaceAll(RegExp(r'\s+'), ' ').trim();
+}
+
+String _stripInlineMarkup(String text) {
+  return text
+      .replaceAll(RegExp(r'<[^>]+>'), '')
+      .replaceAll(RegExp(r'[*_`]'), '')
+      .replaceAll('&nbsp;', ' ')
+      .replaceAll(RegExp(r'\s+'), ' ')
+      .trim();
+}
+
+/// Раздел документа верхнего уровня: заголовок и весь текст до следующего
+/// заголовка того же или более высокого уровня.
+class DocumentSection {
+  final String title;
+  final String content; // включая строку заголовка
+
+  const DocumentSection({required this.title, required this.content});
+}
+
+/// Делит документ на разделы верхнего уровня. Верхним считается самый
+/// высокий уровень, встречающийся хотя бы дважды (одиночный `# Название`
+/// документа — это заголовок, а не раздел). Текст до первого раздела
+/// присоединяется к первому разделу.
+List<DocumentSection> splitTopLevelSections(String text) {
+  final top = _topLevelHeadings(extractHeadings(text));
+  if (top.isEmpty) return const [];
+
+  final sections = <DocumentSection>[];
+  for (var i = 0; i < top.length; i++) {
+    final start = i == 0 ? 0 : top[i].offset;
+    final end = i + 1 < top.length ? top[i + 1].offset : text.length;
+    sections.add(DocumentSection(title: top[i].title, content: text.substring(start, end).trim()));
+  }
+  return sections;
+}
+
+// Заголовки разделов верхнего уровня (см. [splitTopLevelSections])
+List<DocumentHeading> _topLevelHeadings(List<DocumentHeading> headings) {
+  if (headings.isEmpty) return const [];
+  final counts = <int, int>{};
+  for (final h in headings) {
+    counts[h.level] = (counts[h.level] ?? 0) + 1;
+  }
+  final levels = counts.keys.toList()..sort();
+  final topLevel = levels.firstWhere((l) => counts[l]! > 1, orElse: () => levels.first);
+  return headings.where((h) => h.level == topLevel).toList();
+}
+
+/// Переставляет разделы верхнего уровня [text] в порядке [titles] (сравнение
+/// по [normalizeHeadingTitle]). Текст до первого раздела остаётся на месте,
+/// разделы, которых нет в [titles], идут следом в исходном порядке.
+String reorderTopLevelSections(String text, List<String> titles) {
+  final top = _topLevelHeadings(extractHeadings(text));
+  if (top.length < 2 || titles.isEmpty) return text;
+
+  final rank = <String, int>{};
+  for (var i = 0; i < titles.length; i++) {
+    rank.putIfAbsent(normalizeHeadingTitle(titles[i]), () => i);
+  }
+  final preamble = text.substring(0, top.first.offset);
+  final sections = <(int, int, String)>[]; // ранг, исходный индекс, текст раздела
+  for (var i = 0; i < top.length; i++) {
+    final end = i + 1 < top.length ? top[i + 1].offset : text.length;
+    final body = text.substring(top[i].offset, end).trimRight();
+    sections.add((rank[normalizeHeadingTitle(top[i].title)] ?? titles.length, i, body));
+  }
+  sections.sort((a, b) => a.$1 != b.$1 ? a.$1.compareTo(b.$1) : a.$2.compareTo(b.$2));
+  final trailing = text.substring(text.trimRight().length);
+  return '$preamble${sections.map((s) => s.$3).join('\n\n')}$trailing';
+}
@@ -0,0 +1,78 @@
+import 'dart:typed_data';
+
+import 'package:archive/archive.dart';
+
+import 'document_blocks.dart';
+
+/// Собирает минимальный DOCX (Office Open XML) из блоков документа.
+/// Заголовки используют встроенные стили Word «Heading 1–6», поэтому
+/// навигация и оглавление Word работают без дополнительной настройки.
+Uint8List buildDocx(List<DocumentBlock> blocks) {
+  final archive = Archive()
+    ..addFile(ArchiveFile.string('[Content_Types].xml', _contentTypes))
+    ..addFile(ArchiveFile.string('_rels/.rels', _rootRels))
+    ..addFile(ArchiveFile.string('word/styles.xml', _styles))
+    ..addFile(ArchiveFile.string('word/document.xml', _documentXml(blocks)));
+  return ZipEncoder().encodeBytes(archive);
+}
+
+String _documentXml(List<DocumentBlock> blocks) {
+  final body = StringBuffer();
+  for (final block in blocks) {
+    final style = block.isHeading
+        ? 'Heading${block.headingLevel}'
+        : block.isListItem
+            ? 'ListBullet'
+            : null;
+    final text = block.isListItem ? '• ${block.text}' : block.text;
+    body.write('<w:p>');
+    if (style != null) body.write('<w:pPr><w:pStyle w:val="$style"/></w:pPr>');
+    body.write('<w:r><w:t xml:space="preserve">${_escapeXml(text)}</w:t></w:r></w:p>');
+  }
+  return '<?xml version="1.0" encoding="UTF-8" standalone="yes"?>'
+      '<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">'
+      '<w:body>$body</w:body></w:document>';
+}
+
+String _escapeXml(String s) => s
+    .replaceAll('&', '&amp;')
+    .replaceAll('<', '&lt;')
+    .replaceAll('>', '&gt;')
+    .replaceAll('"', '&quot;')
+    // Управляющие символы запрещены в XML 1.0 и ломают открытие документа в Word
+    .replaceAll(RegExp(r'[\x00-\x08\x0B\x0C\x0E-\x1F]'), '');
+
+const _contentTypes = '<?xml version="1.0" encoding="UTF-8" standalone="yes"?>'
+    '<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">'
+    '<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>'
+    '<Default Extension="xml" ContentType="application/xml"/>'
+    '<Override PartName="/word/document.xml" '
+    'ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>'
+    '<Override PartName="/word/styles.xml" '
+    'ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>'
+    '</Types>';
+
+const _rootRels = '<?xml version="1.0" encoding="UTF-8" standalone="yes"?>'
+    '<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">'
+    '<Relationship Id="rId1" '
+    'Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" '
+    'Target="word/document.xml"/>'
+    '</Relationships>';
+
+final _styles = '<?xml version="1.0" encoding="UTF-8" standalone="yes"?>'
+    '<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">'
+    '<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/>'
+    '<w:pPr><w:spacing w:after="120"/></w:pPr><w:rPr><w:sz w:val="22"/></w:rPr></w:style>'
+    '<w:style w:type="paragraph" w:styleId="ListBullet"><w:name w:val="List Bullet"/>'
+    '<w:basedOn w:val="Normal"/><w:pPr><w:ind w:left="360"/></w:pPr></w:style>'
+    '${[for (var level = 1; level <= 6; level++) _headingStyle(level)].join()}'
+    '</w:styles>';
+
+String _headingStyle(int level) {
+  // Размер в полупунктах: 32 для первого уровня, далее по убыванию до 22
+  final size = 34 - level * 2;
+  return '<w:style w:type="paragraph" w:styleId="Heading$level"><w:name w:val="heading $level"/>'
+      '<w:basedOn w:val="Normal"/><w:next w:val="Normal"/>'
+      '<w:pPr><w:keepNext/><w:spacing w:before="240"/><w:outlineLvl w:val="${level - 1}"/></w:pPr>'
+      '<w:rPr><w:b/><w:sz w:val="$size"/></w:rPr></w:style>';
+}
@@ -0,0 +1,36 @@
+import 'dart:convert';
+
+/// Приведение «сырого» тела ответа с ошибкой к читаемому сообщению.
+///
+/// Шлюзы и прокси нередко отвечают HTML-страницей или бинарными данными;
+/// выводить такое тело в ошибку целиком нельзя.
+
+/// Максимальная длина тела ответа в тексте ошибки
+const int maxErrorBodyLength = 500;
+
+final RegExp _htmlMarker = RegExp(r'<!doctype html|<html[\s>]|<head[\s>]|<body[\s>]', caseSensitive: false);
+final RegExp _htmlTitle = RegExp(r'<title[^>]*>(.*?)</title>', caseSensitive: false, dotAll: true);
+// Управляющие символы (кроме перевода строки и табуляции) и символ замены после битого UTF-8
+final RegExp _controlChars = RegExp('[\\x00-\\x08\\x0B\\x0C\\x0E-\\x1F\\x7F\\uFFFD]');
+
+/// Возвращает безопасное для показа описание тела ответа [data]
+String describeErrorBody(Object? data, {int? statusCode}) {
+  if (data == null) return '';
+  final text = data is List<int> ? utf8.decode(data, allowMalformed: true) : data.toString();
+  final status = statusCode != null ? 'status $statusCode' : 'no status';
+
+  if (_htmlMarker.hasMatch(text)) {
+    final title = _htmlTitle.firstMatch(text)?.group(1)?.replaceAll(RegExp(r'\s+'), ' ').trim();
+    return 'gateway returned an HTML error page ($status)'
+        '${title != null && title.isNotEmpty ? ': ${_truncate(title, 200)}' : ''}';
+  }
+
+  final cleaned = text.replaceAll(_controlChars, '').replaceAll(RegExp(r'\s+'), ' ').trim();
+  if (cleaned.isEmpty) return 'empty or binary response body ($status)';
+  return _truncate(cleaned, maxErrorBodyLength);
+}
+
+String _truncate(String text, int max) {
+  if (text.length <= max) return text;
+  return '${text.substring(0, max)}… (${text.length - max} more chars)';
+}
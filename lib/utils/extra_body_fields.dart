@@ -0,0 +1,24 @@
+import 'dart:convert';
+
+/// Дополнительные поля тела запроса генерации, которых требуют отдельные
+/// шлюзы (например, `provider` или `route`).
+
+/// Поля, которые формирует сам клиент: дополнительные поля их не перезаписывают
+const Set<String> reservedBodyFields = {'model', 'messages', 'stream'};
+
+/// Возвращает копию [body] с полями из [extra]. Зарезервированные поля и значения,
+/// не сериализуемые в JSON, пропускаются — результат всегда кодируется в JSON.
+Map<String, dynamic> mergeExtraBodyFields(Map<String, dynamic> body, Map<String, dynamic>? extra) {
+  if (extra == null || extra.isEmpty) return body;
+  final merged = Map<String, dynamic>.of(body);
+  extra.forEach((key, value) {
+    if (reservedBodyFields.contains(key)) return;
+    try {
+      jsonEncode(value);
+      merged[key] = value;
+    } catch (_) {
+      print('mergeExtraBodyFields: skipping non-JSON extra body field "$key"');
+    }
+  });
+  return merged;
+}
@@ -0,0 +1,87 @@
+import 'document_headings.dart';
+
+/// Минимальная поддержка JSON Schema для структурированного вывода:
+/// построение схемы по разделам шаблона и проверка ответа на клиенте.
+/// Поддерживаются type, properties, required, additionalProperties: false,
+/// items и enum — этого достаточно для схем, которые принимает OpenAI в strict-режиме.
+
+/// Схема объекта, в котором каждый раздел верхнего уровня шаблона — обязательное
+/// строковое поле с текстом раздела.
+Map<String, dynamic> schemaFromTemplate(String templateContent) {
+  final titles = splitTopLevelSections(templateContent).map((s) => s.title).toList();
+  if (titles.isEmpty) {
+    titles.addAll(extractHeadings(templateContent).map((h) => h.title));
+  }
+  final unique = titles.toSet().toList();
+  return {
+    'type': 'object',
+    'properties': {
+      for (final title in unique) title: {'type': 'string', 'description': 'Содержимое раздела «$title»'},
+    },
+    'required': unique,
+    'additionalProperties': false,
+  };
+}
+
+/// Проверяет [value] по [schema]. Возвращает список нарушений (пустой — значение корректно).
+List<String> validateJsonSchema(dynamic value, Map<String, dynamic> schema, [String path = r'$']) {
+  final errors = <String>[];
+
+  final allowed = schema['enum'];
+  if (allowed is List && !allowed.contains(value)) {
+    errors.add('$path: значение не входит в enum');
+  }
+
+  final type = schema['type'];
+  if (type != null) {
+    final types = type is List ? type.cast<String>() : [type as String];
+    if (!types.any((t) => _matchesType(value, t))) {
+      errors.add('$path: ожидался тип ${types.join('|')}');
+      return errors;
+    }
+  }
+
+  if (value is Map) {
+    final properties = (schema['properties'] as Map?)?.cast<String, dynamic>() ?? const {};
+    for (final name in (schema['required'] as List?)?.cast<String>() ?? const <String>[]) {
+      if (!value.containsKey(name)) errors.add('$path: нет обязательного поля "$name"');
+    }
+    for (final entry in value.entries) {
+      final key = entry.key.toString();
+      final propertySchema = properties[key];
+      if (propertySchema is Map<String, dynamic>) {
+        errors.addAll(validateJsonSchema(entry.value, propertySchema, '$path.$key'));
+      } else if (schema['additionalProperties'] == false) {
+        errors.add('$path: лишнее поле "$key"');
+      }
+    }
+  }
+
+  if (value is List && schema['items'] is Map<String, dynamic>) {
+    for (var i = 0; i < value.length; i++) {
+      errors.addAll(validateJsonSchema(value[i], schema['items'] as Map<String, dynamic>, '$path[$i]'));
+    }
+  }
+  return errors;
+}
+
+bool _matchesType(dynamic value, String type) {
+  switch (type) {
+    case 'object':
+      return value is Map;
+    case 'array':
+      return value is List;
+    case 'string':
+      return value is String;
+    case 'integer':
+      return value is int || (value is double && value == value.roundToDouble());
+    case 'number':
+      return value is num;
+    case 'boolean':
+      return value is bool;
+    case 'null':
+      return value == null;
+    default:
+      return true;
+  }
+}
@@ -0,0 +1,36 @@
+/// Параметр `logit_bias`: смещение вероятности отдельных токенов модели.
+///
+/// Ключи — id токенов в словаре модели (строкой, как в JSON), значения —
+/// от -100 (запретить токен) до 100 (форсировать его).
+
+const double minLogitBias = -100;
+const double maxLogitBias = 100;
+
+/// Собирает карту `logit_bias` из id токенов. Одно [bias] применяется ко всем
+/// [tokenIds] — например, -100, чтобы запретить англицизмы.
+Map<String, double> buildLogitBias(Iterable<int> tokenIds, double bias) {
+  final result = {for (final id in tokenIds) '$id': bias};
+  validateLogitBias(result);
+  return result;
+}
+
+/// Проверяет ключи (неотрицательные целые) и значения (в [-100, 100]).
+/// Бросает [ArgumentError] с описанием первой ошибки.
+void validateLogitBias(Map<String, dynamic> bias) {
+  bias.forEach((token, value) {
+    final id = int.tryParse(token);
+    if (id == null || id < 0) {
+      throw ArgumentError('logit_bias key must be a token id: "$token"');
+    }
+    if (value is! num || value < minLogitBias || value > maxLogitBias) {
+      throw ArgumentError('logit_bias value for token $token must be in [$minLogitBias, $maxLogitBias]: $value');
+    }
+  });
+}
+
+/// Нормализует карту для тела запроса; null, если смещений нет
+Map<String, double>? logitBiasForRequest(Map<String, dynamic>? bias) {
+  if (bias == null || bias.isEmpty) return null;
+  validateLogitBias(bias);
+  return bias.map((token, value) => MapEntry(token, (value as num).toDouble()));
+}
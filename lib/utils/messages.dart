@@ -0,0 +1,79 @@
+/// Каталог сообщений об ошибках для UI.
+///
+/// Язык задаётся [setUiLanguage] (из `AppConfig.uiLanguage`). Если ключа нет
+/// в выбранном языке, используется русский текст, а если нет и его — сам ключ.
+/// Параметры подставляются в плейсхолдеры вида `{name}`.
+
+const String defaultUiLanguage = 'ru';
+const List<String> supportedUiLanguages = ['ru', 'en'];
+
+String _uiLanguage = defaultUiLanguage;
+
+/// Текущий язык сообщений
+String get uiLanguage => _uiLanguage;
+
+void setUiLanguage(String? language) {
+  _uiLanguage = supportedUiLanguages.contains(language) ? language! : defaultUiLanguage;
+}
+
+const Map<String, Map<String, String>> _catalog = {
+  'ru': {
+    'provider.notInitialized': 'LLM провайдер не инициализирован',
+    'provider.notInitialized.recovery': 'Перейдите в настройки и настройте подключение к AI провайдеру',
+    'models.notLoaded': 'Список моделей AI не загружен',
+    'models.notLoaded.recovery': 'Проверьте подключение к интернету и настройки API, затем перезапустите приложение',
+    'models.defaultNotSelected': 'Модель AI по умолчанию не выбрана',
+    'models.defaultNotSelected.recovery': 'Перейдите в настройки и выберите модель AI по умолчанию',
+    'models.unavailable': 'Модель "{model}" недоступна у текущего провайдера',
+    'models.unavailable.recovery': 'Выберите модель из списка доступных или обновите список моделей',
+    'models.noneExposed': 'Эндпоинт не предоставляет ни одной модели. Проверьте URL API и права ключа',
+    'models.noneExposedByProvider': 'Эндпоинт провайдера {provider} не предоставляет ни одной модели. Проверьте URL API и права ключа',
+    'requirements.empty': 'Требования не могут быть пустыми',
+    'requirements.empty.recovery': 'Введите описание требований для генерации технического задания',
+    'requirements.tooShort': 'Требования слишком короткие для качественной генерации',
+    'requirements.tooShort.recovery': 'Добавьте больше деталей в описание требований (минимум 10 символов)',
+    'request.failed': 'Ошибка при отправке запроса к AI провайдеру',
+    'request.failedWithDetails': 'Ошибка при отправке запроса к AI провайдеру: {details}',
+    'request.failed.recovery': 'Проверьте подключение к интернету и настройки API. Попробуйте повторить запрос',
+    'response.empty': 'AI вернул пустой ответ',
+    'response.empty.recovery': 'Попробуйте повторить генерацию с более детальными требованиями',
+    'response.tooShort': 'AI вернул слишком короткий ответ',
+    'response.tooShort.recovery': 'Попробуйте повторить генерацию с более детальными требованиями или проверьте настройки модели',
+    'response.contentFiltered.recovery': 'Переформулируйте требования: провайдер счёл запрос или ответ недопустимым',
+    'config.providerUrlMismatch': 'URL {url} похож на API провайдера {expected}, а выбран провайдер {provider}. Проверьте настройки',
+  },
+  'en': {
+    'provider.notInitialized': 'LLM provider is not configured',
+    'provider.notInitialized.recovery': 'Open settings and configure the AI provider connection',
+    'models.notLoaded': 'The AI model list has not been loaded',
+    'models.notLoaded.recovery': 'Check your internet connection and API settings, then restart the application',
+    'models.defaultNotSelected': 'No default AI model is selected',
+    'models.defaultNotSelected.recovery': 'Open settings and choose a default AI model',
+    'models.unavailable': 'Model "{model}" is not available from the current provider',
+    'models.unavailable.recovery': 'Pick a model from the available list or refresh the model list',
+    'models.noneExposed': 'The endpoint does not expose any models. Check the API URL and key permissions',
+    'models.noneExposedByProvider': 'The {provider} endpoint does not expose any models. Check the API URL and key permissions',
+    'requirements.empty': 'Requirements must not be empty',
+    'requirements.empty.recovery': 'Describe the requirements to generate a specification',
+    'requirements.tooShort': 'Requirements are too short for a useful specification',
+    'requirements.tooShort.recovery': 'Add more detail to the requirements (at least 10 characters)',
+    'request.failed': 'Request to the AI provider failed',
+    'request.failedWithDetails': 'Request to the AI provider failed: {details}',
+    'request.failed.recovery': 'Check your internet connection and API settings, then try again',
+    'response.empty': 'The AI returned an empty response',
+    'response.empty.recovery': 'Try again with more detailed requirements',
+    'response.tooShort': 'The AI returned a response that is too short',
+    'response.tooShort.recovery': 'Try again with more detailed requirements or check the model settings',
+    'response.contentFiltered.recovery': 'Rephrase the requirements: the provider rejected the request or response',
+    'config.providerUrlMismatch': 'URL {url} looks like the {expected} API, but the selected provider is {provider}. Check the settings',
+  },
+};
+
+/// Возвращает сообщение [key] на текущем языке с подстановкой [args]
+String localize(String key, [Map<String, Object?> args = const {}]) {
+  var text = _catalog[_uiLanguage]?[key] ?? _catalog[defaultUiLanguage]?[key] ?? key;
+  args.forEach((name, value) {
+    text = text.replaceAll('{$name}', '${value ?? ''}');
+  });
+  return text;
+}
@@ -0,0 +1,115 @@
+/// Известные возможности моделей по их идентификатору.
+///
+/// Таблица покрывает распространённые семейства; для остальных моделей
+/// возможности не известны (null) и проверяются запросом-пробой.
+
+// Модели, которые заведомо не отдают потоковый ответ chat/completions
+// (не чат-модели или ранние reasoning-модели без stream)
+final List<RegExp> _nonStreamingPatterns = [
+  RegExp(r'embedding'),
+  RegExp(r'whisper'),
+  RegExp(r'tts'),
+  RegExp(r'dall-e'),
+  RegExp(r'moderation'),
+  RegExp(r'^o1(-preview|-mini)?(-\d{4}-\d{2}-\d{2})?$'),
+];
+
+final List<RegExp> _streamingPatterns = [
+  RegExp(r'gpt-3\.5'),
+  RegExp(r'gpt-4'),
+  RegExp(r'gpt-5'),
+  RegExp(r'^o[34]'),
+  RegExp(r'claude'),
+  RegExp(r'gemini'),
+  RegExp(r'llama'),
+  RegExp(r'mistral|mixtral'),
+  RegExp(r'qwen'),
+  RegExp(r'deepseek'),
+  RegExp(r'gemma'),
+];
+
+/// Поддержка потоковой генерации моделью у текущего провайдера
+enum StreamingSupport { supported, unsupported, unknown }
+
+/// true/false — поддержка потоковой генерации известна; null — неизвестна
+bool? knownStreamingSupport(String modelId) {
+  final id = modelId.toLowerCase();
+  final shortId = id.contains('/') ? id.substring(id.lastIndexOf('/') + 1) : id;
+  if (_nonStreamingPatterns.any((p) => p.hasMatch(shortId))) return false;
+  if (_streamingPatterns.any((p) => p.hasMatch(shortId))) return true;
+  return null;
+}
+
+// Размер контекстного окна (в токенах) для распространённых семейств.
+// Порядок важен: более специфичные шаблоны идут раньше общих.
+final List<MapEntry<RegExp, int>> _contextWindows = [
+  MapEntry(RegExp(r'gpt-4\.1'), 1047576),
+  MapEntry(RegExp(r'gpt-4o'), 128000),
+  MapEntry(RegExp(r'gpt-4-turbo'), 128000),
+  MapEntry(RegExp(r'gpt-4-32k'), 32768),
+  MapEntry(RegExp(r'gpt-4'), 8192),
+  MapEntry(RegExp(r'gpt-3\.5-turbo'), 16385),
+  MapEntry(RegExp(r'gpt-5'), 400000),
+  MapEntry(RegExp(r'^o[134]'), 200000),
+  MapEntry(RegExp(r'claude'), 200000),
+  MapEntry(RegExp(r'gemini'), 1000000),
+  MapEntry(RegExp(r'llama-3\.[123]'), 128000),
+  MapEntry(RegExp(r'llama3?-'), 8192),
+  MapEntry(RegExp(r'mixtral'), 32768),
+  MapEntry(RegExp(r'qwen'), 32768),
+  MapEntry(RegExp(r'deepseek'), 64000),
+];
+
+/// Размер контекстного окна модели или null, если модель неизвестна
+int? knownContextWindow(String modelId) {
+  final id = modelId.toLowerCase();
+  final shortId = id.contains('/') ? id.substring(id.lastIndexOf('/') + 1) : id;
+  for (final entry in _contextWindows) {
+    if (entry.key.hasMatch(shortId)) return entry.value;
+  }
+  return null;
+}
+
+// Встроенные цены (USD за 1K токенов, вход/выход) для распространённых моделей.
+// Порядок важен: более специфичные шаблоны идут раньше общих.
+final List<MapEntry<RegExp, List<double>>> _pricingUsdPer1K = [
+  MapEntry(RegExp(r'gpt-4o-mini'), [0.00015, 0.0006]),
+  MapEntry(RegExp(r'gpt-4o'), [0.0025, 0.01]),
+  MapEntry(RegExp(r'gpt-4\.1-nano'), [0.0001, 0.0004]),
+  MapEntry(RegExp(r'gpt-4\.1-mini'), [0.0004, 0.0016]),
+  MapEntry(RegExp(r'gpt-4\.1'), [0.002, 0.008]),
+  MapEntry(RegExp(r'gpt-4-turbo'), [0.01, 0.03]),
+  MapEntry(RegExp(r'gpt-3\.5-turbo'), [0.0005, 0.0015]),
+  MapEntry(RegExp(r'^o[34]-mini'), [0.0011, 0.0044]),
+  MapEntry(RegExp(r'claude-3-5-haiku|claude-haiku'), [0.0008, 0.004]),
+  MapEntry(RegExp(r'claude-3-[57]-sonnet|claude-sonnet'), [0.003, 0.015]),
+  MapEntry(RegExp(r'llama-3\.3-70b'), [0.00059, 0.00079]),
+];
+
+/// Встроенная цена модели в USD за 1K токенов ([вход, выход]) или null, если модель неизвестна
+List<double>? knownPricingUsdPer1K(String modelId) {
+  final id = modelId.toLowerCase();
+  final shortId = id.contains('/') ? id.substring(id.lastIndexOf('/') + 1) : id;
+  for (final entry in _pricingUsdPer1K) {
+    if (entry.key.hasMatch(shortId)) return entry.value;
+  }
+  return null;
+}
+
+/// Допустимые значения параметра `reasoning_effort`
+const List<String> reasoningEffortLevels = ['low', 'medium', 'high'];
+
+// Reasoning-модели, принимающие reasoning_effort (o1-preview/o1-mini его отклоняют)
+final List<RegExp> _reasoningEffortPatterns = [
+  RegExp(r'^o1(-\d{4}-\d{2}-\d{2})?$'),
+  RegExp(r'^o[34]'),
+  RegExp(r'^gpt-5'),
+];
+
+/// true, если модель заведомо принимает `reasoning_effort`. Для неизвестных
+/// моделей false: обычные модели отклоняют запрос с лишним параметром.
+bool supportsReasoningEffort(String modelId) {
+  final id = modelId.toLowerCase();
+  final shortId = id.contains('/') ? id.substring(id.lastIndexOf('/') + 1) : id;
+  return _reasoningEffortPatterns.any((p) => p.hasMatch(shortId));
+}
@@ -0,0 +1,57 @@
+/// Пост-обработка результата генерации regex-фильтрами.
+///
+/// Каждый фильтр — регулярное выражение; совпадения удаляются из текста.
+/// Некорректные выражения не прерывают обработку, а возвращаются в [OutputFilterResult.errors].
+
+/// Встроенные фильтры: типовые «разговорные» вступления и концовки моделей
+const List<String> defaultOutputFilters = [
+  // "Вот ваши технические требования:", "Ниже представлено ТЗ:"
+  r'^\s*(Вот|Ниже|Конечно|Хорошо|Отлично)[^\n]{0,120}:\s*\n+',
+  r'^\s*(Here is|Here are|Sure|Certainly)[^\n]{0,120}:\s*\n+',
+  // "Если нужно что-то уточнить — дайте знать." в конце документа
+  r'\n+\s*(Если (нужно|потребуется|у вас)|Надеюсь|Дайте знать|Let me know|Hope this)[^\n]*\s*$',
+];
+
+class OutputFilterResult {
+  final String text;
+  final List<String> errors; // ошибки компиляции выражений
+
+  const OutputFilterResult(this.text, this.errors);
+}
+
+/// Применяет [patterns] к [text]. Для Markdown-ответов с маркерами
+/// @@@START@@@/@@@END@@@ фильтруется только содержимое между маркерами.
+OutputFilterResult applyOutputFilters(String text, List<String> patterns) {
+  if (patterns.isEmpty || text.isEmpty) return OutputFilterResult(text, const []);
+
+  const startMarker = '@@@START@@@';
+  const endMarker = '@@@END@@@';
+  final start = text.indexOf(startMarker);
+  final end = text.indexOf(endMarker);
+  if (start >= 0 && end > start) {
+    final inner = text.substring(start + startMarker.length, end);
+    final filtered = _apply(inner, patterns);
+    return OutputFilterResult(
+      '${text.substring(0, start + startMarker.length)}\n${filtered.text.trim()}\n${text.substring(end)}',
+      filtered.errors,
+    );
+  }
+  return _apply(text, patterns);
+}
+
+OutputFilterResult _apply(String text, List<String> patterns) {
+  var result = text;
+  final errors = <String>[];
+  for (final pattern in patterns) {
+    if (pattern.trim().isEmpty) continue;
+    try {
+      final re = RegExp(pattern, multiLine: false, caseSensitive: false);
+      final filtered = result.replaceAll(re, '');
+      // Фильтр не должен уничтожать документ целиком
+      if (filtered.trim().isNotEmpty) result = filtered;
+    } on FormatException catch (e) {
+      errors.add('Некорректный фильтр "$pattern": ${e.message}');
+    }
+  }
+  return OutputFilterResult(result, errors);
+}
@@ -0,0 +1,46 @@
+import 'dart:io';
+import 'dart:math';
+import 'dart:typed_data';
+
+import 'package:pdf/pdf.dart';
+import 'package:pdf/widgets.dart' as pw;
+
+import 'document_blocks.dart';
+
+/// Системные шрифты с кириллицей. Встроенные шрифты PDF (Helvetica и др.)
+/// кириллицу не содержат, поэтому шрифт встраивается в документ.
+const List<String> unicodeFontCandidates = [
+  r'C:\Windows\Fonts\arial.ttf',
+  r'C:\Windows\Fonts\segoeui.ttf',
+  '/System/Library/Fonts/Supplemental/Arial.ttf',
+  '/Library/Fonts/Arial Unicode.ttf',
+  '/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf',
+  '/usr/share/fonts/TTF/DejaVuSans.ttf',
+];
+
+/// Первый существующий шрифт из [unicodeFontCandidates] или null
+String? findUnicodeFontPath() {
+  for (final path in unicodeFontCandidates) {
+    if (File(path).existsSync()) return path;
+  }
+  return null;
+}
+
+/// Собирает PDF формата A4 из блоков документа со встроенным шрифтом [fontBytes] (TTF)
+Future<Uint8List> buildPdf(List<DocumentBlock> blocks, {required Uint8List fontBytes}) {
+  final font = pw.Font.ttf(ByteData.sublistView(fontBytes));
+  final document = pw.Document(theme: pw.ThemeData.withFont(base: font, bold: font));
+  document.addPage(pw.MultiPage(
+    pageFormat: PdfPageFormat.a4,
+    build: (context) => [
+      for (final block in blocks)
+        if (block.isHeading)
+          pw.Header(level: min(block.headingLevel - 1, 5), text: block.text)
+        else if (block.isListItem)
+          pw.Bullet(text: block.text)
+        else
+          pw.Paragraph(text: block.text),
+    ],
+  ));
+  return document.save();
+}
@@ -0,0 +1,66 @@
+/// Маскирование персональных данных во вводе пользователя перед отправкой
+/// внешнему провайдеру: email, номера телефонов и номера банковских карт.
+
+class PiiRedactionResult {
+  final String text; // текст с масками вместо найденных значений
+  final List<String> redacted; // исходные значения — чтобы UI показал, что скрыто
+
+  const PiiRedactionResult(this.text, this.redacted);
+
+  bool get hasRedactions => redacted.isNotEmpty;
+}
+
+final RegExp _email = RegExp(r'[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}');
+// 13–19 цифр с пробелами или дефисами между группами; первая цифра — из диапазона
+// платёжных систем (Мир, Visa, Mastercard, Amex, UnionPay и др.)
+final RegExp _card = RegExp(r'(?<!\d)[2-6](?:[ -]?\d){11,17}[ -]?\d(?!\d)');
+// Телефоном считается только номер характерной формы — с кодом страны через «+»,
+// с префиксом 8 и кодом города или с кодом в скобках. Просто длинные числа
+// с разделителями («100 000 000 000», «1000-2000-3000-40») остаются как есть.
+final RegExp _phone = RegExp(
+  r'(?<![\w+])(?:'
+  r'\+\d{1,3}[ -]?(?:\(\d{1,5}\)[ -]?)?\d{1,5}(?:[ -]?\d{1,4}){1,4}' // +7 (999) 123-45-67, +1-202-555-0143
+  r'|8[ -]?\(\d{3,5}\)[ -]?\d{1,3}(?:[ -]?\d{2}){2}' // 8 (999) 123-45-67
+  r'|8[ -]\d{3}[ -]\d{3}(?:[ -]\d{2}){2}' // 8 999 123 45 67, 8-999-123-45-67
+  r'|\(\d{3,5}\)[ -]?\d{1,3}(?:[ -]?\d{2,4}){1,2}' // (202) 555-0143
+  r')(?!\d)',
+);
+
+/// Заменяет найденные персональные данные масками `[EMAIL]`, `[CARD]`, `[PHONE]`
+PiiRedactionResult redactPii(String text) {
+  final redacted = <String>[];
+
+  String mask(String input, RegExp pattern, String label, [bool Function(String)? accept]) {
+    return input.replaceAllMapped(pattern, (m) {
+      final value = m.group(0)!;
+      if (accept != null && !accept(value)) return value;
+      redacted.add(value);
+      return '[$label]';
+    });
+  }
+
+  var result = mask(text, _email, 'EMAIL');
+  result = mask(result, _card, 'CARD', (v) => _luhnValid(v.replaceAll(RegExp(r'\D'), '')));
+  result = mask(result, _phone, 'PHONE', (v) {
+    final digits = v.replaceAll(RegExp(r'\D'), '').length;
+    return digits >= 10 && digits <= 15;
+  });
+  return PiiRedactionResult(result, redacted);
+}
+
+// Контрольная сумма номера карты — отсекает случайные длинные числа
+bool _luhnValid(String digits) {
+  if (digits.length < 13 || digits.length > 19) return false;
+  var sum = 0;
+  var doubleDigit = false;
+  for (var i = digits.length - 1; i >= 0; i--) {
+    var d = digits.codeUnitAt(i) - 48;
+    if (doubleDigit) {
+      d *= 2;
+      if (d > 9) d -= 9;
+    }
+    sum += d;
+    doubleDigit = !doubleDigit;
+  }
+  return sum % 10 == 0;
+}
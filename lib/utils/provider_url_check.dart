@@ -0,0 +1,42 @@
+/// Проверка согласованности URL API и выбранного провайдера.
+///
+/// Проверка мягкая: предупреждение выдаётся, только если хост URL принадлежит
+/// другому известному провайдеру (например, URL Anthropic при провайдере openai).
+/// Собственные шлюзы и прокси с произвольными хостами не считаются ошибкой.
+
+import 'messages.dart';
+
+// Хосты известных API и провайдер, которому они соответствуют
+const Map<String, String> _knownHosts = {
+  'api.openai.com': 'openai',
+  'api.anthropic.com': 'anthropic',
+  'api.cerebras.ai': 'cerebras',
+  'api.groq.com': 'groq',
+};
+
+// Локальные хосты: Ollama и аналоги настраиваются через провайдер llmops
+const Set<String> _localHosts = {'localhost', '127.0.0.1', '::1', '0.0.0.0'};
+
+/// Провайдер, к которому относится хост [url], или null для неизвестных хостов
+String? providerForUrl(String url) {
+  final host = Uri.tryParse(url.trim())?.host.toLowerCase() ?? '';
+  if (host.isEmpty) return null;
+  if (_localHosts.contains(host)) return 'llmops';
+  for (final entry in _knownHosts.entries) {
+    if (host == entry.key || host.endsWith('.${entry.key}')) return entry.value;
+  }
+  return null;
+}
+
+/// Предупреждение о несоответствии [url] провайдеру [provider] или null
+String? providerUrlWarning(String provider, String url) {
+  final expected = providerForUrl(url);
+  if (expected == null || expected == provider) return null;
+  // Локальный OpenAI-совместимый сервер (LM Studio, vLLM) — допустимая настройка
+  if (expected == 'llmops' && provider == 'openai') return null;
+  return localize('config.providerUrlMismatch', {
+    'url': url.trim(),
+    'provider': provider,
+    'expected': expected,
+  });
+}
@@ -0,0 +1,28 @@
+/// Отделение рассуждений модели (`<think>...</think>`) от итогового ответа,
+/// чтобы черновые мысли не попадали в ТЗ.
+final RegExp _thinkBlock = RegExp(r'<think(?:ing)?>([\s\S]*?)</think(?:ing)?>', caseSensitive: false);
+final RegExp _unclosedThink = RegExp(r'^\s*<think(?:ing)?>([\s\S]*)$', caseSensitive: false);
+
+class ReasoningSplit {
+  final String content;
+  final String? reasoning; // null — модель не вернула рассуждений
+
+  const ReasoningSplit(this.content, this.reasoning);
+}
+
+/// Убирает из [text] блоки `<think>`/`<thinking>` и возвращает их отдельно.
+/// Незакрытый блок в начале ответа (оборванная генерация) целиком считается рассуждением.
+ReasoningSplit splitReasoning(String text) {
+  final parts = <String>[];
+  var content = text.replaceAllMapped(_thinkBlock, (m) {
+    parts.add(m.group(1)!.trim());
+    return '';
+  });
+  final unclosed = _unclosedThink.firstMatch(content);
+  if (unclosed != null) {
+    parts.add(unclosed.group(1)!.trim());
+    content = '';
+  }
+  final reasoning = parts.where((p) => p.isNotEmpty).join('\n\n');
+  return ReasoningSplit(content.trim(), reasoning.isEmpty ? null : reasoning);
+}
@@ -0,0 +1,74 @@
+import 'dart:convert';
+
+/// Неверно настроенные шлюзы иногда отвечают потоком SSE (`text/event-stream`)
+/// на запрос со `stream: false`. Такой ответ собирается в обычный chat/completion.
+
+/// true, если ответ — поток SSE: по заголовку Content-Type или по телу `data: ...`
+bool looksLikeEventStream(String? contentType, Object? body) {
+  if (contentType != null && contentType.toLowerCase().contains('text/event-stream')) return true;
+  return body is String && body.trimLeft().startsWith('data:');
+}
+
+/// Собирает тело SSE в ответ формата chat/completion (choices[0].message, finish_reason, usage).
+/// Бросает [FormatException], если в потоке нет ни одного события с choices.
+Map<String, dynamic> completionFromEventStream(String body) {
+  final content = StringBuffer();
+  final reasoning = StringBuffer();
+  String? finishReason;
+  Map<String, dynamic>? usage;
+  String id = '';
+  String model = '';
+  int created = 0;
+  var events = 0;
+
+  for (final rawLine in const LineSplitter().convert(body)) {
+    final line = rawLine.trim();
+    if (!line.startsWith('data:')) continue;
+    final payload = line.substring('data:'.length).trim();
+    if (payload.isEmpty || payload == '[DONE]') continue;
+    final Object? decoded;
+    try {
+      decoded = jsonDecode(payload);
+    } on FormatException {
+      continue; // служебные или обрезанные события пропускаем
+    }
+    if (decoded is! Map) continue;
+    if (decoded['usage'] is Map) usage = Map<String, dynamic>.from(decoded['usage'] as Map);
+    id = decoded['id'] as String? ?? id;
+    model = decoded['model'] as String? ?? model;
+    created = (decoded['created'] as num?)?.toInt() ?? created;
+    final choices = decoded['choices'];
+    if (choices is! List || choices.isEmpty || choices.first is! Map) continue;
+    events++;
+    final choice = choices.first as Map;
+    // delta — в потоке; message — если шлюз прислал целый ответ одним событием
+    final part = (choice['delta'] ?? choice['message']) as Map?;
+    final text = part?['content'];
+    if (text is String) content.write(text);
+    final thought = part?['reasoning_content'] ?? part?['reasoning'];
+    if (thought is String) reasoning.write(thought);
+    finishReason = choice['finish_reason'] as String? ?? finishReason;
+  }
+
+  if (events == 0) {
+    throw const FormatException('event stream contains no completion choices');
+  }
+  return {
+    'id': id,
+    'object': 'chat.completion',
+    'created': created,
+    'model': model,
+    'choices': [
+      {
+        'index': 0,
+        'message': {
+          'role': 'assistant',
+          'content': content.toString(),
+          if (reasoning.isNotEmpty) 'reasoning_content': reasoning.toString(),
+        },
+        'finish_reason': finishReason,
+      },
+    ],
+    if (usage != null) 'usage': usage,
+  };
+}
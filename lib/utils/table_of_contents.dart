@@ -0,0 +1,87 @@
+import 'document_headings.dart';
+
+/// Оглавление Markdown-документа со ссылками на якоря заголовков.
+/// Якоря строятся по правилам GitHub (GFM): кириллица сохраняется,
+/// повторяющиеся заголовки получают суффиксы -1, -2, ...
+
+const String tableOfContentsTitle = 'Содержание';
+
+/// Якорь заголовка в стиле GitHub: нижний регистр, без знаков препинания, пробелы → дефисы
+String headingSlug(String title) {
+  return title
+      .toLowerCase()
+      .replaceAll(RegExp(r'[^\p{L}\p{N}\p{M}\s_-]', unicode: true), '')
+      .trim()
+      .replaceAll(RegExp(r'\s'), '-');
+}
+
+/// Строит блок оглавления по Markdown-заголовкам [content] до уровня [maxLevel].
+/// Единственный заголовок первого уровня в начале документа (название ТЗ) в оглавление не входит.
+/// Бросает [ArgumentError], если в документе нет Markdown-заголовков.
+String buildTableOfContents(String content, {int maxLevel = 3}) {
+  final headings = _markdownHeadings(content);
+  if (headings.isEmpty) {
+    throw ArgumentError('Document has no Markdown headings to build a table of contents');
+  }
+
+  // Якоря считаются по всем заголовкам документа, как у рендерера
+  final used = <String, int>{};
+  final slugs = <String>[];
+  for (final h in headings) {
+    final base = headingSlug(h.title);
+    final count = used[base] ?? 0;
+    used[base] = count + 1;
+    slugs.add(count == 0 ? base : '$base-$count');
+  }
+
+  final skipTitle = headings.first.level == 1 && headings.where((h) => h.level == 1).length == 1;
+  final entries = <(DocumentHeading, String)>[
+    for (var i = skipTitle ? 1 : 0; i < headings.length; i++)
+      if (headings[i].level <= maxLevel) (headings[i], slugs[i]),
+  ];
+  if (entries.isEmpty) {
+    throw ArgumentError('Document has no section headings up to level $maxLevel');
+  }
+  final minLevel = entries.map((e) => e.$1.level).reduce((a, b) => a < b ? a : b);
+  final lines = [
+    for (final (heading, slug) in entries)
+      '${'  ' * (heading.level - minLevel)}- [${heading.title}](#$slug)',
+  ];
+  return '## $tableOfContentsTitle\n\n${lines.join('\n')}\n';
+}
+
+/// Вставляет оглавление в начало документа: после названия (единственного `# ...`)
+/// или в самое начало. В Markdown-ответе с маркерами — внутрь @@@START@@@/@@@END@@@.
+/// Документ без заголовков возвращается без изменений.
+String prependTableOfContents(String text, {int maxLevel = 3}) {
+  const startMarker = '@@@START@@@';
+  const endMarker = '@@@END@@@';
+  final start = text.indexOf(startMarker);
+  final end = text.indexOf(endMarker);
+  if (start >= 0 && end > start) {
+    final inner = text.substring(start + startMarker.length, end);
+    return text.substring(0, start + startMarker.length) +
+        prependTableOfContents(inner, maxLevel: maxLevel) +
+        text.substring(end);
+  }
+
+  final headings = _markdownHeadings(text);
+  if (headings.isEmpty || headings.any((h) => h.title == tableOfContentsTitle)) return text;
+  final String toc;
+  try {
+    toc = buildTableOfContents(text, maxLevel: maxLevel);
+  } on ArgumentError {
+    return text;
+  }
+  final first = headings.first;
+  final titleOnly = first.level == 1 && headings.where((h) => h.level == 1).length == 1;
+  final insertAt = titleOnly ? first.end : text.indexOf(RegExp(r'\S'));
+  final before = text.substring(0, insertAt < 0 ? 0 : insertAt);
+  final after = text.substring(insertAt < 0 ? 0 : insertAt);
+  return titleOnly ? '$before\n\n$toc\n${after.trimLeft()}' : '$before$toc\n$after';
+}
+
+// Только Markdown-заголовки: у HTML-документов (Confluence) своё оглавление-макрос
+List<DocumentHeading> _markdownHeadings(String text) {
+  return extractHeadings(text).where((h) => text.startsWith('#', h.offset)).toList();
+}
@@ -0,0 +1,171 @@
+import 'dart:io';
+import 'package:uuid/uuid.dart';
+
+/// Подстановка переменных вида `{{name}}` в шаблоны ТЗ.
+/// `{{else}}` — часть условного блока, а не переменная.
+final RegExp templatePlaceholderPattern = RegExp(r'\{\{\s*(?!else\s*\}\})([A-Za-zА-Яа-яЁё_][\wА-Яа-яЁё.-]*)\s*\}\}');
+
+/// Результат пробного рендера шаблона
+class TemplateRenderResult {
+  final String content; // шаблон после подстановки
+  final List<String> unfilled; // плейсхолдеры, для которых не передано значение
+  final List<String> problems; // синтаксические проблемы плейсхолдеров
+
+  const TemplateRenderResult({
+    required this.content,
+    this.unfilled = const [],
+    this.problems = const [],
+  });
+
+  bool get isComplete => unfilled.isEmpty && problems.isEmpty;
+}
+
+/// Возвращает уникальные имена плейсхолдеров в порядке появления
+List<String> findTemplatePlaceholders(String content) {
+  final seen = <String>{};
+  return templatePlaceholderPattern
+      .allMatches(content)
+      .map((m) => m.group(1)!)
+      .where(seen.add)
+      .toList();
+}
+
+/// Проверяет синтаксис плейсхолдеров: незакрытые `{{`, лишние `}}`,
+/// недопустимые имена. Возвращает список описаний проблем.
+List<String> validateTemplatePlaceholders(String content) {
+  final problems = <String>[];
+  final lines = content.split('\n');
+  for (var i = 0; i < lines.length; i++) {
+    final line = lines[i];
+    final opens = '{{'.allMatches(line).length;
+    final closes = '}}'.allMatches(line).length;
+    if (opens != closes) {
+      problems.add('Строка ${i + 1}: несбалансированные скобки плейсхолдера');
+      continue;
+    }
+    for (final m in RegExp(r'\{\{(.*?)\}\}').allMatches(line)) {
+      final inner = m.group(1)!.trim();
+      if (inner.isEmpty) {
+        problems.add('Строка ${i + 1}: пустой плейсхолдер {{}}');
+      } else if (!_isDirective(inner) && !templatePlaceholderPattern.hasMatch(m.group(0)!)) {
+        problems.add('Строка ${i + 1}: недопустимое имя плейсхолдера "$inner"');
+      }
+    }
+  }
+  return problems;
+}
+
+/// Подставляет значения [vars] в плейсхолдеры шаблона.
+/// Незаполненные плейсхолдеры остаются в тексте и перечисляются в [TemplateRenderResult.unfilled].
+TemplateRenderResult renderTemplate(String content, Map<String, String> vars) {
+  final unfilled = <String>{};
+  final rendered = content.replaceAllMapped(templatePlaceholderPattern, (m) {
+    final name = m.group(1)!;
+    final value = vars[name];
+    if (value == null) {
+      unfilled.add(name);
+      return m.group(0)!;
+    }
+    return value;
+  });
+  return TemplateRenderResult(
+    content: rendered,
+    unfilled: unfilled.toList(),
+    problems: validateTemplatePlaceholders(content),
+  );
+}
+
+/// Встроенные переменные, которые заполняются без участия пользователя
+const List<String> builtInTemplateVariables = ['today', 'datetime', 'uuid'];
+
+/// Формат даты по умолчанию для локали [localeName] (например, `ru_RU`, `en_US`)
+String defaultDateFormatFor(String localeName) {
+  final locale = localeName.toLowerCase().replaceAll('-', '_');
+  if (locale == 'en_us' || locale.startsWith('en_us.')) return 'MM/dd/yyyy';
+  if (locale.startsWith('en')) return 'dd/MM/yyyy';
+  if (locale.startsWith('ru') || locale.startsWith('de') || locale.startsWith('uk')) return 'dd.MM.yyyy';
+  return 'yyyy-MM-dd';
+}
+
+/// Форматирует [date] по шаблону из токенов yyyy, yy, MM, dd, HH, mm, ss
+String formatTemplateDate(DateTime date, String pattern) {
+  String two(int v) => v.toString().padLeft(2, '0');
+  final tokens = <String, String>{
+    'yyyy': date.year.toString().padLeft(4, '0'),
+    'yy': two(date.year % 100),
+    'MM': two(date.month),
+    'dd': two(date.day),
+    'HH': two(date.hour),
+    'mm': two(date.minute),
+    'ss': two(date.second),
+  };
+  return pattern.replaceAllMapped(RegExp(r'yyyy|yy|MM|dd|HH|mm|ss'), (m) => tokens[m.group(0)]!);
+}
+
+/// Значения встроенных переменных `{{today}}`, `{{datetime}}`, `{{uuid}}`.
+/// [dateFormat] задаёт формат даты; по умолчанию — формат локали системы.
+Map<String, String> resolveBuiltInVariables({DateTime? now, String? dateFormat, String? localeName}) {
+  final date = now ?? DateTime.now();
+  final format = (dateFormat != null && dateFormat.trim().isNotEmpty)
+      ? dateFormat.trim()
+      : defaultDateFormatFor(localeName ?? _systemLocale());
+  return {
+    'today': formatTemplateDate(date, format),
+    'datetime': '${formatTemplateDate(date, format)} ${formatTemplateDate(date, 'HH:mm')}',
+    'uuid': const Uuid().v4(),
+  };
+}
+
+/// Подставляет встроенные переменные и [vars] пользователя (имеют приоритет);
+/// остальные плейсхолдеры остаются в тексте для модели.
+String applyBuiltInVariables(String content, {Map<String, String> vars = const {}, String? dateFormat}) {
+  if (!templatePlaceholderPattern.hasMatch(content)) return content;
+  final merged = {...resolveBuiltInVariables(dateFormat: dateFormat), ...vars};
+  return renderTemplate(content, merged).content;
+}
+
+String _systemLocale() {
+  try {
+    return Platform.localeName;
+  } catch (_) {
+    return 'ru_RU';
+  }
+}
+
+// Условный блок без вложенных условий: {{#if flag}}...{{else}}...{{/if}}, {{#if !flag}} — отрицание
+final RegExp _conditionalBlock = RegExp(
+  r'\{\{#if\s+(!?)\s*([A-Za-zА-Яа-яЁё_][\wА-Яа-яЁё.-]*)\s*\}\}((?:(?!\{\{#if)[\s\S])*?)\{\{/if\}\}',
+);
+final RegExp _conditionalFlag = RegExp(r'\{\{#if\s+!?\s*([A-Za-zА-Яа-яЁё_][\wА-Яа-яЁё.-]*)\s*\}\}');
+
+/// Флаги условных блоков `{{#if flag}}` шаблона в порядке появления
+List<String> findTemplateFlags(String content) {
+  final seen = <String>{};
+  return _conditionalFlag.allMatches(content).map((m) => m.group(1)!).where(seen.add).toList();
+}
+
+/// Раскрывает условные блоки по [flags]: блок остаётся, если флаг true
+/// (или false для `{{#if !flag}}`), иначе удаляется либо заменяется веткой `{{else}}`.
+/// Флаги, которых нет в [flags], считаются false. Вложенные блоки раскрываются изнутри наружу.
+String applyTemplateConditions(String content, Map<String, bool> flags) {
+  var result = content;
+  while (true) {
+    final next = result.replaceAllMapped(_conditionalBlock, (m) {
+      final negate = m.group(1) == '!';
+      final enabled = (flags[m.group(2)!] ?? false) != negate;
+      final body = m.group(3)!;
+      final elseIndex = body.indexOf('{{else}}');
+      final thenPart = elseIndex >= 0 ? body.substring(0, elseIndex) : body;
+      final elsePart = elseIndex >= 0 ? body.substring(elseIndex + '{{else}}'.length) : '';
+      return enabled ? thenPart : elsePart;
+    });
+    if (next == result) break;
+    result = next;
+  }
+  // Пустые строки, оставшиеся на месте удалённых блоков
+  return result.replaceAll(RegExp(r'\n{3,}'), '\n\n');
+}
+
+// Служебные конструкции шаблона, не являющиеся переменными
+bool _isDirective(String inner) =>
+    inner.startsWith('#') || inner.startsWith('/') || inner.contains(':') || inner == 'else';
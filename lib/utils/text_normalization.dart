@@ -0,0 +1,7 @@
+/// Нормализация текстовых файлов, созданных в разных ОС: удаляет UTF-8 BOM
+/// в начале и приводит переводы строк (CRLF, CR) к `\n`, чтобы они не попадали в промт.
+String normalizeTextFileContent(String content) {
+  var text = content;
+  if (text.startsWith('\uFEFF')) text = text.substring(1);
+  return text.replaceAll('\r\n', '\n').replaceAll('\r', '\n');
+}
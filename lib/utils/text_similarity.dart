@@ -0,0 +1,106 @@
+/// Поиск почти одинаковых текстов (дубликатов шаблонов) без попарного сравнения всех со всеми.
+///
+/// Тексты нормализуются (регистр, пробелы), разбиваются на шинглы из трёх слов,
+/// по ним строится MinHash-сигнатура. Кандидаты отбираются по совпадению полос
+/// сигнатуры (LSH), а затем проверяются точным коэффициентом Жаккара.
+
+const int _minHashSize = 32;
+const int _bandRows = 4; // 8 полос по 4 строки: пары с похожестью ~0.8+ почти всегда попадают в кандидаты
+const int _prime = 2147483647; // 2^31 - 1
+
+/// Нормализация для сравнения: нижний регистр, схлопнутые пробелы и переводы строк
+String normalizeForComparison(String text) =>
+    text.toLowerCase().replaceAll(RegExp(r'\s+'), ' ').trim();
+
+/// Множество хешей шинглов из трёх слов (короткие тексты — целиком)
+Set<int> _shingles(String normalized) {
+  final words = normalized.isEmpty ? const <String>[] : normalized.split(' ');
+  if (words.length < 3) return {normalized.hashCode & 0x7fffffff};
+  return {
+    for (var i = 0; i + 3 <= words.length; i++)
+      '${words[i]} ${words[i + 1]} ${words[i + 2]}'.hashCode & 0x7fffffff,
+  };
+}
+
+/// Коэффициент Жаккара двух множеств
+double jaccardSimilarity(Set<int> a, Set<int> b) {
+  if (a.isEmpty && b.isEmpty) return 1.0;
+  final smaller = a.length <= b.length ? a : b;
+  final larger = identical(smaller, a) ? b : a;
+  final intersection = smaller.where(larger.contains).length;
+  return intersection / (a.length + b.length - intersection);
+}
+
+// Фиксированные коэффициенты хеш-функций h(x) = (a*x + b) mod p — сигнатуры сопоставимы между вызовами
+final List<(int, int)> _hashParams = List.generate(
+  _minHashSize,
+  (i) => ((i + 1) * 0x5bd1e995 % _prime | 1, (i + 7) * 0x27d4eb2d % _prime),
+);
+
+List<int> _minHash(Set<int> shingles) {
+  return [
+    for (final (a, b) in _hashParams)
+      shingles.fold<int>(_prime, (min, x) {
+        final h = (a * x + b) % _prime;
+        return h < min ? h : min;
+      }),
+  ];
+}
+
+/// Группирует ключи [texts], тексты которых совпадают после нормализации
+/// или похожи не менее чем на [threshold] (Жаккар по шинглам).
+/// Возвращает только группы из двух и более ключей.
+List<List<String>> findSimilarGroups(Map<String, String> texts, {double threshold = 0.9}) {
+  final keys = texts.keys.toList();
+  final parent = List<int>.generate(keys.length, (i) => i);
+  int find(int i) {
+    while (parent[i] != i) {
+      parent[i] = parent[parent[i]];
+      i = parent[i];
+    }
+    return i;
+  }
+
+  void union(int a, int b) {
+    final ra = find(a), rb = find(b);
+    if (ra != rb) parent[rb] = ra;
+  }
+
+  // Точные дубликаты — по нормализованному тексту
+  final normalized = [for (final k in keys) normalizeForComparison(texts[k]!)];
+  final exact = <String, int>{};
+  for (var i = 0; i < keys.length; i++) {
+    final first = exact.putIfAbsent(normalized[i], () => i);
+    if (first != i) union(first, i);
+  }
+
+  // Похожие — кандидаты из общих LSH-корзин, затем точная проверка
+  if (threshold < 1.0) {
+    final shingles = [for (final n in normalized) _shingles(n)];
+    final buckets = <String, List<int>>{};
+    for (var i = 0; i < keys.length; i++) {
+      if (exact[normalized[i]] != i) continue; // точная копия уже в группе
+      final signature = _minHash(shingles[i]);
+      for (var band = 0; band * _bandRows < _minHashSize; band++) {
+        final rows = signature.sublist(band * _bandRows, (band + 1) * _bandRows);
+        buckets.putIfAbsent('$band:${rows.join(',')}', () => []).add(i);
+      }
+    }
+    final checked = <int>{};
+    for (final bucket in buckets.values) {
+      for (var x = 0; x < bucket.length; x++) {
+        for (var y = x + 1; y < bucket.length; y++) {
+          final i = bucket[x], j = bucket[y];
+          if (!checked.add(i * keys.length + j) || find(i) == find(j)) continue;
+          if (jaccardSimilarity(shingles[i], shingles[j]) >= threshold) union(i, j);
+        }
+      }
+    }
+  }
+
+  final groups = <int, List<String>>{};
+  for (var i = 0; i < keys.length; i++) {
+    groups.putIfAbsent(find(i), () => []).add(keys[i]);
+  }
+  return groups.values.where((g) => g.length > 1).toList();
+}
@@ -0,0 +1,31 @@
+/// Оценка числа токенов. Вызывающий код зависит от [TokenEstimator], поэтому
+/// эвристику можно заменить точным токенизатором (например, tiktoken)
+/// без изменений в местах использования — см. `LLMService.tokenEstimator`.
+abstract class TokenEstimator {
+  /// Оценивает число токенов [text] для модели [model] (null — модель неизвестна)
+  int estimate(String text, {String? model});
+}
+
+/// Грубая оценка без токенизатора.
+///
+/// Для латиницы BPE-токенизаторы дают ~4 символа на токен, для кириллицы
+/// заметно меньше (~2 символа). Оценка намеренно завышена, чтобы проверка
+/// размера запроса срабатывала раньше, чем отказ шлюза.
+class HeuristicTokenEstimator implements TokenEstimator {
+  const HeuristicTokenEstimator();
+
+  @override
+  int estimate(String text, {String? model}) {
+    if (text.isEmpty) return 0;
+    var ascii = 0;
+    var other = 0;
+    for (final unit in text.codeUnits) {
+      if (unit < 0x80) {
+        ascii++;
+      } else {
+        other++;
+      }
+    }
+    return (ascii / 4 + other / 2).ceil();
+  }
+}
@@ -0,0 +1,27 @@
+/// Обрезка оборванного окончания ответа, усечённого по лимиту токенов.
+///
+/// Ответ обрезается до последнего законченного предложения или последней
+/// целой строки (пункта списка, строки таблицы, заголовка). Ответ, который
+/// уже заканчивается законченной фразой, не меняется.
+
+// Символы, которыми заканчивается законченное предложение или элемент разметки
+const String _terminators = '.!?…:;|>)»"`';
+
+/// Возвращает [text] без оборванного хвоста. Если обрезать нечего или после
+/// обрезки ничего не останется, возвращается исходный текст.
+String trimIncompleteEnding(String text) {
+  final trimmed = text.trimRight();
+  if (trimmed.isEmpty || _terminators.contains(trimmed[trimmed.length - 1])) return text;
+
+  // Последний перенос строки: всё до него — целые строки
+  final lastNewline = trimmed.lastIndexOf('\n');
+  // Последний конец предложения в оборванной строке
+  var sentenceEnd = -1;
+  for (final match in RegExp(r'[.!?…](?=\s)').allMatches(trimmed)) {
+    if (match.start > lastNewline) sentenceEnd = match.end;
+  }
+  final cut = sentenceEnd > lastNewline ? sentenceEnd : lastNewline;
+  if (cut <= 0) return text;
+  final result = trimmed.substring(0, cut).trimRight();
+  return result.isEmpty ? text : result;
+}
@@ -25,6 +25,7 @@ class InputPanel extends StatefulWidget {
   final VoidCallback onGenerate;
   final VoidCallback onClear;
   final ValueChanged<GenerationHistory> onHistoryItemTap;
+  final TextEditingController? projectController; // проект генерации (необязательно)
 
   const InputPanel({
     super.key,
@@ -37,6 +38,7 @@ class InputPanel extends StatefulWidget {
     required this.onGenerate,
     required this.onClear,
     required this.onHistoryItemTap,
+    this.projectController,
   });
 
   @override
@@ -650,6 +652,21 @@ class _InputPanelState extends State<InputPanel> {
                   ),
                   const SizedBox(height: 16),
                 ],
+
+                if (widget.projectController != null) ...[
+                  TextField(
+                    controller: widget.projectController,
+                    style: TextStyle(fontSize: 14, color: fieldTextColor),
+                    decoration: InputDecoration(
+                      isDense: true,
+                      prefixIcon: const Icon(Icons.folder_outlined, size: 18),
+                      hintText: 'Проект (необязательно)',
+                      hintStyle: TextStyle(color: hintColor),
+                      border: const OutlineInputBorder(),
+                    ),
+                  ),
+                  const SizedBox(height: 16),
+                ],
                 
                 // Кнопки
                 Row(
@@ -786,6 +803,16 @@ class _InputPanelState extends State<InputPanel> {
                                       ),
                                     ),
                                   ),
+                                  if (item.partial) ...[
+                                    const SizedBox(width: 8),
+                                    Tooltip(
+                                      message: 'Генерация была прервана — сохранена полученная часть',
+                                      child: Text(
+                                        'Частично',
+                                        style: TextStyle(fontSize: 10, color: Colors.red.shade400),
+                                      ),
+                                    ),
+                                  ],
                                 ],
                               ),
                               const SizedBox(height: 2),
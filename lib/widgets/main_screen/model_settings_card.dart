@@ -82,7 +82,12 @@ class ModelSettingsCard extends StatelessWidget {
         break;
     }
     
-    return Row(
+    // Сохранённая модель пропала у провайдера — предупреждаем до генерации
+    final selectedModel = configService.config?.defaultModel;
+    final selectedMissing = llmService.availableModels.isNotEmpty &&
+        (selectedModel == null || !llmService.availableModels.contains(selectedModel));
+
+    final row = Row(
       children: [
         const Text('Модель: ', style: TextStyle(fontWeight: FontWeight.w600)),
         const SizedBox(width: 8),
@@ -91,7 +96,8 @@ class ModelSettingsCard extends StatelessWidget {
             constraints: const BoxConstraints(minHeight: 48),
             child: llmService.availableModels.isNotEmpty 
               ? DropdownButton<String>(
-                  value: configService.config?.defaultModel,
+                  value: selectedMissing ? null : selectedModel,
+                  hint: const Text('Выберите модель'),
                   isExpanded: true,
                   isDense: false,
                   style: TextStyle(
@@ -138,7 +144,7 @@ class ModelSettingsCard extends StatelessWidget {
             icon: const Icon(Icons.refresh, size: 20),
             onPressed: llmService.isLoading ? null : () async {
               try {
-                await llmService.getModels();
+                await llmService.refreshModels();
               } catch (e) {
                 print('Error refreshing models: $e');
               }
@@ -148,6 +154,36 @@ class ModelSettingsCard extends StatelessWidget {
 
       ],
     );
+
+    if (!selectedMissing) return row;
+    return Column(
+      crossAxisAlignment: CrossAxisAlignment.start,
+      children: [
+        row,
+        const SizedBox(height: 8),
+        Container(
+          padding: const EdgeInsets.symmetric(horizontal: 12, vertical: 8),
+          decoration: BoxDecoration(
+            color: Colors.orange.withOpacity(0.12),
+            borderRadius: BorderRadius.circular(6),
+            border: Border.all(color: Colors.orange.withOpacity(0.5)),
+          ),
+          child: Row(
+            children: [
+              const Icon(Icons.warning_amber_rounded, color: Colors.orange, size: 20),
+              const SizedBox(width: 8),
+              Expanded(
+                child: Text(
+                  selectedModel == null || selectedModel.isEmpty
+                      ? 'Модель не выбрана — выберите модель из списка'
+                      : 'Модель "$selectedModel" недоступна у провайдера — выберите другую',
+                ),
+              ),
+            ],
+          ),
+        ),
+      ],
+    );
   }
 
   Widget _buildTemplateSection(TemplateService templateService) {
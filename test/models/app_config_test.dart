@@ -0,0 +1,64 @@
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/models/app_config.dart';
+
+void main() {
+  group('AppConfig.copyWith', () {
+    final config = AppConfig(
+      apiUrl: 'https://gateway.example/v1',
+      apiToken: 'token',
+      modelPrefix: 'openai/',
+      caCertPath: '/etc/ssl/corp.pem',
+      healthPath: '/health',
+      maxConcurrency: 5,
+      endpoints: const {'prod': 'https://gateway.example/v1'},
+      activeEndpoint: 'prod',
+    );
+
+    test('keeps optional settings that are not passed', () {
+      final copy = config.copyWith(apiToken: 'new-token');
+
+      expect(copy.apiToken, 'new-token');
+      expect(copy.modelPrefix, 'openai/');
+      expect(copy.caCertPath, '/etc/ssl/corp.pem');
+      expect(copy.healthPath, '/health');
+      expect(copy.maxConcurrency, 5);
+      expect(copy.activeEndpoint, 'prod');
+    });
+
+    test('clears optional settings passed as null', () {
+      final copy = config.copyWith(
+        modelPrefix: null,
+        caCertPath: null,
+        healthPath: null,
+        maxConcurrency: null,
+        activeEndpoint: null,
+      );
+
+      expect(copy.modelPrefix, isNull);
+      expect(copy.caCertPath, isNull);
+      expect(copy.healthPath, isNull);
+      expect(copy.maxConcurrency, isNull);
+      expect(copy.activeEndpoint, isNull);
+      expect(copy.endpoints, config.endpoints);
+    });
+  });
+
+  group('AppConfig.withoutStaleEndpoint', () {
+    final config = AppConfig(
+      apiUrl: 'https://gateway.example/v1/',
+      apiToken: 'token',
+      endpoints: const {'prod': 'https://gateway.example/v1'},
+      activeEndpoint: 'prod',
+    );
+
+    test('keeps the endpoint while the URL still matches it', () {
+      expect(config.withoutStaleEndpoint().activeEndpoint, 'prod');
+    });
+
+    test('drops the endpoint after the URL was changed by hand', () {
+      final edited = config.copyWith(apiUrl: 'https://other.example/v1');
+
+      expect(edited.withoutStaleEndpoint().activeEndpoint, isNull);
+    });
+  });
+}
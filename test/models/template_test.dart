@@ -0,0 +1,47 @@
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/models/template.dart';
+
+void main() {
+  group('Template.copyWith', () {
+    final template = Template(
+      id: 'custom_1',
+      name: 'Шаблон',
+      content: '# Раздел\n',
+      createdAt: DateTime(2025, 1, 1),
+      updatedAt: DateTime(2025, 2, 1),
+      format: TemplateFormat.markdown,
+      preferredModel: 'gpt-4o',
+      category: 'Backend',
+      sectionOrder: const ['Раздел'],
+      temperature: 0.3,
+    );
+
+    test('keeps optional fields that are not passed', () {
+      final copy = template.copyWith(name: 'Новое имя');
+
+      expect(copy.name, 'Новое имя');
+      expect(copy.updatedAt, DateTime(2025, 2, 1));
+      expect(copy.preferredModel, 'gpt-4o');
+      expect(copy.category, 'Backend');
+      expect(copy.sectionOrder, ['Раздел']);
+      expect(copy.temperature, 0.3);
+    });
+
+    test('clears optional fields passed as null', () {
+      final copy = template.copyWith(
+        updatedAt: null,
+        preferredModel: null,
+        category: null,
+        sectionOrder: null,
+        temperature: null,
+      );
+
+      expect(copy.updatedAt, isNull);
+      expect(copy.preferredModel, isNull);
+      expect(copy.category, isNull);
+      expect(copy.sectionOrder, isNull);
+      expect(copy.temperature, isNull);
+      expect(copy.content, template.content);
+    });
+  });
+}
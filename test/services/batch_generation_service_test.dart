@@ -0,0 +1,126 @@
+import 'dart:async';
+import 'dart:math';
+
+import 'package:dio/dio.dart' show CancelToken;
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/models/output_format.dart';
+import 'package:tee_zee_nator/models/verbosity.dart';
+import 'package:tee_zee_nator/services/batch_generation_service.dart';
+import 'package:tee_zee_nator/services/llm_service.dart';
+
+class _PendingCall {
+  final String input;
+  final Completer<String> completer = Completer<String>();
+  final CancelToken? cancelToken;
+
+  _PendingCall(this.input, this.cancelToken);
+}
+
+/// Генерация, которую тест завершает вручную: так видно, сколько запросов
+/// выполняется одновременно и что происходит с ответами после отмены
+class _ControlledLLMService extends LLMService {
+  final List<_PendingCall> calls = [];
+  int running = 0;
+  int maxRunning = 0;
+
+  @override
+  Future<String> generateTZ({
+    required String rawRequirements,
+    String? changes,
+    String? templateContent,
+    OutputFormat format = OutputFormat.markdown,
+    String? model,
+    List<String> promptSnippets = const [],
+    Verbosity verbosity = Verbosity.normal,
+    List<String> sectionOrder = const [],
+    double? temperature,
+    CancelToken? cancelToken,
+  }) async {
+    final call = _PendingCall(rawRequirements, cancelToken);
+    calls.add(call);
+    running++;
+    maxRunning = max(maxRunning, running);
+    try {
+      return await call.completer.future;
+    } finally {
+      running--;
+    }
+  }
+}
+
+// Даёт воркерам пакета дойти до следующего await
+Future<void> _settle() => Future<void>.delayed(Duration.zero);
+
+void main() {
+  late _ControlledLLMService llm;
+  late BatchGenerationService batch;
+
+  setUp(() {
+    llm = _ControlledLLMService();
+    batch = BatchGenerationService(llmService: llm);
+  });
+
+  test('runs at most `concurrency` items at once and returns every result', () async {
+    final inputs = List.generate(5, (i) => 'req $i');
+    final done = batch.runBatch(inputs: inputs, concurrency: 2);
+
+    await _settle();
+    expect(llm.calls.map((c) => c.input), ['req 0', 'req 1']);
+
+    while (llm.calls.any((c) => !c.completer.isCompleted)) {
+      for (final call in llm.calls.where((c) => !c.completer.isCompleted).toList()) {
+        call.completer.complete('out ${call.input}');
+      }
+      await _settle();
+    }
+
+    final results = await done;
+    expect(llm.maxRunning, 2);
+    expect(results.map((r) => r.index).toSet(), {0, 1, 2, 3, 4});
+    for (final result in results) {
+      expect(result.output, 'out ${inputs[result.index]}');
+    }
+  });
+
+  test('cancelBatch aborts in-flight requests and skips pending items', () async {
+    final done = batch.runBatch(inputs: ['a', 'b', 'c', 'd'], concurrency: 2);
+    await _settle();
+    llm.calls.first.completer.complete('out a');
+    await _settle();
+    expect(llm.calls.map((c) => c.input), ['a', 'b', 'c']);
+
+    final partial = batch.cancelBatch();
+
+    expect(partial.map((r) => r.input), ['a']);
+    expect(await done, partial);
+    // Запросы b и c ещё выполнялись — их HTTP-запросы должны быть отменены
+    expect(llm.calls.skip(1).every((c) => c.cancelToken?.isCancelled == true), isTrue);
+    expect(batch.isRunning, isFalse);
+
+    // Ответы, пришедшие после отмены, не попадают в результаты, а d так и не запускается
+    llm.calls[1].completer.complete('late b');
+    llm.calls[2].completer.complete('late c');
+    await _settle();
+    expect(batch.results.map((r) => r.input), ['a']);
+    expect(llm.calls.map((c) => c.input), isNot(contains('d')));
+  });
+
+  test('a new batch is not affected by late responses of a cancelled one', () async {
+    final first = batch.runBatch(inputs: ['old'], concurrency: 1);
+    await _settle();
+    batch.cancelBatch();
+    await first;
+
+    final second = batch.runBatch(inputs: ['new'], concurrency: 1);
+    await _settle();
+    final oldCall = llm.calls.firstWhere((c) => c.input == 'old');
+    final newCall = llm.calls.firstWhere((c) => c.input == 'new');
+    expect(newCall.cancelToken?.isCancelled, isFalse);
+
+    oldCall.completer.complete('late old');
+    newCall.completer.complete('out new');
+
+    final results = await second;
+    expect(results.map((r) => r.output), ['out new']);
+  });
+}
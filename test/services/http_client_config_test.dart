@@ -0,0 +1,140 @@
+import 'dart:io';
+
+import 'package:dio/dio.dart';
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/models/app_config.dart';
+import 'package:tee_zee_nator/services/error_log_service.dart';
+import 'package:tee_zee_nator/services/http_client_config.dart';
+
+const _fixtures = 'test/fixtures/tls';
+
+// HTTPS-сервер на локальном порту с сертификатом [certFile]
+Future<HttpServer> _startServer(String certFile, String keyFile) async {
+  final context = SecurityContext()
+    ..useCertificateChain('$_fixtures/$certFile')
+    ..usePrivateKey('$_fixtures/$keyFile');
+  final server = await HttpServer.bindSecure(InternetAddress.loopbackIPv4, 0, context);
+  server.listen((request) {
+    request.response
+      ..headers.contentType = ContentType.json
+      ..write('{"ok":true}')
+      ..close();
+  });
+  return server;
+}
+
+Dio _dioFor(AppConfig config) {
+  final dio = Dio();
+  configureTls(dio, config);
+  return dio;
+}
+
+void main() {
+  group('insecureSkipVerify', () {
+    late HttpServer server;
+    late String url;
+
+    setUp(() async {
+      server = await _startServer('self_signed.crt', 'self_signed.key');
+      url = 'https://localhost:${server.port}/models';
+    });
+
+    tearDown(() => server.close(force: true));
+
+    test('rejects a self-signed certificate by default', () async {
+      final dio = _dioFor(AppConfig(apiUrl: url, apiToken: 'token'));
+
+      await expectLater(dio.get<dynamic>(url), throwsA(isA<DioException>()));
+    });
+
+    test('connects to a self-signed server when explicitly enabled', () async {
+      final dio = _dioFor(AppConfig(apiUrl: url, apiToken: 'token', insecureSkipVerify: true));
+
+      final response = await dio.get<dynamic>(url);
+
+      expect(response.statusCode, 200);
+    });
+
+    test('records a security warning whenever it is applied', () {
+      ErrorLogService().clear();
+
+      _dioFor(AppConfig(apiUrl: url, apiToken: 'token', insecureSkipVerify: true));
+
+      expect(ErrorLogService().recentErrors.single.source, 'security');
+    });
+  });
+
+  group('loadCaBundle', () {
+    late Directory dir;
+
+    setUp(() async {
+      dir = await Directory.systemTemp.createTemp('ca_bundle_test');
+    });
+
+    tearDown(() => dir.delete(recursive: true));
+
+    test('throws a clear error for a missing file', () {
+      expect(
+        () => loadCaBundle('${dir.path}/missing.pem'),
+        throwsA(isA<CaCertificateException>().having((e) => e.message, 'message', contains('не найден'))),
+      );
+    });
+
+    test('throws a clear error for a file without PEM certificates', () async {
+      final file = File('${dir.path}/not-a-cert.pem');
+      await file.writeAsString('just some text, not a certificate');
+
+      expect(
+        () => loadCaBundle(file.path),
+        throwsA(isA<CaCertificateException>().having((e) => e.message, 'message', contains('PEM'))),
+      );
+    });
+
+    test('throws a clear error for a damaged certificate', () async {
+      final file = File('${dir.path}/damaged.pem');
+      await file.writeAsString('-----BEGIN CERTIFICATE-----\nnot base64\n-----END CERTIFICATE-----\n');
+
+      expect(() => loadCaBundle(file.path), throwsA(isA<CaCertificateException>()));
+    });
+
+    test('loads a valid CA bundle', () {
+      expect(loadCaBundle('$_fixtures/ca.crt'), isA<SecurityContext>());
+    });
+  });
+
+  group('caCertPath', () {
+    late HttpServer server;
+    late String url;
+
+    setUp(() async {
+      // Сертификат сервера выпущен тестовым корпоративным CA
+      server = await _startServer('server.crt', 'server.key');
+      url = 'https://localhost:${server.port}/models';
+    });
+
+    tearDown(() => server.close(force: true));
+
+    test('trusts a server signed by the configured CA', () async {
+      final dio = _dioFor(AppConfig(apiUrl: url, apiToken: 'token', caCertPath: '$_fixtures/ca.crt'));
+
+      final response = await dio.get<dynamic>(url);
+
+      expect(response.statusCode, 200);
+    });
+
+    test('rejects the same server without the CA', () async {
+      final dio = _dioFor(AppConfig(apiUrl: url, apiToken: 'token'));
+
+      await expectLater(dio.get<dynamic>(url), throwsA(isA<DioException>()));
+    });
+
+    test('fails requests with the CA error when the bundle is missing', () async {
+      final dio = _dioFor(AppConfig(apiUrl: url, apiToken: 'token', caCertPath: '$_fixtures/missing.crt'));
+
+      await expectLater(
+        dio.get<dynamic>(url),
+        throwsA(isA<DioException>().having((e) => e.error, 'error', isA<CaCertificateException>())),
+      );
+    });
+  });
+}
@@ -0,0 +1,130 @@
+import 'package:dio/dio.dart' show CancelToken;
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/exceptions/content_processing_exceptions.dart';
+import 'package:tee_zee_nator/exceptions/llm_exceptions.dart';
+import 'package:tee_zee_nator/models/app_config.dart';
+import 'package:tee_zee_nator/models/finish_reason.dart';
+import 'package:tee_zee_nator/models/llm_response.dart';
+import 'package:tee_zee_nator/services/llm_provider.dart';
+import 'package:tee_zee_nator/services/llm_service.dart';
+
+const _document = '@@@START@@@\n# Техническое задание\n\n'
+    'Система принимает заявки пользователей и отправляет уведомления ответственным.\n@@@END@@@';
+
+/// Провайдер без сети: отвечает по очереди заготовленными ответами.
+/// Элемент очереди — текст ответа или исключение, которое нужно бросить.
+class _ScriptedProvider implements LLMProvider {
+  final List<Object> replies;
+  int requests = 0;
+
+  _ScriptedProvider(this.replies);
+
+  @override
+  Future<LLMResponse> sendRequestDetailed({
+    required String systemPrompt,
+    required String userPrompt,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+    CancelToken? cancelToken,
+  }) async {
+    final reply = replies[requests++];
+    if (reply is Exception) throw reply;
+    return LLMResponse(content: reply as String, finishReason: FinishReason.stop);
+  }
+
+  @override
+  Future<String> sendRequest({
+    required String systemPrompt,
+    required String userPrompt,
+    String? model,
+    int? maxTokens,
+    double? temperature,
+    CancelToken? cancelToken,
+  }) async =>
+      (await sendRequestDetailed(systemPrompt: systemPrompt, userPrompt: userPrompt, model: model)).content;
+
+  @override
+  Future<List<String>> getModels() async => availableModels;
+
+  @override
+  Future<bool> testConnection() async => true;
+
+  @override
+  bool get hasModels => true;
+
+  @override
+  List<String> get availableModels => const ['test-model'];
+
+  @override
+  bool get isLoading => false;
+
+  @override
+  String? get error => null;
+
+  @override
+  FinishReason? get lastFinishReason => null;
+}
+
+void main() {
+  late LLMService service;
+
+  LLMService serviceWith(_ScriptedProvider provider, {int? emptyResponseRetries}) {
+    return LLMService()
+      ..initializeWithProvider(
+        provider,
+        AppConfig(
+          apiUrl: 'http://localhost',
+          apiToken: 'token',
+          defaultModel: 'test-model',
+          emptyResponseRetries: emptyResponseRetries,
+        ),
+      );
+  }
+
+  Future<String> generate() => service.generateTZ(rawRequirements: 'Нужна форма приёма заявок с уведомлениями');
+
+  test('retries an empty reply and returns the next valid one', () async {
+    final provider = _ScriptedProvider(['', _document]);
+    service = serviceWith(provider, emptyResponseRetries: 1);
+
+    final result = await generate();
+
+    expect(provider.requests, 2);
+    expect(result, contains('# Техническое задание'));
+  });
+
+  test('retries a reply made only of whitespace or reasoning', () async {
+    final provider = _ScriptedProvider(['  \n ', '<think>думаю</think>', _document]);
+    service = serviceWith(provider, emptyResponseRetries: 2);
+
+    await generate();
+
+    expect(provider.requests, 3);
+  });
+
+  test('retries when the provider reports a response without choices', () async {
+    final provider = _ScriptedProvider([const EmptyResponseException('test'), _document]);
+    service = serviceWith(provider, emptyResponseRetries: 1);
+
+    await generate();
+
+    expect(provider.requests, 2);
+  });
+
+  test('does not retry without emptyResponseRetries', () async {
+    final provider = _ScriptedProvider(['', _document]);
+    service = serviceWith(provider);
+
+    await expectLater(generate(), throwsA(isA<LLMResponseValidationException>()));
+    expect(provider.requests, 1);
+  });
+
+  test('fails after the retries are exhausted', () async {
+    final provider = _ScriptedProvider(['', ' ', _document]);
+    service = serviceWith(provider, emptyResponseRetries: 1);
+
+    await expectLater(generate(), throwsA(isA<LLMResponseValidationException>()));
+    expect(provider.requests, 2);
+  });
+}
@@ -0,0 +1,38 @@
+import 'dart:convert';
+import 'dart:io';
+
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/models/template.dart';
+import 'package:tee_zee_nator/services/template_file_store.dart';
+
+void main() {
+  group('TemplateFileStore', () {
+    late Directory dir;
+
+    setUp(() async {
+      dir = await Directory.systemTemp.createTemp('template_store_test');
+    });
+
+    tearDown(() async {
+      await dir.delete(recursive: true);
+    });
+
+    test('loads a template file saved on Windows with BOM and CRLF', () async {
+      final store = TemplateFileStore(dir.path);
+      await store.save(Template(
+        id: 'team',
+        name: 'Team',
+        content: 'placeholder',
+        createdAt: DateTime(2026, 1, 1),
+        format: TemplateFormat.markdown,
+      ));
+      // Файл шаблона перезаписан редактором Windows: BOM в начале и CRLF
+      final file = File('${dir.path}${Platform.pathSeparator}team.md');
+      await file.writeAsBytes([0xEF, 0xBB, 0xBF, ...utf8.encode('# Раздел\r\n\r\nТекст\r\n')]);
+
+      final templates = await store.loadAll();
+
+      expect(templates.single.content, '# Раздел\n\nТекст\n');
+    });
+  });
+}
@@ -0,0 +1,81 @@
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/models/template.dart';
+import 'package:tee_zee_nator/services/template_service.dart';
+
+Template _template(String id, String name, {String content = '# Раздел\n', bool isDefault = false}) {
+  return Template(
+    id: id,
+    name: name,
+    content: content,
+    isDefault: isDefault,
+    createdAt: DateTime(2025, 1, 1),
+    format: TemplateFormat.markdown,
+  );
+}
+
+void main() {
+  group('validateTemplateSet', () {
+    test('keeps the first custom_1 and reassigns the duplicate', () {
+      final first = _template('custom_1', 'Первый');
+      final second = _template('custom_1', 'Второй', content: '# Другой\n');
+
+      final checked = TemplateService.validateTemplateSet([first, second]);
+
+      expect(checked.templates, hasLength(2));
+      expect(checked.templates[0].id, 'custom_1');
+      expect(checked.templates[0].name, 'Первый');
+      final reassigned = checked.templates[1];
+      expect(reassigned.id, startsWith('user_'));
+      expect(reassigned.name, 'Второй');
+      expect(reassigned.content, '# Другой\n');
+      expect(checked.fixes.single, contains('Reassigned duplicate id custom_1'));
+    });
+
+    test('gives every duplicate its own new id', () {
+      final checked = TemplateService.validateTemplateSet([
+        for (var i = 0; i < 3; i++) _template('custom_1', 'Шаблон $i'),
+      ]);
+
+      final ids = checked.templates.map((t) => t.id).toList();
+      expect(ids.first, 'custom_1');
+      expect(ids.toSet(), hasLength(3));
+      expect(checked.fixes, hasLength(2));
+    });
+
+    test('assigns an id to a template with an empty id', () {
+      final checked = TemplateService.validateTemplateSet([_template('  ', 'Без id')]);
+
+      expect(checked.templates.single.id, startsWith('user_'));
+      expect(checked.fixes.single, contains('with empty id'));
+    });
+
+    test('keeps a new custom template that has no content yet', () {
+      final checked = TemplateService.validateTemplateSet([
+        _template('user_1', 'Новый шаблон', content: ''),
+        _template('default_1', 'Встроенный', content: '', isDefault: true),
+      ]);
+
+      expect(checked.templates.map((t) => t.id), ['user_1', 'default_1']);
+      expect(checked.fixes, isEmpty);
+    });
+
+    test('drops an empty custom template without id', () {
+      final checked = TemplateService.validateTemplateSet([
+        _template('', 'Пустой', content: '  \n'),
+        _template('custom_1', 'Мой'),
+      ]);
+
+      expect(checked.templates.map((t) => t.id), ['custom_1']);
+      expect(checked.fixes.single, contains('empty content'));
+    });
+
+    test('leaves a valid set unchanged', () {
+      final templates = [_template('default_1', 'Встроенный', isDefault: true), _template('custom_1', 'Мой')];
+
+      final checked = TemplateService.validateTemplateSet(templates);
+
+      expect(checked.templates.map((t) => t.id), ['default_1', 'custom_1']);
+      expect(checked.fixes, isEmpty);
+    });
+  });
+}
@@ -0,0 +1,78 @@
+import 'dart:io';
+
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/utils/atomic_file.dart';
+
+void main() {
+  late Directory dir;
+  late File target;
+
+  setUp(() async {
+    dir = await Directory.systemTemp.createTemp('atomic_file_test');
+    target = File('${dir.path}${Platform.pathSeparator}config.json');
+  });
+
+  tearDown(() async {
+    await dir.delete(recursive: true);
+  });
+
+  List<String> leftovers() =>
+      dir.listSync().map((e) => e.path).where((p) => p.endsWith('.tmp')).toList();
+
+  test('a reader never sees a partially written file', () async {
+    // Большие версии, чтобы запись на диск не была мгновенной
+    final versions = List.generate(20, (i) => '$i'.padRight(512 * 1024, String.fromCharCode(65 + i % 26)));
+    await target.writeAsString(versions.first);
+
+    var reading = true;
+    final observed = <String>{};
+    final reader = () async {
+      while (reading) {
+        observed.add(await target.readAsString());
+        await Future<void>.delayed(Duration.zero);
+      }
+    }();
+
+    for (final version in versions.skip(1)) {
+      await writeStringAtomically(target, version);
+    }
+    reading = false;
+    await reader;
+
+    expect(observed, isNotEmpty);
+    for (final content in observed) {
+      expect(versions, contains(content), reason: 'target was observed in a partial state');
+    }
+    expect(await target.readAsString(), versions.last);
+    expect(leftovers(), isEmpty);
+  });
+
+  test('overlapping writes to one file finish with the last write', () async {
+    final writes = [
+      for (var i = 0; i < 10; i++) writeStringAtomically(target, 'version $i'.padRight(64 * 1024, '.')),
+    ];
+    await Future.wait(writes);
+
+    expect(await target.readAsString(), 'version 9'.padRight(64 * 1024, '.'));
+    expect(leftovers(), isEmpty);
+  });
+
+  test('a failed write keeps the target and removes the temp file', () async {
+    // Переименовать файл поверх непустого каталога нельзя — запись завершится ошибкой
+    final blocked = Directory('${dir.path}${Platform.pathSeparator}blocked');
+    await File('${blocked.path}${Platform.pathSeparator}keep.txt').create(recursive: true);
+
+    await expectLater(writeStringAtomically(File(blocked.path), 'new content'), throwsA(isA<FileSystemException>()));
+
+    expect(await blocked.exists(), isTrue);
+    expect(leftovers(), isEmpty);
+  });
+
+  test('flushPendingWrites waits for writes in progress', () async {
+    final write = writeStringAtomically(target, 'flushed');
+    await flushPendingWrites();
+
+    expect(await target.readAsString(), 'flushed');
+    await write;
+  });
+}
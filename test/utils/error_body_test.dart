@@ -0,0 +1,52 @@
+import 'dart:convert';
+
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/utils/error_body.dart';
+
+void main() {
+  group('describeErrorBody', () {
+    test('replaces an HTML error page with a short message and its title', () {
+      const page = '<!DOCTYPE html><html><head><title>502 Bad\n  Gateway</title></head>'
+          '<body><h1>Bad Gateway</h1><p>nginx</p></body></html>';
+
+      expect(
+        describeErrorBody(page, statusCode: 502),
+        'gateway returned an HTML error page (status 502): 502 Bad Gateway',
+      );
+    });
+
+    test('reports an HTML page without title and without status', () {
+      expect(
+        describeErrorBody('<html><body>oops</body></html>'),
+        'gateway returned an HTML error page (no status)',
+      );
+    });
+
+    test('truncates an oversized body and reports the remainder', () {
+      final body = 'x' * (maxErrorBodyLength + 1500);
+
+      final result = describeErrorBody(body, statusCode: 500);
+
+      expect(result, startsWith('x' * maxErrorBodyLength));
+      expect(result, endsWith('… (1500 more chars)'));
+      expect(result.length, lessThan(maxErrorBodyLength + 30));
+    });
+
+    test('decodes bytes and strips control characters', () {
+      final bytes = [...utf8.encode('Ошибка'), 0x00, 0x07, ...utf8.encode(' шлюза'), 0xFF];
+
+      expect(describeErrorBody(bytes, statusCode: 400), 'Ошибка шлюза');
+    });
+
+    test('describes a body made only of binary noise', () {
+      expect(
+        describeErrorBody(<int>[0x00, 0x01, 0xFE, 0xFF], statusCode: 500),
+        'empty or binary response body (status 500)',
+      );
+    });
+
+    test('returns an empty string for a missing body', () {
+      expect(describeErrorBody(null), isEmpty);
+    });
+  });
+}
@@ -0,0 +1,68 @@
+import 'dart:convert';
+
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/utils/extra_body_fields.dart';
+
+void main() {
+  group('mergeExtraBodyFields', () {
+    final body = <String, dynamic>{
+      'model': 'gpt-4o',
+      'messages': [
+        {'role': 'user', 'content': 'ping'},
+      ],
+      'stream': false,
+      'temperature': 0.7,
+    };
+
+    test('merges a nested extra field and produces valid JSON', () {
+      final merged = mergeExtraBodyFields(body, {
+        'provider': {
+          'order': ['openai', 'azure'],
+          'allow_fallbacks': false,
+        },
+        'route': 'fallback',
+      });
+
+      final decoded = jsonDecode(jsonEncode(merged)) as Map<String, dynamic>;
+      expect(decoded['provider'], {
+        'order': ['openai', 'azure'],
+        'allow_fallbacks': false,
+      });
+      expect(decoded['route'], 'fallback');
+      expect(decoded['temperature'], 0.7);
+    });
+
+    test('does not let extra fields overwrite reserved fields', () {
+      final merged = mergeExtraBodyFields(body, {
+        'model': 'attacker-model',
+        'messages': <Object>[],
+        'stream': true,
+        'route': 'fallback',
+      });
+
+      expect(merged['model'], 'gpt-4o');
+      expect(merged['messages'], body['messages']);
+      expect(merged['stream'], false);
+      expect(merged['route'], 'fallback');
+    });
+
+    test('skips values that cannot be encoded as JSON', () {
+      final merged = mergeExtraBodyFields(body, {'bad': Object(), 'ok': 1});
+
+      expect(merged.containsKey('bad'), isFalse);
+      expect(merged['ok'], 1);
+      expect(() => jsonEncode(merged), returnsNormally);
+    });
+
+    test('returns the body unchanged without extra fields', () {
+      expect(mergeExtraBodyFields(body, null), same(body));
+      expect(mergeExtraBodyFields(body, {}), same(body));
+    });
+
+    test('does not modify the original body', () {
+      mergeExtraBodyFields(body, {'route': 'fallback'});
+
+      expect(body.containsKey('route'), isFalse);
+    });
+  });
+}
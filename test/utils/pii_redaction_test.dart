@@ -0,0 +1,63 @@
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/utils/pii_redaction.dart';
+
+void main() {
+  group('redactPii', () {
+    test('masks email addresses', () {
+      final result = redactPii('Пишите на ivan.petrov+tz@example.co.uk до пятницы');
+
+      expect(result.text, 'Пишите на [EMAIL] до пятницы');
+      expect(result.redacted, ['ivan.petrov+tz@example.co.uk']);
+    });
+
+    test('masks card numbers that pass the Luhn check', () {
+      expect(redactPii('Карта 4111 1111 1111 1111.').text, 'Карта [CARD].');
+      expect(redactPii('Карта 5500-0000-0000-0004').text, 'Карта [CARD]');
+      expect(redactPii('Amex 378282246310005').text, 'Amex [CARD]');
+    });
+
+    test('keeps card-like numbers that fail the Luhn check', () {
+      const text = 'Номер 4111 1111 1111 1112';
+      expect(redactPii(text).text, text);
+    });
+
+    for (final phone in [
+      '+7 (999) 123-45-67',
+      '+79991234567',
+      '+1-202-555-0143',
+      '8 (999) 123-45-67',
+      '8 999 123 45 67',
+      '8-999-123-45-67',
+      '(202) 555-0143',
+    ]) {
+      test('masks phone number $phone', () {
+        final result = redactPii('Звонить по $phone днём');
+
+        expect(result.text, 'Звонить по [PHONE] днём');
+        expect(result.redacted, [phone]);
+      });
+    }
+
+    for (final text in [
+      'Лимит 100 000 000 000 записей',
+      'Диапазон идентификаторов 1000-2000-3000-40',
+      'Договор 1234567890 от 2024-2025 гг.',
+      'Версия 8 999 123',
+      'Таймаут 30000 мс, 5 попыток',
+    ]) {
+      test('leaves ordinary numbers untouched: $text', () {
+        final result = redactPii(text);
+
+        expect(result.text, text);
+        expect(result.hasRedactions, isFalse);
+      });
+    }
+
+    test('lists every redacted value in masking order', () {
+      final result = redactPii('Тел. +7 999 123-45-67, почта a@b.ru, карта 4111111111111111');
+
+      expect(result.text, 'Тел. [PHONE], почта [EMAIL], карта [CARD]');
+      expect(result.redacted, ['a@b.ru', '4111111111111111', '+7 999 123-45-67']);
+    });
+  });
+}
@@ -0,0 +1,81 @@
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/utils/sse_completion.dart';
+
+void main() {
+  group('looksLikeEventStream', () {
+    test('detects the event-stream content type', () {
+      expect(looksLikeEventStream('text/event-stream; charset=utf-8', null), isTrue);
+      expect(looksLikeEventStream('Text/Event-Stream', '{}'), isTrue);
+    });
+
+    test('detects an SSE body sent with a JSON content type', () {
+      expect(looksLikeEventStream('application/json', '\n  data: {"choices":[]}\n\n'), isTrue);
+    });
+
+    test('ignores ordinary JSON responses', () {
+      expect(looksLikeEventStream('application/json', '{"choices":[]}'), isFalse);
+      expect(looksLikeEventStream('application/json', {'data': 'x'}), isFalse);
+      expect(looksLikeEventStream(null, null), isFalse);
+    });
+  });
+
+  group('completionFromEventStream', () {
+    test('joins deltas into a single chat completion', () {
+      const body = 'data: {"id":"c1","model":"gpt-4o","created":1700000000,'
+          '"choices":[{"index":0,"delta":{"role":"assistant","content":"Привет, "}}]}\n\n'
+          'data: {"id":"c1","choices":[{"index":0,"delta":{"content":"мир"}}]}\n\n'
+          'data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}\n\n'
+          'data: {"id":"c1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3}}\n\n'
+          'data: [DONE]\n\n';
+
+      final completion = completionFromEventStream(body);
+
+      expect(completion['id'], 'c1');
+      expect(completion['model'], 'gpt-4o');
+      expect(completion['created'], 1700000000);
+      final choice = (completion['choices'] as List).single as Map;
+      expect(choice['message'], {'role': 'assistant', 'content': 'Привет, мир'});
+      expect(choice['finish_reason'], 'stop');
+      expect(completion['usage'], {'prompt_tokens': 12, 'completion_tokens': 3});
+    });
+
+    test('collects reasoning separately from the content', () {
+      const body = 'data: {"choices":[{"delta":{"reasoning_content":"Думаю. "}}]}\n'
+          'data: {"choices":[{"delta":{"reasoning":"Готово."}}]}\n'
+          'data: {"choices":[{"delta":{"content":"Ответ"},"finish_reason":"stop"}]}\n';
+
+      final message = ((completionFromEventStream(body)['choices'] as List).single as Map)['message'] as Map;
+
+      expect(message['content'], 'Ответ');
+      expect(message['reasoning_content'], 'Думаю. Готово.');
+    });
+
+    test('accepts a whole message sent as one event', () {
+      const body = 'data: {"choices":[{"message":{"role":"assistant","content":"Целиком"},"finish_reason":"length"}]}\n';
+
+      final choice = (completionFromEventStream(body)['choices'] as List).single as Map;
+
+      expect((choice['message'] as Map)['content'], 'Целиком');
+      expect(choice['finish_reason'], 'length');
+    });
+
+    test('skips comments, CRLF line endings and broken events', () {
+      const body = ': keep-alive\r\n'
+          'event: message\r\n'
+          'data: {"choices":[{"delta":{"content":"a"}}]}\r\n'
+          'data: {"choices":[{"delta":{"content":\r\n'
+          'data: {"choices":[{"delta":{"content":"b"}}]}\r\n';
+
+      final message = ((completionFromEventStream(body)['choices'] as List).single as Map)['message'] as Map;
+
+      expect(message['content'], 'ab');
+      expect(message.containsKey('reasoning_content'), isFalse);
+    });
+
+    test('throws FormatException when no event has choices', () {
+      expect(() => completionFromEventStream('data: [DONE]\n\n'), throwsFormatException);
+      expect(() => completionFromEventStream('data: {"usage":{"prompt_tokens":1}}\n'), throwsFormatException);
+      expect(() => completionFromEventStream(''), throwsFormatException);
+    });
+  });
+}
@@ -0,0 +1,27 @@
+import 'package:flutter_test/flutter_test.dart';
+import 'package:tee_zee_nator/utils/text_normalization.dart';
+
+void main() {
+  group('normalizeTextFileContent', () {
+    test('strips a leading UTF-8 BOM', () {
+      expect(normalizeTextFileContent('\uFEFF# Шаблон\n'), '# Шаблон\n');
+    });
+
+    test('keeps a BOM-like character inside the text', () {
+      expect(normalizeTextFileContent('a\uFEFFb'), 'a\uFEFFb');
+    });
+
+    test('converts CRLF and lone CR line endings to LF', () {
+      expect(normalizeTextFileContent('# A\r\n\r\nТекст\rещё\n'), '# A\n\nТекст\nещё\n');
+    });
+
+    test('handles a BOM-prefixed CRLF file', () {
+      expect(normalizeTextFileContent('\uFEFF# A\r\n## B\r\n'), '# A\n## B\n');
+    });
+
+    test('leaves normalized text unchanged', () {
+      const text = '# A\n\n- пункт\n';
+      expect(normalizeTextFileContent(text), text);
+    });
+  });
+}